@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+
+	"otp/internal/config"
+	"otp/internal/database"
+	"otp/internal/models"
+	"otp/internal/repository"
+	"otp/internal/services"
+)
+
+// seed populates the users table with randomly generated users for demos and
+// load testing. It uses the same configuration as the server.
+func main() {
+	count := flag.Int("count", 100, "number of users to create")
+	flag.Parse()
+
+	if *count <= 0 {
+		log.Fatalf("count must be positive, got %d", *count)
+	}
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.VerifyOnly() {
+		log.Fatal("AUTH_MODE=verify-only stores no users; there is nothing to seed")
+	}
+
+	// Initialize database
+	db, err := database.NewDatabase(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Migrate(); err != nil {
+		log.Fatalf("Failed to run database migrations: %v", err)
+	}
+
+	var phones *repository.PhoneProtector
+	if cfg.Privacy.HashPhoneNumbers {
+		hashKey, encryptionKey, err := cfg.PhoneKeys()
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		if phones, err = repository.NewPhoneProtector(hashKey, encryptionKey); err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+	}
+	userRepo := repository.NewUserRepository(db.DB, db.DB, cfg.GetQueryTimeout(), phones)
+	idGenerator, err := services.NewIDGenerator(cfg.Database.UserIDFormat)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	ctx := context.Background()
+
+	created := 0
+	for created < *count {
+		phoneNumber, err := randomPhoneNumber()
+		if err != nil {
+			log.Fatalf("Failed to generate phone number: %v", err)
+		}
+
+		// Skip numbers that already exist rather than failing on the unique constraint
+		existing, err := userRepo.GetByPhoneNumber(ctx, phoneNumber)
+		if err != nil {
+			log.Fatalf("Failed to check phone number %s: %v", phoneNumber, err)
+		}
+		if existing != nil {
+			continue
+		}
+
+		id, err := idGenerator.NewID()
+		if err != nil {
+			log.Fatalf("Failed to generate user ID: %v", err)
+		}
+		if err := userRepo.Create(ctx, models.NewUserWithID(id, phoneNumber)); err != nil {
+			log.Fatalf("Failed to create user %s: %v", phoneNumber, err)
+		}
+		created++
+	}
+
+	log.Printf("Created %d users", created)
+}
+
+// randomPhoneNumber returns a random North American number in E.164 format
+func randomPhoneNumber() (string, error) {
+	areaCode, err := rand.Int(rand.Reader, big.NewInt(800))
+	if err != nil {
+		return "", err
+	}
+	subscriber, err := rand.Int(rand.Reader, big.NewInt(8000000))
+	if err != nil {
+		return "", err
+	}
+	// Area codes and exchanges cannot start with 0 or 1
+	return fmt.Sprintf("+1%03d%07d", areaCode.Int64()+200, subscriber.Int64()+2000000), nil
+}
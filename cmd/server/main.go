@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"log"
 	"net/http"
 	"os"
@@ -10,12 +11,16 @@ import (
 	"time"
 
 	_ "otp/docs"
+	"otp/internal/captcha"
 	"otp/internal/config"
 	"otp/internal/database"
 	"otp/internal/handlers"
+	"otp/internal/metrics"
 	"otp/internal/middleware"
+	"otp/internal/ratelimit"
 	"otp/internal/repository"
 	"otp/internal/services"
+	"otp/internal/validation"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -49,6 +54,52 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Refuse (production) or replace (development) the placeholder JWT secret
+	replaced, err := cfg.SecureJWTSecret()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if replaced {
+		log.Println("WARNING: JWT_SECRET is the insecure default; using a random secret for this run. Tokens will not survive a restart.")
+	}
+	if err := cfg.ValidateOTPLength(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := cfg.ValidateJWTSubjectClaim(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := cfg.ValidateAuthMode(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := cfg.ValidateRetryAfterFormat(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := cfg.ValidateJSONTimeFormat(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if cfg.VerifyOnly() {
+		log.Println("Running in verify-only mode: users are not stored and user endpoints are disabled")
+	}
+	if cfg.OTP.DefaultRegion != "" && !validation.IsKnownRegion(cfg.OTP.DefaultRegion) {
+		log.Fatalf("Invalid configuration: unsupported OTP_DEFAULT_REGION %q", cfg.OTP.DefaultRegion)
+	}
+	// Load the TLS certificate before anything else so a bad one fails
+	// startup rather than every handshake
+	var tlsConfig *tls.Config
+	if cfg.TLSEnabled() {
+		if cfg.Server.TLSCertFile == "" || cfg.Server.TLSKeyFile == "" {
+			log.Fatal("Invalid configuration: SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE must be set together")
+		}
+		certificate, err := tls.LoadX509KeyPair(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+	}
+	if cfg.OTP.DebugPrint && cfg.IsProduction() {
+		log.Println("WARNING: OTP_DEBUG_PRINT is ignored in production; codes will not be printed.")
+	}
+
 	// Initialize database
 	db, err := database.NewDatabase(cfg)
 	if err != nil {
@@ -61,54 +112,280 @@ func main() {
 		log.Fatalf("Failed to run database migrations: %v", err)
 	}
 
+	// Watch the primary so writes fail fast while it is unreachable
+	var primaryMonitor *database.PrimaryMonitor
+	if interval := cfg.GetHealthCheckInterval(); interval > 0 {
+		primaryMonitor = database.NewPrimaryMonitor(db.DB)
+		monitorCtx, stopMonitor := context.WithCancel(context.Background())
+		defer stopMonitor()
+		go primaryMonitor.Run(monitorCtx, interval)
+	}
+
 	// Initialize repositories
-	userRepo := repository.NewUserRepository(db.DB)
-	otpRepo := repository.NewOTPRepository(db.DB)
+	var phones *repository.PhoneProtector
+	if cfg.Privacy.HashPhoneNumbers {
+		hashKey, encryptionKey, err := cfg.PhoneKeys()
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		if phones, err = repository.NewPhoneProtector(hashKey, encryptionKey); err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+
+		// Rows written before hashing was enabled would no longer be found
+		if !cfg.VerifyOnly() {
+			converted, err := repository.ProtectPlaintextUsers(context.Background(), db.DB, phones)
+			if err != nil {
+				log.Fatalf("Failed to hash existing phone numbers: %v", err)
+			}
+			if converted > 0 {
+				log.Printf("Hashed the phone numbers of %d existing users", converted)
+			}
+		}
+		converted, err := repository.ProtectPlaintextOTPs(context.Background(), db.DB, phones)
+		if err != nil {
+			log.Fatalf("Failed to hash existing phone numbers: %v", err)
+		}
+		if converted > 0 {
+			log.Printf("Hashed the phone numbers of OTPs for %d existing numbers", converted)
+		}
+	}
+	userRepo := repository.NewUserRepository(db.DB, db.ReadDB(), cfg.GetQueryTimeout(), phones)
+	otpRepo := repository.NewOTPRepository(db.DB, cfg.GetQueryTimeout(), phones)
+	auditRepo := repository.NewAuditRepository(db.DB)
+
+	// Initialize metrics
+	metricsRegistry := metrics.NewRegistry()
+	metricsRegistry.Register(metrics.NewOTPTableCollector(otpRepo))
+	dbPools := map[string]metrics.DBStatsSource{"primary": db.DB}
+	if db.Replica != nil {
+		dbPools["replica"] = db.Replica
+	}
+	metricsRegistry.Register(metrics.NewDBPoolCollector(dbPools))
+	if cfg.Database.UserCacheSize > 0 && cfg.Database.UserCacheTTLSeconds > 0 && !cfg.VerifyOnly() {
+		cacheHits := metrics.NewCounter("user_cache_hits_total", "User lookups served from the in-process cache.")
+		cacheMisses := metrics.NewCounter("user_cache_misses_total", "User lookups that had to query the database.")
+		metricsRegistry.Register(cacheHits)
+		metricsRegistry.Register(cacheMisses)
+		userRepo = repository.NewCachedUserRepository(userRepo, repository.UserCacheOptions{
+			Size:   cfg.Database.UserCacheSize,
+			TTL:    cfg.GetUserCacheTTL(),
+			Hits:   cacheHits,
+			Misses: cacheMisses,
+		})
+	}
+	replayCounter := metrics.NewCounter("otp_replay_detected_total", "Verify attempts that resubmitted the correct code of an already used OTP.")
+	metricsRegistry.Register(replayCounter)
+	inFlight := metrics.NewGauge("http_inflight_requests", "HTTP requests currently being served.")
+	metricsRegistry.Register(inFlight)
+
+	// Initialize rate limit exemptions
+	exemptions, err := ratelimit.NewExemptions(cfg.RateLimit.ExemptPhones, cfg.RateLimit.ExemptIPs)
+	if err != nil {
+		log.Fatalf("Invalid rate limit exemptions: %v", err)
+	}
+	routePolicies, err := ratelimit.ParseRoutePolicies(cfg.RateLimit.Routes)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Initialize services
-	authService := services.NewAuthService(userRepo, otpRepo, cfg)
+	idGenerator, err := services.NewIDGenerator(cfg.Database.UserIDFormat)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	authOptions := []services.AuthServiceOption{
+		services.WithIDGenerator(idGenerator),
+		services.WithReplayCounter(replayCounter),
+		services.WithRateLimitExemptions(exemptions),
+		services.WithMaxConcurrentGenerations(cfg.RateLimit.MaxConcurrentGenerations),
+	}
+	if cfg.RateLimit.CoalesceGenerate {
+		authOptions = append(authOptions, services.WithGenerateCoalescing())
+	}
+	if cfg.Security.VerifyFailureThreshold > 0 {
+		anomalyCounter := metrics.NewCounter("otp_verify_anomalies_total", "Spikes in failed OTP verifications across all phone numbers.")
+		metricsRegistry.Register(anomalyCounter)
+		detector := services.NewFailureSpikeDetector(cfg.Security.VerifyFailureThreshold, cfg.GetVerifyFailureWindow(), anomalyCounter)
+		authOptions = append(authOptions, services.WithAnomalyDetector(detector))
+	}
+	if cfg.Security.VerifyBackoffBaseMS > 0 {
+		backoff := services.NewVerifyBackoff(cfg.GetVerifyBackoffBase(), cfg.GetVerifyBackoffMax(), cfg.GetRateLimitWindow())
+		authOptions = append(authOptions, services.WithVerifyBackoff(backoff))
+	}
+	if cfg.OTP.ResendCooldownSeconds > 0 && cfg.OTP.FreeResends > 0 {
+		authOptions = append(authOptions, services.WithResendBurst(services.NewResendBurst(cfg.GetRateLimitWindow())))
+	}
+	authService := services.NewAuthService(userRepo, otpRepo, cfg, authOptions...)
 	userService := services.NewUserService(userRepo)
+	auditLogger := services.NewAuditLogger(auditRepo)
+	dataExporter := services.NewDataExporter(userRepo, otpRepo, auditLogger)
+
+	// Initialize rate limit trackers
+	phoneTracker := ratelimit.NewMemoryPhoneTracker(cfg.RateLimit.MaxDistinctPhonesPerIP, cfg.GetRateLimitWindow())
+
+	// Maintenance mode starts from config and can be toggled by admins
+	maintenanceMode := middleware.NewMaintenanceMode(cfg.Maintenance.Enabled, cfg.GetMaintenanceRetryAfter())
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(authService)
-	userHandler := handlers.NewUserHandler(userService)
+	var captchaVerifier captcha.Verifier
+	if cfg.Captcha.Provider != "" {
+		captchaVerifier, err = captcha.NewVerifier(cfg.Captcha.Provider, cfg.Captcha.Secret, cfg.Captcha.MinScore,
+			&http.Client{Timeout: cfg.GetCaptchaTimeout()})
+		if err != nil {
+			log.Fatalf("Invalid CAPTCHA configuration: %v", err)
+		}
+	}
+	authHandler := handlers.NewAuthHandler(authService, phoneTracker, exemptions, captchaVerifier, auditLogger)
+	userHandler := handlers.NewUserHandler(userService, auditLogger, cfg.OTP.DefaultRegion)
+	auditHandler := handlers.NewAuditHandler(auditLogger)
+	exportHandler := handlers.NewExportHandler(dataExporter, auditLogger)
+	limitsHandler := handlers.NewLimitsHandler(authService, auditLogger)
+	otpCleanupHandler := handlers.NewOTPCleanupHandler(authService, auditLogger)
+	featureHandler := handlers.NewFeatureHandler(cfg)
+	clientConfigHandler := handlers.NewClientConfigHandler(authService, cfg)
+	maintenanceHandler := handlers.NewMaintenanceHandler(maintenanceMode, auditLogger)
+
+	// Register custom request validators
+	if err := validation.RegisterValidators(); err != nil {
+		log.Fatalf("Failed to register validators: %v", err)
+	}
 
 	// Setup Gin router
-	router := gin.Default()
+	router := gin.New()
+	if len(cfg.Server.TrustedProxies) > 0 {
+		if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+			log.Fatalf("Invalid trusted proxies: %v", err)
+		}
+	}
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(handlers.NotFound)
+	router.NoMethod(handlers.MethodNotAllowed(router.Routes))
 
 	// Add middleware
+	router.Use(middleware.InFlightMiddleware(inFlight))
+	router.Use(middleware.RequestIDMiddleware(), middleware.LoggerMiddleware(), gin.Recovery())
 	router.Use(middleware.CORSMiddleware())
+	if cfg.DebugLog.Enabled {
+		if cfg.DebugLog.CaptureBodies && cfg.IsProduction() {
+			log.Println("WARNING: DEBUG_LOG_BODIES is on in production; redacted request and response bodies will be logged.")
+		}
+		router.Use(middleware.DebugLogMiddleware(middleware.DebugLogOptions{
+			Routes:        cfg.DebugLog.Routes,
+			CaptureBodies: cfg.DebugLog.CaptureBodies,
+			RedactFields:  cfg.DebugLog.RedactFields,
+		}))
+	}
 
 	// API routes
 	api := router.Group("/api/v1")
+	if cfg.Server.RequireHTTPS {
+		if len(cfg.Server.TrustedProxies) == 0 && !cfg.TLSEnabled() {
+			log.Fatal("SERVER_REQUIRE_HTTPS needs SERVER_TLS_CERT_FILE or SERVER_TRUSTED_PROXIES to name the proxies that terminate TLS")
+		}
+		trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+		if err != nil {
+			log.Fatalf("Invalid trusted proxies: %v", err)
+		}
+		api.Use(middleware.RequireHTTPSMiddleware(trustedProxies))
+	}
+	api.Use(
+		middleware.APIVersionMiddleware(1),
+		middleware.JSONCaseMiddleware(cfg.Server.JSONFieldCase),
+		middleware.JSONTimeFormatMiddleware(cfg.Server.JSONTimeFormat),
+		middleware.MaintenanceMiddleware(maintenanceMode, "/api/v1/admin/maintenance"),
+		middleware.DegradedMiddleware(primaryMonitor, cfg.GetHealthCheckInterval()),
+		middleware.RouteRateLimitMiddleware(routePolicies, exemptions, authService, cfg.RateLimit.RetryAfterFormat, cfg.OTP.DefaultRegion),
+	)
 	{
+		api.GET("/features", featureHandler.ListFeatures)
+
 		// Auth routes
 		auth := api.Group("/auth")
 		{
+			auth.GET("/config", clientConfigHandler.GetClientConfig)
+
 			otp := auth.Group("/otp")
 			{
 				otp.POST("/generate", authHandler.GenerateOTP)
 				otp.POST("/verify", authHandler.VerifyOTP)
+				otp.DELETE("", middleware.RequireFeature(cfg, config.FeatureOTPCancel), authHandler.CancelOTP)
+			}
+
+			auth.GET("/token/info", middleware.AuthMiddleware(authService), authHandler.TokenInfo)
+
+			// Verify-only mode stores no users, so nothing that reads or
+			// changes one is served
+			if !cfg.VerifyOnly() {
+				auth.PATCH("/me", middleware.AuthMiddleware(authService), userHandler.UpdateMe)
+				auth.POST("/token/refresh-claims", middleware.AuthMiddleware(authService), authHandler.RefreshClaims)
+
+				phone := auth.Group("/phone")
+				phone.Use(middleware.RequireFeature(cfg, config.FeaturePhoneChange), middleware.AuthMiddleware(authService))
+				{
+					phone.POST("/change-request", authHandler.RequestPhoneChange)
+					phone.POST("/change-confirm", authHandler.ConfirmPhoneChange)
+				}
+
+				recoveryPhone := auth.Group("/recovery-phone")
+				recoveryPhone.Use(
+					middleware.RequireFeature(cfg, config.FeatureAccountRecovery),
+					middleware.AuthMiddleware(authService),
+					middleware.RequireRecentAuth(cfg.GetStepUpMaxAge()),
+				)
+				{
+					recoveryPhone.POST("/request", authHandler.RequestRecoveryPhone)
+					recoveryPhone.POST("/confirm", authHandler.ConfirmRecoveryPhone)
+					recoveryPhone.DELETE("", authHandler.RemoveRecoveryPhone)
+				}
+
+				recovery := auth.Group("/recovery")
+				recovery.Use(middleware.RequireFeature(cfg, config.FeatureAccountRecovery))
+				{
+					recovery.POST("/request", authHandler.RequestAccountRecovery)
+					recovery.POST("/confirm", authHandler.RecoverAccount)
+				}
 			}
 		}
 
 		// User routes (protected)
-		users := api.Group("/users")
-		users.Use(middleware.AuthMiddleware(authService))
+		if !cfg.VerifyOnly() {
+			users := api.Group("/users")
+			users.Use(middleware.AuthMiddleware(authService), middleware.PhoneMaskingMiddleware(cfg))
+			{
+				users.GET("", userHandler.ListUsers)
+				users.GET("/count", middleware.RequireFeature(cfg, config.FeatureUserCount), middleware.AdminMiddleware(cfg), userHandler.CountUsers)
+				users.GET("/:id", userHandler.GetUser)
+				users.DELETE("/:id", userHandler.DeleteUser)
+			}
+		}
+
+		// Admin routes (protected, admin only)
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(authService), middleware.AdminMiddleware(cfg))
 		{
-			users.GET("", userHandler.ListUsers)
-			users.GET("/:id", userHandler.GetUser)
-			users.DELETE("/:id", userHandler.DeleteUser)
+			admin.GET("/audit-events", middleware.RequireFeature(cfg, config.FeatureAuditLog), auditHandler.ListAuditEvents)
+			admin.GET("/audit-events/verify", middleware.RequireFeature(cfg, config.FeatureAuditLog), auditHandler.VerifyAuditEvents)
+			admin.GET("/maintenance", maintenanceHandler.GetMaintenance)
+			admin.POST("/maintenance", maintenanceHandler.SetMaintenance)
+			admin.POST("/otp/cleanup", otpCleanupHandler.CleanupExpiredOTPs)
+			if !cfg.VerifyOnly() {
+				admin.GET("/users/by-phone", userHandler.LookupUserByPhone)
+				admin.PUT("/users/:id/status", userHandler.SetUserStatus)
+				admin.GET("/users/:id/export", exportHandler.ExportUser)
+				admin.POST("/users/:id/reset-limits", limitsHandler.ResetUserLimits)
+			}
 		}
 	}
 
+	// Prometheus metrics
+	router.GET("/metrics", metricsRegistry.Handler())
+
 	// Swagger documentation
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok", "timestamp": time.Now()})
-	})
+	router.GET("/health", handlers.HealthCheck(primaryMonitor))
 
 	// Create server
 	srv := &http.Server{
@@ -116,10 +393,39 @@ func main() {
 		Handler: router,
 	}
 
+	// Serving with a TLS config also enables HTTP/2
+	var redirectSrv *http.Server
+	if tlsConfig != nil {
+		srv.TLSConfig = tlsConfig
+
+		if cfg.Server.HTTPRedirectPort != "" {
+			redirectSrv = &http.Server{
+				Addr:              ":" + cfg.Server.HTTPRedirectPort,
+				Handler:           middleware.HTTPSRedirectHandler(cfg.Server.Port),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			go func() {
+				log.Printf("Redirecting HTTP on port %s to HTTPS", cfg.Server.HTTPRedirectPort)
+				if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					log.Fatalf("Failed to start HTTP redirect server: %v", err)
+				}
+			}()
+		}
+	} else if cfg.Server.HTTPRedirectPort != "" {
+		log.Println("WARNING: SERVER_HTTP_REDIRECT_PORT is ignored without SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE.")
+	}
+
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Server starting on port %s", cfg.Server.Port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if srv.TLSConfig != nil {
+			log.Printf("Server starting on port %s with TLS", cfg.Server.Port)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Server starting on port %s", cfg.Server.Port)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
@@ -134,9 +440,37 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	go reportDraining(ctx, inFlight)
+
+	if redirectSrv != nil {
+		redirectSrv.Shutdown(ctx)
+	}
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
 
 	log.Println("Server exited")
 }
+
+// reportDraining logs how many requests are still in flight every second
+// until they have all finished or ctx expires.
+func reportDraining(ctx context.Context, inFlight *metrics.Gauge) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		count := inFlight.Value()
+		if count == 0 {
+			log.Println("All in-flight requests drained")
+			return
+		}
+		log.Printf("Waiting for %d in-flight request(s) to finish", count)
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Shutdown deadline reached with %d request(s) still in flight", inFlight.Value())
+			return
+		case <-ticker.C:
+		}
+	}
+}
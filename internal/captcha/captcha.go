@@ -0,0 +1,108 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrFailed is returned when the provider rejects a token or scores it
+	// below the configured threshold
+	ErrFailed = errors.New("captcha verification failed")
+	// ErrUnavailable is returned when the provider cannot be reached or
+	// returns an unusable response
+	ErrUnavailable = errors.New("captcha verification is unavailable")
+)
+
+// verifyURLs maps each supported provider to its siteverify endpoint. All of
+// them accept the same form-encoded request and return the same core fields.
+var verifyURLs = map[string]string{
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// Verifier checks a CAPTCHA token solved by a client
+type Verifier interface {
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+type siteVerifier struct {
+	verifyURL string
+	secret    string
+	minScore  float64
+	client    *http.Client
+}
+
+// NewVerifier returns a Verifier for the named provider ("recaptcha",
+// "hcaptcha" or "turnstile"). Tokens whose response carries a score below
+// minScore are rejected; providers that do not score tokens are judged on
+// success alone.
+func NewVerifier(provider, secret string, minScore float64, client *http.Client) (Verifier, error) {
+	verifyURL, ok := verifyURLs[strings.ToLower(provider)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported captcha provider %q", provider)
+	}
+	if secret == "" {
+		return nil, errors.New("captcha secret is required")
+	}
+	return NewSiteVerifier(verifyURL, secret, minScore, client), nil
+}
+
+// NewSiteVerifier returns a Verifier that posts tokens to a siteverify
+// compatible endpoint at verifyURL.
+func NewSiteVerifier(verifyURL, secret string, minScore float64, client *http.Client) Verifier {
+	return &siteVerifier{
+		verifyURL: verifyURL,
+		secret:    secret,
+		minScore:  minScore,
+		client:    client,
+	}
+}
+
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	Score      *float64 `json:"score"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (v *siteVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	form := url.Values{"secret": {v.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: provider returned status %d", ErrUnavailable, resp.StatusCode)
+	}
+
+	var result siteVerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrFailed, strings.Join(result.ErrorCodes, ", "))
+	}
+	if result.Score != nil && *result.Score < v.minScore {
+		return fmt.Errorf("%w: score %.2f below %.2f", ErrFailed, *result.Score, v.minScore)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSiteVerifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		minScore float64
+		wantErr  error
+	}{
+		{"success without score", http.StatusOK, `{"success":true}`, 0.5, nil},
+		{"success above threshold", http.StatusOK, `{"success":true,"score":0.9}`, 0.5, nil},
+		{"score below threshold", http.StatusOK, `{"success":true,"score":0.1}`, 0.5, ErrFailed},
+		{"rejected token", http.StatusOK, `{"success":false,"error-codes":["invalid-input-response"]}`, 0, ErrFailed},
+		{"provider error", http.StatusInternalServerError, ``, 0, ErrUnavailable},
+		{"malformed response", http.StatusOK, `not json`, 0, ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Fatalf("Failed to parse form: %v", err)
+				}
+				if r.PostForm.Get("secret") != "secret" || r.PostForm.Get("response") != "token" || r.PostForm.Get("remoteip") != "203.0.113.7" {
+					t.Errorf("Unexpected form %v", r.PostForm)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			verifier := NewSiteVerifier(server.URL, "secret", tt.minScore, server.Client())
+			err := verifier.Verify(context.Background(), "token", "203.0.113.7")
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewVerifierRejectsUnknownProvider(t *testing.T) {
+	if _, err := NewVerifier("unknown", "secret", 0, http.DefaultClient); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+	if _, err := NewVerifier("turnstile", "", 0, http.DefaultClient); err == nil {
+		t.Error("Expected an error for a missing secret")
+	}
+	if _, err := NewVerifier("Turnstile", "secret", 0, http.DefaultClient); err != nil {
+		t.Errorf("Expected provider names to be case-insensitive, got %v", err)
+	}
+}
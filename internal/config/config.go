@@ -1,24 +1,72 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// DefaultDebugLogRedactFields are the request and response fields whose
+// values are never written to debug logs unless DEBUG_LOG_REDACT_FIELDS
+// overrides them
+var DefaultDebugLogRedactFields = []string{"code", "phone_number", "new_phone_number", "recovery_phone", "token", "captcha_token"}
+
+// MaxOTPLength is the width of the otps.code column; longer codes cannot be
+// stored
+const MaxOTPLength = 10
+
+// DefaultJWTSecret is the placeholder secret shipped in the example
+// configuration. It must never be used to sign real tokens.
+const DefaultJWTSecret = "your-super-secret-jwt-key-change-in-production"
+
 type Config struct {
-	Server    ServerConfig
-	Database  DatabaseConfig
-	JWT       JWTConfig
-	OTP       OTPConfig
-	RateLimit RateLimitConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	JWT         JWTConfig
+	Auth        AuthConfig
+	OTP         OTPConfig
+	RateLimit   RateLimitConfig
+	Admin       AdminConfig
+	Features    FeaturesConfig
+	Privacy     PrivacyConfig
+	Maintenance MaintenanceConfig
+	Security    SecurityConfig
+	Captcha     CaptchaConfig
+	DebugLog    DebugLogConfig
 }
 
 type ServerConfig struct {
-	Port string
-	Host string
+	Port        string
+	Host        string
+	Environment string
+	// JSONFieldCase is the default field naming style of response bodies,
+	// "snake" or "camel"; clients can override it per request
+	JSONFieldCase string
+	// JSONTimeFormat is the default timestamp format of response bodies,
+	// "rfc3339" or "unix" (also called "epoch"); clients can override it
+	// per request
+	JSONTimeFormat string
+	// TrustedProxies are the addresses and CIDR ranges of the reverse proxies
+	// whose X-Forwarded-* headers are believed. Empty keeps gin's default of
+	// trusting every peer for the client IP.
+	TrustedProxies []string
+	// RequireHTTPS rejects API requests that a trusted proxy did not receive
+	// over HTTPS
+	RequireHTTPS bool
+	// TLSCertFile and TLSKeyFile make the server terminate TLS itself, which
+	// also enables HTTP/2. Both empty serves plain HTTP.
+	TLSCertFile string
+	TLSKeyFile  string
+	// HTTPRedirectPort, when TLS is enabled, is a port on which plain HTTP
+	// requests are redirected to HTTPS. Empty disables the redirect.
+	HTTPRedirectPort string
 }
 
 type DatabaseConfig struct {
@@ -28,51 +76,339 @@ type DatabaseConfig struct {
 	Password string
 	Name     string
 	SSLMode  string
+	// ReplicaURL is an optional DSN for a read replica that serves the
+	// read-heavy user list and count queries
+	ReplicaURL string
+	// HealthCheckIntervalSeconds is how often the primary is pinged to
+	// decide whether to run in degraded mode. 0 disables the check.
+	HealthCheckIntervalSeconds int
+	// QueryTimeoutMS bounds each user and OTP repository query so one slow
+	// query cannot use up the whole request deadline. 0 disables it.
+	QueryTimeoutMS int
+	// UserIDFormat is "uuidv4" for random user IDs or "uuidv7" for
+	// time-ordered ones, which keep primary key inserts local
+	UserIDFormat string
+	// UserCacheSize is how many users GetByID and GetByPhoneNumber keep in an
+	// in-process LRU cache. 0 disables the cache.
+	UserCacheSize int
+	// UserCacheTTLSeconds is how long a cached user may be served; it bounds
+	// how stale users changed by another instance can be
+	UserCacheTTLSeconds int
 }
 
+// Values for JWTConfig.SubjectClaim
+const (
+	JWTSubjectUserID      = "user_id"
+	JWTSubjectPhoneNumber = "phone_number"
+)
+
 type JWTConfig struct {
 	Secret      string
 	ExpiryHours int
+	// SubjectClaim picks what tokens carry as the standard sub claim:
+	// JWTSubjectUserID (also used when empty) or JWTSubjectPhoneNumber
+	SubjectClaim string
+}
+
+// Auth modes
+const (
+	AuthModeFull       = "full"
+	AuthModeVerifyOnly = "verify-only"
+)
+
+type AuthConfig struct {
+	// Mode is AuthModeFull (also used when empty), or AuthModeVerifyOnly to
+	// only prove phone ownership for a system that manages its own users:
+	// no users are stored and a verified code yields a short-lived token
+	// carrying just the phone number
+	Mode string
+	// VerifyOnlyTokenMinutes is how long tokens issued in verify-only mode
+	// are valid
+	VerifyOnlyTokenMinutes int
 }
 
 type OTPConfig struct {
 	ExpiryMinutes int
 	Length        int
+	// PreviousCodeGraceSeconds keeps the code superseded by a resend valid
+	// for this long after the new one is issued. Accepting two codes halves
+	// the brute-force search space during that window, so it defaults to 0
+	// (disabled).
+	PreviousCodeGraceSeconds int
+	// ResendCooldownSeconds is the minimum wait after one OTP request before
+	// another one for the same phone number. 0 disables the cooldown.
+	ResendCooldownSeconds int
+	// FreeResends is how many resends a phone number may make in quick
+	// succession before the resend cooldown applies. The count starts over
+	// after a successful verify or a rate limit window without requests.
+	FreeResends int
+	// AcceptRecentCount lets a verification match any of this many most
+	// recent pending codes, for users who requested more than one and type
+	// an earlier one. Like the grace period it widens the guessable set.
+	AcceptRecentCount int
+	// MaxUses lets one code authorize this many verifications within its
+	// lifetime, for flows that verify and then confirm a related action.
+	// A code that can be replayed is worth more to whoever intercepts it,
+	// so it defaults to 1 (single use).
+	MaxUses int
+	// ReplayWindowMinutes bounds how old a used OTP can be for a correct
+	// resubmission of its code to be reported as a replay. Older matches are
+	// more likely to be coincidental guesses. 0 disables replay detection.
+	ReplayWindowMinutes int
+	// CodeGroupSize splits codes into dash-separated groups of this many
+	// characters when they are displayed (e.g. 123-456). 0 disables grouping.
+	CodeGroupSize int
+	// StripCodeSeparators removes spaces, dashes and other separators from
+	// submitted codes before comparing them, so grouped input still matches.
+	// This always happens for the default numeric codes; the setting extends
+	// it to custom code generators.
+	StripCodeSeparators bool
+	// DebugPrint prints each generated code to stdout, with the phone number
+	// masked, for local testing. It is ignored in production.
+	DebugPrint bool
+	// DefaultRegion is the ISO 3166-1 alpha-2 country (e.g. "GB") that
+	// generate, verify and cancel assume for phone numbers given in national
+	// format. Empty requires E.164.
+	DefaultRegion string
+	// RequireExistingUser refuses to generate codes for phone numbers with
+	// no user, for systems whose accounts are provisioned out of band
+	RequireExistingUser bool
+	// HideUnknownUsers answers generate requests refused by
+	// RequireExistingUser as if a code had been sent, so the endpoint can't
+	// be used to find out which numbers have accounts
+	HideUnknownUsers bool
 }
 
 type RateLimitConfig struct {
-	MaxRequests   int
-	WindowMinutes int
+	MaxRequests            int
+	WindowMinutes          int
+	MaxDistinctPhonesPerIP int
+	MaxPerDay              int
+	// WarningThreshold makes successful OTP requests carry a warning once at
+	// most this many requests remain in the window. 0 disables warnings.
+	WarningThreshold int
+	// ExemptPhones and ExemptIPs bypass rate limiting entirely. ExemptIPs
+	// entries may be addresses or CIDR ranges.
+	ExemptPhones []string
+	ExemptIPs    []string
+	// MaxConcurrentGenerations caps OTP generations in flight across all
+	// clients; excess requests fail fast with SERVER_BUSY. 0 disables it.
+	MaxConcurrentGenerations int
+	// CoalesceGenerate makes concurrent generate requests for the same phone
+	// number share one OTP and one send
+	CoalesceGenerate bool
+	// Routes are per-route limits applied by middleware on top of the OTP
+	// limits above, each "METHOD PATH REQUESTS/WINDOW KEY", e.g.
+	// "POST /api/v1/auth/otp/verify 20/1m ip"
+	Routes []string
+	// RetryAfterFormat is how 429 responses express Retry-After:
+	// RetryAfterFormatSeconds (also used when empty) or
+	// RetryAfterFormatHTTPDate
+	RetryAfterFormat string
+}
+
+// JSON_TIME_FORMAT values. Epoch is another name for unix, as it is in
+// Accept profiles.
+const (
+	JSONTimeFormatRFC3339 = "rfc3339"
+	JSONTimeFormatUnix    = "unix"
+	JSONTimeFormatEpoch   = "epoch"
+)
+
+// Retry-After header formats
+const (
+	RetryAfterFormatSeconds  = "seconds"
+	RetryAfterFormatHTTPDate = "http-date"
+)
+
+type PrivacyConfig struct {
+	// MaskPhoneNumbers hides the middle digits of phone numbers in user
+	// responses for non-admin callers
+	MaskPhoneNumbers bool
+	// HashPhoneNumbers stores phone numbers as HMAC-SHA256 hashes keyed by
+	// PhoneHashKey, with the number itself kept encrypted under
+	// PhoneEncryptionKey for display. Both keys are hex-encoded 32 bytes.
+	HashPhoneNumbers   bool
+	PhoneHashKey       string
+	PhoneEncryptionKey string
+}
+
+type MaintenanceConfig struct {
+	// Enabled starts the server in maintenance mode; admins can toggle it
+	// at runtime
+	Enabled           bool
+	RetryAfterSeconds int
+}
+
+type SecurityConfig struct {
+	// VerifyFailureThreshold is the number of failed verifications, across
+	// all phone numbers, within VerifyFailureWindowSeconds that raises a
+	// security alert. 0 disables the detector.
+	VerifyFailureThreshold     int
+	VerifyFailureWindowSeconds int
+	// StepUpMaxAgeMinutes is how recent a login must be to manage the
+	// recovery phone number
+	StepUpMaxAgeMinutes int
+	// VerifyBackoffBaseMS delays the response to the second consecutive
+	// wrong code for a phone number by this long, doubling for each one
+	// after it up to VerifyBackoffMaxMS. 0 disables the backoff.
+	VerifyBackoffBaseMS int
+	VerifyBackoffMaxMS  int
+}
+
+// CaptchaConfig enables CAPTCHA verification on OTP generation. An empty
+// Provider disables it.
+type CaptchaConfig struct {
+	// Provider is "recaptcha", "hcaptcha" or "turnstile"
+	Provider string
+	// SiteKey is the public key clients render the challenge with
+	SiteKey string
+	Secret  string
+	// MinScore rejects tokens the provider scores lower (reCAPTCHA v3 and
+	// hCaptcha Enterprise); unscored tokens are judged on success alone
+	MinScore       float64
+	TimeoutSeconds int
+}
+
+// DebugLogConfig enables verbose request logging for debugging client
+// integrations
+type DebugLogConfig struct {
+	Enabled bool
+	// Routes limits logging to routes whose path starts with one of these
+	// prefixes; empty logs every route
+	Routes []string
+	// CaptureBodies adds request and response bodies to the log, with the
+	// values of RedactFields replaced
+	CaptureBodies bool
+	RedactFields  []string
+}
+
+type AdminConfig struct {
+	PhoneNumbers []string
 }
 
 func Load() (*Config, error) {
+	return LoadWithSecretProviders(DefaultSecretProviders()...)
+}
+
+// LoadWithSecretProviders is Load with the providers used to look up
+// secrets such as JWT_SECRET, tried in order
+func LoadWithSecretProviders(providers ...SecretProvider) (*Config, error) {
 	// Load .env file if it exists
 	godotenv.Load()
 
+	jwtSecret, err := getSecret(providers, "JWT_SECRET", DefaultJWTSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	phoneHashKey, err := getSecret(providers, "PHONE_HASH_KEY", "")
+	if err != nil {
+		return nil, err
+	}
+	phoneEncryptionKey, err := getSecret(providers, "PHONE_ENCRYPTION_KEY", "")
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
-			Host: getEnv("SERVER_HOST", "0.0.0.0"),
+			Port:             getEnv("SERVER_PORT", "8080"),
+			Host:             getEnv("SERVER_HOST", "0.0.0.0"),
+			Environment:      getEnv("APP_ENV", "development"),
+			JSONFieldCase:    getEnv("JSON_FIELD_CASE", "snake"),
+			JSONTimeFormat:   strings.ToLower(getEnv("JSON_TIME_FORMAT", JSONTimeFormatRFC3339)),
+			TrustedProxies:   getEnvAsSlice("SERVER_TRUSTED_PROXIES"),
+			RequireHTTPS:     getEnvAsBool("SERVER_REQUIRE_HTTPS", false),
+			TLSCertFile:      getEnv("SERVER_TLS_CERT_FILE", ""),
+			TLSKeyFile:       getEnv("SERVER_TLS_KEY_FILE", ""),
+			HTTPRedirectPort: getEnv("SERVER_HTTP_REDIRECT_PORT", ""),
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "otp_user"),
-			Password: getEnv("DB_PASSWORD", "otp_password"),
-			Name:     getEnv("DB_NAME", "otp_db"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			Host:                       getEnv("DB_HOST", "localhost"),
+			Port:                       getEnv("DB_PORT", "5432"),
+			User:                       getEnv("DB_USER", "otp_user"),
+			Password:                   getEnv("DB_PASSWORD", "otp_password"),
+			Name:                       getEnv("DB_NAME", "otp_db"),
+			SSLMode:                    getEnv("DB_SSLMODE", "disable"),
+			ReplicaURL:                 getEnv("DB_REPLICA_URL", ""),
+			HealthCheckIntervalSeconds: getEnvAsInt("DB_HEALTH_CHECK_INTERVAL_SECONDS", 10),
+			QueryTimeoutMS:             getEnvAsInt("DB_QUERY_TIMEOUT_MS", 3000),
+			UserIDFormat:               getEnv("USER_ID_FORMAT", "uuidv4"),
+			UserCacheSize:              getEnvAsInt("USER_CACHE_SIZE", 0),
+			UserCacheTTLSeconds:        getEnvAsInt("USER_CACHE_TTL_SECONDS", 30),
 		},
 		JWT: JWTConfig{
-			Secret:      getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
-			ExpiryHours: getEnvAsInt("JWT_EXPIRY_HOURS", 24),
+			Secret:       jwtSecret,
+			ExpiryHours:  getEnvAsInt("JWT_EXPIRY_HOURS", 24),
+			SubjectClaim: getEnv("JWT_SUBJECT_CLAIM", JWTSubjectUserID),
+		},
+		Auth: AuthConfig{
+			Mode:                   getEnv("AUTH_MODE", AuthModeFull),
+			VerifyOnlyTokenMinutes: getEnvAsInt("AUTH_VERIFY_ONLY_TOKEN_MINUTES", 5),
 		},
 		OTP: OTPConfig{
-			ExpiryMinutes: getEnvAsInt("OTP_EXPIRY_MINUTES", 2),
-			Length:        getEnvAsInt("OTP_LENGTH", 6),
+			ExpiryMinutes:            getEnvAsInt("OTP_EXPIRY_MINUTES", 2),
+			Length:                   getEnvAsInt("OTP_LENGTH", 6),
+			PreviousCodeGraceSeconds: getEnvAsInt("OTP_PREVIOUS_CODE_GRACE_SECONDS", 0),
+			ResendCooldownSeconds:    getEnvAsInt("OTP_RESEND_COOLDOWN_SECONDS", 0),
+			FreeResends:              getEnvAsInt("OTP_FREE_RESENDS", 0),
+			MaxUses:                  getEnvAsInt("OTP_MAX_USES", 1),
+			ReplayWindowMinutes:      getEnvAsInt("OTP_REPLAY_WINDOW_MINUTES", 60),
+			AcceptRecentCount:        getEnvAsInt("OTP_ACCEPT_RECENT_COUNT", 1),
+			CodeGroupSize:            getEnvAsInt("OTP_CODE_GROUP_SIZE", 0),
+			StripCodeSeparators:      getEnvAsBool("OTP_STRIP_CODE_SEPARATORS", false),
+			DebugPrint:               getEnvAsBool("OTP_DEBUG_PRINT", false),
+			DefaultRegion:            strings.ToUpper(getEnv("OTP_DEFAULT_REGION", "")),
+			RequireExistingUser:      getEnvAsBool("OTP_REQUIRE_EXISTING_USER", false),
+			HideUnknownUsers:         getEnvAsBool("OTP_HIDE_UNKNOWN_USERS", true),
 		},
 		RateLimit: RateLimitConfig{
-			MaxRequests:   getEnvAsInt("RATE_LIMIT_MAX_REQUESTS", 3),
-			WindowMinutes: getEnvAsInt("RATE_LIMIT_WINDOW_MINUTES", 10),
+			MaxRequests:              getEnvAsInt("RATE_LIMIT_MAX_REQUESTS", 3),
+			WindowMinutes:            getEnvAsInt("RATE_LIMIT_WINDOW_MINUTES", 10),
+			MaxDistinctPhonesPerIP:   getEnvAsInt("RATE_LIMIT_MAX_DISTINCT_PHONES_PER_IP", 5),
+			WarningThreshold:         getEnvAsInt("RATE_LIMIT_WARNING_THRESHOLD", 1),
+			ExemptPhones:             getEnvAsSlice("RATE_LIMIT_EXEMPT_PHONES"),
+			ExemptIPs:                getEnvAsSlice("RATE_LIMIT_EXEMPT_IPS"),
+			MaxPerDay:                getEnvAsInt("RATE_LIMIT_MAX_PER_DAY", 20),
+			MaxConcurrentGenerations: getEnvAsInt("RATE_LIMIT_MAX_CONCURRENT_GENERATIONS", 0),
+			CoalesceGenerate:         getEnvAsBool("RATE_LIMIT_COALESCE_GENERATE", false),
+			Routes:                   getEnvAsSlice("RATE_LIMIT_ROUTES"),
+			RetryAfterFormat:         getEnv("RATE_LIMIT_RETRY_AFTER_FORMAT", RetryAfterFormatSeconds),
+		},
+		Admin: AdminConfig{
+			PhoneNumbers: getEnvAsSlice("ADMIN_PHONE_NUMBERS"),
+		},
+		Features: loadFeatures(),
+		Privacy: PrivacyConfig{
+			MaskPhoneNumbers:   getEnvAsBool("MASK_PHONE_NUMBERS", false),
+			HashPhoneNumbers:   getEnvAsBool("HASH_PHONE_NUMBERS", false),
+			PhoneHashKey:       phoneHashKey,
+			PhoneEncryptionKey: phoneEncryptionKey,
+		},
+		Maintenance: MaintenanceConfig{
+			Enabled:           getEnvAsBool("MAINTENANCE_MODE", false),
+			RetryAfterSeconds: getEnvAsInt("MAINTENANCE_RETRY_AFTER_SECONDS", 120),
+		},
+		Security: SecurityConfig{
+			VerifyFailureThreshold:     getEnvAsInt("ANOMALY_VERIFY_FAILURE_THRESHOLD", 0),
+			VerifyFailureWindowSeconds: getEnvAsInt("ANOMALY_VERIFY_FAILURE_WINDOW_SECONDS", 60),
+			StepUpMaxAgeMinutes:        getEnvAsInt("STEP_UP_MAX_AGE_MINUTES", 10),
+			VerifyBackoffBaseMS:        getEnvAsInt("VERIFY_BACKOFF_BASE_MS", 0),
+			VerifyBackoffMaxMS:         getEnvAsInt("VERIFY_BACKOFF_MAX_MS", 2000),
+		},
+		Captcha: CaptchaConfig{
+			Provider:       getEnv("CAPTCHA_PROVIDER", ""),
+			SiteKey:        getEnv("CAPTCHA_SITE_KEY", ""),
+			Secret:         getEnv("CAPTCHA_SECRET", ""),
+			MinScore:       getEnvAsFloat("CAPTCHA_MIN_SCORE", 0.5),
+			TimeoutSeconds: getEnvAsInt("CAPTCHA_TIMEOUT_SECONDS", 5),
+		},
+		DebugLog: DebugLogConfig{
+			Enabled:       getEnvAsBool("DEBUG_LOG_ENABLED", false),
+			Routes:        getEnvAsSlice("DEBUG_LOG_ROUTES"),
+			CaptureBodies: getEnvAsBool("DEBUG_LOG_BODIES", false),
+			RedactFields:  getEnvAsSliceOrDefault("DEBUG_LOG_REDACT_FIELDS", DefaultDebugLogRedactFields),
 		},
 	}, nil
 }
@@ -93,18 +429,260 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsSlice(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvAsSliceOrDefault(key string, defaultValue []string) []string {
+	if values := getEnvAsSlice(key); len(values) > 0 {
+		return values
+	}
+	return defaultValue
+}
+
 func (c *Config) GetDatabaseURL() string {
 	return "postgres://" + c.Database.User + ":" + c.Database.Password + "@" + c.Database.Host + ":" + c.Database.Port + "/" + c.Database.Name + "?sslmode=" + c.Database.SSLMode
 }
 
+// TLSEnabled reports whether the server terminates TLS itself
+func (c *Config) TLSEnabled() bool {
+	return c.Server.TLSCertFile != "" || c.Server.TLSKeyFile != ""
+}
+
 func (c *Config) GetJWTExpiry() time.Duration {
 	return time.Duration(c.JWT.ExpiryHours) * time.Hour
 }
 
+// VerifyOnly reports whether the service only verifies phone ownership,
+// without storing users
+func (c *Config) VerifyOnly() bool {
+	return c.Auth.Mode == AuthModeVerifyOnly
+}
+
+func (c *Config) GetVerifyOnlyTokenExpiry() time.Duration {
+	return time.Duration(c.Auth.VerifyOnlyTokenMinutes) * time.Minute
+}
+
 func (c *Config) GetOTPExpiry() time.Duration {
 	return time.Duration(c.OTP.ExpiryMinutes) * time.Minute
 }
 
+func (c *Config) GetPreviousCodeGrace() time.Duration {
+	return time.Duration(c.OTP.PreviousCodeGraceSeconds) * time.Second
+}
+
+func (c *Config) GetResendCooldown() time.Duration {
+	return time.Duration(c.OTP.ResendCooldownSeconds) * time.Second
+}
+
+// GetAcceptRecentCount returns how many recent pending codes a verification
+// may match, never less than 1.
+func (c *Config) GetAcceptRecentCount() int {
+	if c.OTP.AcceptRecentCount < 1 {
+		return 1
+	}
+	return c.OTP.AcceptRecentCount
+}
+
+// GetMaxOTPUses returns how many verifications one code allows, never less
+// than 1
+func (c *Config) GetMaxOTPUses() int {
+	if c.OTP.MaxUses < 1 {
+		return 1
+	}
+	return c.OTP.MaxUses
+}
+
+func (c *Config) GetReplayWindow() time.Duration {
+	return time.Duration(c.OTP.ReplayWindowMinutes) * time.Minute
+}
+
+func (c *Config) GetVerifyFailureWindow() time.Duration {
+	return time.Duration(c.Security.VerifyFailureWindowSeconds) * time.Second
+}
+
+func (c *Config) GetStepUpMaxAge() time.Duration {
+	return time.Duration(c.Security.StepUpMaxAgeMinutes) * time.Minute
+}
+
+func (c *Config) GetVerifyBackoffBase() time.Duration {
+	return time.Duration(c.Security.VerifyBackoffBaseMS) * time.Millisecond
+}
+
+func (c *Config) GetVerifyBackoffMax() time.Duration {
+	return time.Duration(c.Security.VerifyBackoffMaxMS) * time.Millisecond
+}
+
+func (c *Config) GetCaptchaTimeout() time.Duration {
+	return time.Duration(c.Captcha.TimeoutSeconds) * time.Second
+}
+
+func (c *Config) GetHealthCheckInterval() time.Duration {
+	return time.Duration(c.Database.HealthCheckIntervalSeconds) * time.Second
+}
+
+func (c *Config) GetQueryTimeout() time.Duration {
+	return time.Duration(c.Database.QueryTimeoutMS) * time.Millisecond
+}
+
+func (c *Config) GetUserCacheTTL() time.Duration {
+	return time.Duration(c.Database.UserCacheTTLSeconds) * time.Second
+}
+
+func (c *Config) GetMaintenanceRetryAfter() time.Duration {
+	return time.Duration(c.Maintenance.RetryAfterSeconds) * time.Second
+}
+
 func (c *Config) GetRateLimitWindow() time.Duration {
 	return time.Duration(c.RateLimit.WindowMinutes) * time.Minute
 }
+
+func (c *Config) IsAdmin(phoneNumber string) bool {
+	for _, adminPhone := range c.Admin.PhoneNumbers {
+		if adminPhone == phoneNumber {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) IsProduction() bool {
+	return c.Server.Environment == "production"
+}
+
+func (c *Config) UsesDefaultJWTSecret() bool {
+	return c.JWT.Secret == DefaultJWTSecret
+}
+
+// SecureJWTSecret guards against running with the placeholder JWT secret. In
+// production it returns an error; otherwise it swaps in a random secret for
+// this process and reports that it did so.
+func (c *Config) SecureJWTSecret() (bool, error) {
+	if !c.UsesDefaultJWTSecret() {
+		return false, nil
+	}
+
+	if c.IsProduction() {
+		return false, errors.New("JWT_SECRET is set to the insecure default; configure a unique secret for production")
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return false, err
+	}
+	c.JWT.Secret = hex.EncodeToString(secret)
+	return true, nil
+}
+
+// ValidateJWTSubjectClaim reports a JWT_SUBJECT_CLAIM other than user_id or
+// phone_number
+func (c *Config) ValidateJWTSubjectClaim() error {
+	switch c.JWT.SubjectClaim {
+	case "", JWTSubjectUserID, JWTSubjectPhoneNumber:
+		return nil
+	default:
+		return fmt.Errorf("JWT_SUBJECT_CLAIM must be %q or %q, got %q", JWTSubjectUserID, JWTSubjectPhoneNumber, c.JWT.SubjectClaim)
+	}
+}
+
+// ValidateAuthMode reports an AUTH_MODE other than full or verify-only, and
+// verify-only settings that are missing or need users
+func (c *Config) ValidateAuthMode() error {
+	switch c.Auth.Mode {
+	case "", AuthModeFull, AuthModeVerifyOnly:
+	default:
+		return fmt.Errorf("AUTH_MODE must be %q or %q, got %q", AuthModeFull, AuthModeVerifyOnly, c.Auth.Mode)
+	}
+	if !c.VerifyOnly() {
+		return nil
+	}
+	if c.OTP.RequireExistingUser {
+		return errors.New("OTP_REQUIRE_EXISTING_USER needs users, which AUTH_MODE=verify-only does not store")
+	}
+	// Tokens would otherwise be expired as soon as they are issued
+	if c.Auth.VerifyOnlyTokenMinutes <= 0 {
+		return fmt.Errorf("AUTH_VERIFY_ONLY_TOKEN_MINUTES must be positive, got %d", c.Auth.VerifyOnlyTokenMinutes)
+	}
+	return nil
+}
+
+// ValidateRetryAfterFormat reports a RATE_LIMIT_RETRY_AFTER_FORMAT other
+// than seconds or http-date
+func (c *Config) ValidateRetryAfterFormat() error {
+	switch c.RateLimit.RetryAfterFormat {
+	case "", RetryAfterFormatSeconds, RetryAfterFormatHTTPDate:
+		return nil
+	default:
+		return fmt.Errorf("RATE_LIMIT_RETRY_AFTER_FORMAT must be %q or %q, got %q", RetryAfterFormatSeconds, RetryAfterFormatHTTPDate, c.RateLimit.RetryAfterFormat)
+	}
+}
+
+// ValidateJSONTimeFormat reports a JSON_TIME_FORMAT other than rfc3339,
+// unix or epoch
+func (c *Config) ValidateJSONTimeFormat() error {
+	switch c.Server.JSONTimeFormat {
+	case "", JSONTimeFormatRFC3339, JSONTimeFormatUnix, JSONTimeFormatEpoch:
+		return nil
+	default:
+		return fmt.Errorf("JSON_TIME_FORMAT must be %q, %q or %q, got %q", JSONTimeFormatRFC3339, JSONTimeFormatUnix, JSONTimeFormatEpoch, c.Server.JSONTimeFormat)
+	}
+}
+
+// PhoneKeys decodes PHONE_HASH_KEY and PHONE_ENCRYPTION_KEY, which
+// HASH_PHONE_NUMBERS requires
+func (c *Config) PhoneKeys() ([]byte, []byte, error) {
+	hashKey, err := decodePhoneKey("PHONE_HASH_KEY", c.Privacy.PhoneHashKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptionKey, err := decodePhoneKey("PHONE_ENCRYPTION_KEY", c.Privacy.PhoneEncryptionKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hashKey, encryptionKey, nil
+}
+
+func decodePhoneKey(name, value string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("%s is required when HASH_PHONE_NUMBERS is enabled", name)
+	}
+	key, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be hex-encoded: %w", name, err)
+	}
+	return key, nil
+}
+
+// ValidateOTPLength reports an OTP_LENGTH that is not positive or that the
+// database could not store, so the problem surfaces at startup rather than
+// on the first generated code.
+func (c *Config) ValidateOTPLength() error {
+	if c.OTP.Length < 1 || c.OTP.Length > MaxOTPLength {
+		return fmt.Errorf("OTP_LENGTH must be between 1 and %d, got %d", MaxOTPLength, c.OTP.Length)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfig_ValidateOTPLength(t *testing.T) {
+	for _, length := range []int{1, 6, MaxOTPLength} {
+		cfg := &Config{OTP: OTPConfig{Length: length}}
+		if err := cfg.ValidateOTPLength(); err != nil {
+			t.Errorf("Expected length %d to be accepted, got %v", length, err)
+		}
+	}
+	for _, length := range []int{0, -1, MaxOTPLength + 1} {
+		cfg := &Config{OTP: OTPConfig{Length: length}}
+		if err := cfg.ValidateOTPLength(); err == nil {
+			t.Errorf("Expected length %d to be rejected", length)
+		}
+	}
+}
+
+func TestConfig_ValidateAuthMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    AuthConfig
+		wantErr bool
+	}{
+		{"full", AuthConfig{Mode: AuthModeFull}, false},
+		{"full ignores token minutes", AuthConfig{Mode: AuthModeFull, VerifyOnlyTokenMinutes: 0}, false},
+		{"verify-only", AuthConfig{Mode: AuthModeVerifyOnly, VerifyOnlyTokenMinutes: 5}, false},
+		{"verify-only without token lifetime", AuthConfig{Mode: AuthModeVerifyOnly, VerifyOnlyTokenMinutes: 0}, true},
+		{"verify-only with negative token lifetime", AuthConfig{Mode: AuthModeVerifyOnly, VerifyOnlyTokenMinutes: -5}, true},
+		{"unknown mode", AuthConfig{Mode: "partial"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Auth: tt.auth}
+			if err := cfg.ValidateAuthMode(); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateJSONTimeFormat(t *testing.T) {
+	for _, format := range []string{"", JSONTimeFormatRFC3339, JSONTimeFormatUnix, JSONTimeFormatEpoch} {
+		cfg := &Config{Server: ServerConfig{JSONTimeFormat: format}}
+		if err := cfg.ValidateJSONTimeFormat(); err != nil {
+			t.Errorf("Expected %q to be accepted, got %v", format, err)
+		}
+	}
+	for _, format := range []string{"iso8601", "seconds"} {
+		cfg := &Config{Server: ServerConfig{JSONTimeFormat: format}}
+		if err := cfg.ValidateJSONTimeFormat(); err == nil {
+			t.Errorf("Expected %q to be rejected", format)
+		}
+	}
+}
+
+func TestConfig_SecureJWTSecret(t *testing.T) {
+	// Custom secrets are left untouched in any environment
+	cfg := &Config{
+		Server: ServerConfig{Environment: "production"},
+		JWT:    JWTConfig{Secret: "a-real-secret"},
+	}
+	replaced, err := cfg.SecureJWTSecret()
+	if err != nil || replaced {
+		t.Errorf("Expected custom secret to be accepted, got replaced=%v err=%v", replaced, err)
+	}
+	if cfg.JWT.Secret != "a-real-secret" {
+		t.Errorf("Expected secret to be unchanged, got %s", cfg.JWT.Secret)
+	}
+
+	// The default secret is refused in production
+	cfg = &Config{
+		Server: ServerConfig{Environment: "production"},
+		JWT:    JWTConfig{Secret: DefaultJWTSecret},
+	}
+	if !cfg.UsesDefaultJWTSecret() {
+		t.Error("Expected default secret to be detected")
+	}
+	if _, err := cfg.SecureJWTSecret(); err == nil {
+		t.Error("Expected error for default secret in production, got nil")
+	}
+
+	// The default secret is replaced with a random one in development
+	cfg = &Config{
+		Server: ServerConfig{Environment: "development"},
+		JWT:    JWTConfig{Secret: DefaultJWTSecret},
+	}
+	replaced, err = cfg.SecureJWTSecret()
+	if err != nil {
+		t.Fatalf("Expected no error in development, got %v", err)
+	}
+	if !replaced {
+		t.Error("Expected default secret to be replaced in development")
+	}
+	if cfg.UsesDefaultJWTSecret() || len(cfg.JWT.Secret) != 64 {
+		t.Errorf("Expected a random 64 character secret, got %q", cfg.JWT.Secret)
+	}
+}
+
+func TestLoad_JWTSecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt_secret")
+	if err := os.WriteFile(path, []byte("file-secret\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	t.Setenv("JWT_SECRET", "env-secret")
+
+	// The file takes precedence over the env var, without its trailing newline
+	t.Setenv("JWT_SECRET_FILE", path)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.JWT.Secret != "file-secret" {
+		t.Errorf("Expected secret from file, got %q", cfg.JWT.Secret)
+	}
+
+	// A missing file falls back to the env var
+	t.Setenv("JWT_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.JWT.Secret != "env-secret" {
+		t.Errorf("Expected secret from env var, got %q", cfg.JWT.Secret)
+	}
+}
+
+type staticSecretProvider map[string]string
+
+func (p staticSecretProvider) Lookup(key string) (string, bool, error) {
+	value, ok := p[key]
+	return value, ok, nil
+}
+
+func TestLoadWithSecretProviders(t *testing.T) {
+	t.Setenv("JWT_SECRET", "env-secret")
+
+	providers := append([]SecretProvider{staticSecretProvider{"JWT_SECRET": "managed-secret"}}, DefaultSecretProviders()...)
+	cfg, err := LoadWithSecretProviders(providers...)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.JWT.Secret != "managed-secret" {
+		t.Errorf("Expected secret from the first provider, got %q", cfg.JWT.Secret)
+	}
+}
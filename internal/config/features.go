@@ -0,0 +1,64 @@
+package config
+
+import (
+	"strings"
+)
+
+// Feature names
+const (
+	FeatureRegistration    = "registration"
+	FeatureAuditLog        = "audit_log"
+	FeatureUserCount       = "user_count"
+	FeatureOTPCancel       = "otp_cancel"
+	FeaturePhoneChange     = "phone_change"
+	FeatureAccountRecovery = "account_recovery"
+)
+
+type featureDefinition struct {
+	Default bool
+	// Public features are reported to unauthenticated clients
+	Public bool
+}
+
+// features lists every toggleable feature. Each can be overridden with a
+// FEATURE_<NAME> environment variable, e.g. FEATURE_REGISTRATION=false.
+var features = map[string]featureDefinition{
+	FeatureRegistration:    {Default: true, Public: true},
+	FeatureAuditLog:        {Default: true},
+	FeatureUserCount:       {Default: true},
+	FeatureOTPCancel:       {Default: true, Public: true},
+	FeaturePhoneChange:     {Default: true, Public: true},
+	FeatureAccountRecovery: {Default: true, Public: true},
+}
+
+type FeaturesConfig struct {
+	Enabled map[string]bool
+}
+
+func loadFeatures() FeaturesConfig {
+	enabled := make(map[string]bool, len(features))
+	for name, definition := range features {
+		enabled[name] = getEnvAsBool("FEATURE_"+strings.ToUpper(name), definition.Default)
+	}
+	return FeaturesConfig{Enabled: enabled}
+}
+
+// FeatureEnabled reports whether the named feature is switched on, falling
+// back to its default when it hasn't been configured.
+func (c *Config) FeatureEnabled(name string) bool {
+	if enabled, ok := c.Features.Enabled[name]; ok {
+		return enabled
+	}
+	return features[name].Default
+}
+
+// PublicFeatures returns the on/off state of every feature clients may see
+func (c *Config) PublicFeatures() map[string]bool {
+	public := make(map[string]bool)
+	for name, definition := range features {
+		if definition.Public {
+			public[name] = c.FeatureEnabled(name)
+		}
+	}
+	return public
+}
@@ -0,0 +1,33 @@
+package config
+
+import "testing"
+
+func TestConfig_FeatureEnabled(t *testing.T) {
+	// Unconfigured features fall back to their defaults
+	cfg := &Config{}
+	if !cfg.FeatureEnabled(FeatureRegistration) {
+		t.Error("Expected registration to be enabled by default")
+	}
+	if cfg.FeatureEnabled("unknown") {
+		t.Error("Expected unknown feature to be disabled")
+	}
+
+	t.Setenv("FEATURE_REGISTRATION", "false")
+	t.Setenv("FEATURE_AUDIT_LOG", "not-a-bool")
+	cfg = &Config{Features: loadFeatures()}
+
+	if cfg.FeatureEnabled(FeatureRegistration) {
+		t.Error("Expected registration to be disabled by FEATURE_REGISTRATION=false")
+	}
+	if !cfg.FeatureEnabled(FeatureAuditLog) {
+		t.Error("Expected invalid value to fall back to the default")
+	}
+
+	public := cfg.PublicFeatures()
+	if enabled, ok := public[FeatureRegistration]; !ok || enabled {
+		t.Errorf("Expected public registration=false, got %v", public)
+	}
+	if _, ok := public[FeatureAuditLog]; ok {
+		t.Error("Expected audit_log not to be public")
+	}
+}
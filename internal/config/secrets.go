@@ -0,0 +1,71 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SecretProvider looks up a secret such as the JWT signing key by its
+// environment variable name. Providers are tried in order, so one backed by a
+// secret manager can be placed ahead of the defaults.
+type SecretProvider interface {
+	// Lookup returns the secret and true, or false if this provider has no
+	// value for it and the next one should be asked
+	Lookup(key string) (string, bool, error)
+}
+
+// DefaultSecretProviders reads <KEY>_FILE before falling back to <KEY>
+func DefaultSecretProviders() []SecretProvider {
+	return []SecretProvider{FileSecretProvider{}, EnvSecretProvider{}}
+}
+
+// FileSecretProvider reads a secret from the file named by the <KEY>_FILE
+// environment variable, such as a mounted Kubernetes secret. Trailing
+// newlines are trimmed. A file that does not exist is treated as unset.
+type FileSecretProvider struct{}
+
+func (FileSecretProvider) Lookup(key string) (string, bool, error) {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return "", false, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s_FILE: %w", key, err)
+	}
+
+	secret := strings.TrimRight(string(contents), "\r\n")
+	if secret == "" {
+		return "", false, nil
+	}
+	return secret, true, nil
+}
+
+// EnvSecretProvider reads a secret directly from the <KEY> environment variable
+type EnvSecretProvider struct{}
+
+func (EnvSecretProvider) Lookup(key string) (string, bool, error) {
+	if value := os.Getenv(key); value != "" {
+		return value, true, nil
+	}
+	return "", false, nil
+}
+
+func getSecret(providers []SecretProvider, key, defaultValue string) (string, error) {
+	for _, provider := range providers {
+		secret, ok, err := provider.Lookup(key)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return secret, nil
+		}
+	}
+	return defaultValue, nil
+}
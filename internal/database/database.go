@@ -14,10 +14,31 @@ import (
 
 type Database struct {
 	DB *sql.DB
+	// Replica is the read replica connection, or nil when none is configured
+	Replica *sql.DB
+	// withoutUsers skips the users table in verify-only mode
+	withoutUsers bool
 }
 
 func NewDatabase(config *config.Config) (*Database, error) {
-	db, err := sql.Open("postgres", config.GetDatabaseURL())
+	db, err := open(config.GetDatabaseURL())
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Database{DB: db, withoutUsers: config.VerifyOnly()}
+	if config.Database.ReplicaURL != "" {
+		if d.Replica, err = open(config.Database.ReplicaURL); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("replica: %w", err)
+		}
+	}
+
+	return d, nil
+}
+
+func open(url string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -32,18 +53,31 @@ func NewDatabase(config *config.Config) (*Database, error) {
 	defer cancel()
 
 	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &Database{DB: db}, nil
+	return db, nil
+}
+
+// ReadDB returns the connection for read-heavy queries: the replica when one
+// is configured, otherwise the primary.
+func (d *Database) ReadDB() *sql.DB {
+	if d.Replica != nil {
+		return d.Replica
+	}
+	return d.DB
 }
 
 func (d *Database) Close() error {
+	if d.Replica != nil {
+		d.Replica.Close()
+	}
 	return d.DB.Close()
 }
 
 func (d *Database) Migrate() error {
-	queries := []string{
+	userQueries := []string{
 		`CREATE TABLE IF NOT EXISTS users (
 			id UUID PRIMARY KEY,
 			phone_number VARCHAR(20) UNIQUE NOT NULL,
@@ -51,18 +85,52 @@ func (d *Database) Migrate() error {
 			updated_at TIMESTAMP NOT NULL,
 			last_login_at TIMESTAMP
 		)`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS metadata JSONB`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS recovery_phone VARCHAR(20)`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'active'`,
+		// Wide enough for the hex HMAC stored when HASH_PHONE_NUMBERS is on
+		widenColumn("users", "phone_number", 64),
+		widenColumn("users", "recovery_phone", 64),
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_number_encrypted TEXT`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS recovery_phone_encrypted TEXT`,
+		`CREATE INDEX IF NOT EXISTS idx_users_phone_number ON users(phone_number)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_recovery_phone ON users(recovery_phone) WHERE recovery_phone IS NOT NULL`,
+	}
+
+	queries := []string{
 		`CREATE TABLE IF NOT EXISTS otps (
 			id SERIAL PRIMARY KEY,
 			phone_number VARCHAR(20) NOT NULL,
-			code VARCHAR(10) NOT NULL,
+			code VARCHAR(10) NOT NULL, -- keep in sync with config.MaxOTPLength
 			expires_at TIMESTAMP NOT NULL,
 			created_at TIMESTAMP NOT NULL,
 			used BOOLEAN DEFAULT FALSE
 		)`,
-		`CREATE INDEX IF NOT EXISTS idx_users_phone_number ON users(phone_number)`,
+		`ALTER TABLE otps ADD COLUMN IF NOT EXISTS request_id VARCHAR(36)`,
+		`ALTER TABLE otps ADD COLUMN IF NOT EXISTS ip VARCHAR(45)`,
+		`ALTER TABLE otps ADD COLUMN IF NOT EXISTS counts_toward_limit BOOLEAN NOT NULL DEFAULT TRUE`,
+		`ALTER TABLE otps ADD COLUMN IF NOT EXISTS uses_remaining INTEGER NOT NULL DEFAULT 1`,
+		widenColumn("otps", "phone_number", 64),
+		`CREATE TABLE IF NOT EXISTS audit_events (
+			id BIGSERIAL PRIMARY KEY,
+			actor_id VARCHAR(64) NOT NULL,
+			action VARCHAR(64) NOT NULL,
+			target VARCHAR(255) NOT NULL,
+			ip VARCHAR(45) NOT NULL,
+			metadata JSONB,
+			created_at TIMESTAMP NOT NULL,
+			prev_hash VARCHAR(64) NOT NULL,
+			hash VARCHAR(64) NOT NULL
+		)`,
 		`CREATE INDEX IF NOT EXISTS idx_otps_phone_number ON otps(phone_number)`,
 		`CREATE INDEX IF NOT EXISTS idx_otps_expires_at ON otps(expires_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_otps_created_at ON otps(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events(actor_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target)`,
+	}
+	if !d.withoutUsers {
+		queries = append(userQueries, queries...)
 	}
 
 	for _, query := range queries {
@@ -75,3 +143,17 @@ func (d *Database) Migrate() error {
 	log.Println("Database migration completed successfully")
 	return nil
 }
+
+// widenColumn returns a statement that widens a VARCHAR column to size
+// characters. It only alters the table while the column is narrower, since
+// ALTER COLUMN ... TYPE takes an ACCESS EXCLUSIVE lock even when the type is
+// unchanged.
+func widenColumn(table, column string, size int) string {
+	return fmt.Sprintf(`DO $$
+		BEGIN
+			IF (SELECT character_maximum_length FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = '%[1]s' AND column_name = '%[2]s') < %[3]d THEN
+				ALTER TABLE %[1]s ALTER COLUMN %[2]s TYPE VARCHAR(%[3]d);
+			END IF;
+		END $$`, table, column, size)
+}
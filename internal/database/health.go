@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// healthCheckTimeout bounds each primary ping so a hung connection is
+// reported as a failure instead of stalling the monitor
+const healthCheckTimeout = 2 * time.Second
+
+// PrimaryMonitor tracks whether the primary database is reachable, based on
+// periodic pings. It starts out healthy, and a nil *PrimaryMonitor is always
+// healthy.
+type PrimaryMonitor struct {
+	healthy atomic.Bool
+	ping    func(ctx context.Context) error
+}
+
+func NewPrimaryMonitor(db *sql.DB) *PrimaryMonitor {
+	m := &PrimaryMonitor{ping: db.PingContext}
+	m.healthy.Store(true)
+	return m
+}
+
+// Healthy reports the result of the latest ping
+func (m *PrimaryMonitor) Healthy() bool {
+	if m == nil {
+		return true
+	}
+	return m.healthy.Load()
+}
+
+// Check pings the primary once and records the result, logging when the
+// state changes.
+func (m *PrimaryMonitor) Check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	err := m.ping(ctx)
+	if healthy := err == nil; m.healthy.Swap(healthy) != healthy {
+		if healthy {
+			log.Println("Primary database is reachable again; leaving degraded mode")
+		} else {
+			log.Printf("WARNING: primary database is unreachable, entering degraded mode: %v", err)
+		}
+	}
+}
+
+// Run checks the primary every interval until ctx is cancelled
+func (m *PrimaryMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check(ctx)
+		}
+	}
+}
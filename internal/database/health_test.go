@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPrimaryMonitor(t *testing.T) {
+	var pingErr error
+	monitor := &PrimaryMonitor{ping: func(ctx context.Context) error { return pingErr }}
+	monitor.healthy.Store(true)
+
+	monitor.Check(context.Background())
+	if !monitor.Healthy() {
+		t.Error("Expected healthy after a successful ping")
+	}
+
+	pingErr = errors.New("connection refused")
+	monitor.Check(context.Background())
+	if monitor.Healthy() {
+		t.Error("Expected unhealthy after a failed ping")
+	}
+
+	pingErr = nil
+	monitor.Check(context.Background())
+	if !monitor.Healthy() {
+		t.Error("Expected healthy again after recovery")
+	}
+
+	var disabled *PrimaryMonitor
+	if !disabled.Healthy() {
+		t.Error("Expected a nil monitor to report healthy")
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+
+	"otp/internal/models"
+	"otp/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	auditLogger services.AuditLogger
+}
+
+func NewAuditHandler(auditLogger services.AuditLogger) *AuditHandler {
+	return &AuditHandler{
+		auditLogger: auditLogger,
+	}
+}
+
+// ListAuditEvents godoc
+// @Summary List audit events
+// @Description Retrieve recorded admin and destructive actions, newest first
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param actor_id query string false "Filter by acting user ID"
+// @Param action query string false "Filter by action (e.g. user.delete)"
+// @Param target query string false "Filter by target"
+// @Param since query string false "Only events at or after this RFC3339 time"
+// @Param until query string false "Only events before this RFC3339 time"
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Events per page (default: 10, max: 100)"
+// @Param limit query int false "Deprecated: page size when page_size is absent"
+// @Success 200 {object} models.AuditEventListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /admin/audit-events [get]
+func (h *AuditHandler) ListAuditEvents(c *gin.Context) {
+	var query models.AuditEventQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid query parameters"))
+		return
+	}
+
+	// Clients written before paging sent only limit; honor it as the page size
+	if query.PageSize == 0 {
+		query.PageSize = query.Limit
+	}
+	query.Normalize()
+
+	response, err := h.auditLogger.ListPage(c.Request.Context(), query)
+	if err != nil {
+		respondInternalError(c, err, "Failed to get audit events")
+		return
+	}
+
+	respondJSON(c, http.StatusOK, response)
+}
+
+// VerifyAuditEvents godoc
+// @Summary Verify the audit trail
+// @Description Recompute the hash chain over every audit event, oldest first, and report the first event that was modified or removed
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.AuditChainVerification
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /admin/audit-events/verify [get]
+func (h *AuditHandler) VerifyAuditEvents(c *gin.Context) {
+	verification, err := h.auditLogger.Verify(c.Request.Context())
+	if err != nil {
+		respondInternalError(c, err, "Failed to verify audit events")
+		return
+	}
+
+	respondJSON(c, http.StatusOK, verification)
+}
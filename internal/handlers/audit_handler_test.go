@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"otp/internal/models"
+	"otp/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// verifyingAuditLogger answers Verify with a fixed result
+type verifyingAuditLogger struct {
+	services.AuditLogger
+	verification *models.AuditChainVerification
+	err          error
+}
+
+func (l verifyingAuditLogger) Verify(ctx context.Context) (*models.AuditChainVerification, error) {
+	return l.verification, l.err
+}
+
+func TestVerifyAuditEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		logger      verifyingAuditLogger
+		wantStatus  int
+		wantIntact  bool
+		wantProblem string
+	}{
+		{"intact", verifyingAuditLogger{verification: &models.AuditChainVerification{Intact: true}}, http.StatusOK, true, ""},
+		{"broken", verifyingAuditLogger{verification: &models.AuditChainVerification{Problem: "audit chain is broken: event 7 was modified"}}, http.StatusOK, false, "audit chain is broken: event 7 was modified"},
+		{"check failed", verifyingAuditLogger{err: errors.New("connection refused")}, http.StatusInternalServerError, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/verify", NewAuditHandler(tt.logger).VerifyAuditEvents)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/verify", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response models.AuditChainVerification
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Expected JSON body, got %s", w.Body.String())
+			}
+			if response.Intact != tt.wantIntact || response.Problem != tt.wantProblem {
+				t.Errorf("Expected intact=%v problem=%q, got %+v", tt.wantIntact, tt.wantProblem, response)
+			}
+		})
+	}
+}
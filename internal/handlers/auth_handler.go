@@ -1,21 +1,38 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"time"
 
+	"otp/internal/captcha"
+	"otp/internal/middleware"
 	"otp/internal/models"
+	"otp/internal/ratelimit"
 	"otp/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AuthHandler struct {
-	authService services.AuthService
+	authService  services.AuthService
+	phoneTracker ratelimit.PhoneTracker
+	exemptions   *ratelimit.Exemptions
+	captcha      captcha.Verifier
+	auditLogger  services.AuditLogger
 }
 
-func NewAuthHandler(authService services.AuthService) *AuthHandler {
+// NewAuthHandler creates the auth handler. A nil captchaVerifier disables
+// CAPTCHA checks on OTP generation. Phone number changes, including those
+// made through account recovery, are recorded with auditLogger.
+func NewAuthHandler(authService services.AuthService, phoneTracker ratelimit.PhoneTracker, exemptions *ratelimit.Exemptions, captchaVerifier captcha.Verifier, auditLogger services.AuditLogger) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
+		authService:  authService,
+		phoneTracker: phoneTracker,
+		exemptions:   exemptions,
+		captcha:      captchaVerifier,
+		auditLogger:  auditLogger,
 	}
 }
 
@@ -25,29 +42,141 @@ func NewAuthHandler(authService services.AuthService) *AuthHandler {
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param request body models.OTPRequest true "Phone number"
+// @Param request body models.OTPRequest true "Phone number, and a CAPTCHA token when required"
 // @Success 200 {object} models.OTPResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse "No user has the phone number and unknown numbers are not hidden"
 // @Failure 429 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /auth/otp/generate [post]
 func (h *AuthHandler) GenerateOTP(c *gin.Context) {
 	var request models.OTPRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid request body"))
 		return
 	}
 
-	response, err := h.authService.GenerateOTP(c.Request.Context(), request.PhoneNumber)
+	if !h.allowCodeRequest(c, request.PhoneNumber, request.CaptchaToken) {
+		return
+	}
+
+	ctx := services.ContextWithClientIP(c.Request.Context(), c.ClientIP())
+	response, err := h.authService.GenerateOTP(ctx, request.PhoneNumber)
 	if err != nil {
-		if err.Error() == "rate limit exceeded. Please try again later" {
-			c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: err.Error()})
+		if errors.Is(err, services.ErrRequestCancelled) {
+			c.AbortWithStatus(StatusClientClosedRequest)
+			return
+		}
+		if errors.Is(err, services.ErrRateLimitExceeded) {
+			respondJSON(c, http.StatusTooManyRequests, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrDailyLimitExceeded) {
+			respondJSON(c, http.StatusTooManyRequests, ErrorResponse{Error: err.Error(), Code: ErrCodeDailyLimitExceeded})
+			return
+		}
+		if errors.Is(err, services.ErrResendCooldown) {
+			respondJSON(c, http.StatusTooManyRequests, ErrorResponse{Error: err.Error(), Code: ErrCodeResendCooldown})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidPhoneNumber) {
+			respondJSON(c, http.StatusBadRequest, invalidPhoneNumberResponse("phone_number"))
+			return
+		}
+		if errors.Is(err, services.ErrUserNotFound) {
+			respondJSON(c, http.StatusNotFound, ErrorResponse{Error: err.Error(), Code: ErrCodeUserNotFound})
+			return
+		}
+		respondInternalError(c, err, "Failed to generate OTP")
+		return
+	}
+
+	if response.Warning != "" {
+		c.Header("X-RateLimit-Warning", response.Warning)
+	}
+	respondJSON(c, http.StatusOK, response)
+}
+
+// allowCodeRequest runs the checks every endpoint that sends a code to
+// phoneNumber applies before asking the service for it: the CAPTCHA, when
+// enabled, and the per-IP budget of distinct phone numbers, which throttles
+// clients cycling through numbers. It writes the error response and returns
+// false if one fails.
+func (h *AuthHandler) allowCodeRequest(c *gin.Context, phoneNumber, captchaToken string) bool {
+	if h.captcha != nil && !h.verifyCaptcha(c, captchaToken) {
+		return false
+	}
+
+	exempt := h.exemptions.Exempt(c.ClientIP(), phoneNumber)
+	if !exempt && !h.phoneTracker.Allow(c.ClientIP(), phoneNumber) {
+		respondJSON(c, http.StatusTooManyRequests, ErrorResponse{
+			Error: "too many phone numbers requested from this address. Please try again later",
+			Code:  ErrCodeTooManyNumbers,
+		})
+		return false
+	}
+	return true
+}
+
+// verifyCaptcha checks the CAPTCHA token for an OTP request, writing the
+// error response and returning false if it does not pass.
+func (h *AuthHandler) verifyCaptcha(c *gin.Context, token string) bool {
+	if token == "" {
+		respondJSON(c, http.StatusBadRequest, ErrorResponse{Error: "captcha_token is required", Code: ErrCodeCaptchaRequired})
+		return false
+	}
+
+	err := h.captcha.Verify(c.Request.Context(), token, c.ClientIP())
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, captcha.ErrFailed):
+		respondJSON(c, http.StatusBadRequest, ErrorResponse{Error: captcha.ErrFailed.Error(), Code: ErrCodeCaptchaFailed})
+	default:
+		log.Printf("CAPTCHA verification error: %v", err)
+		respondInternalError(c, err, "Failed to verify CAPTCHA")
+	}
+	return false
+}
+
+// CancelOTP godoc
+// @Summary Cancel a pending OTP
+// @Description Invalidate the pending OTP for a phone number so it can no longer be verified
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.OTPRequest true "Phone number"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /auth/otp [delete]
+func (h *AuthHandler) CancelOTP(c *gin.Context) {
+	var request models.OTPRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid request body"))
+		return
+	}
+
+	// Share the per-IP phone number budget with generation so this can't be
+	// used to cancel OTPs for arbitrary numbers
+	if !h.phoneTracker.Allow(c.ClientIP(), request.PhoneNumber) {
+		respondJSON(c, http.StatusTooManyRequests, ErrorResponse{
+			Error: "too many phone numbers requested from this address. Please try again later",
+			Code:  ErrCodeTooManyNumbers,
+		})
+		return
+	}
+
+	if err := h.authService.CancelOTP(c.Request.Context(), request.PhoneNumber); err != nil {
+		if errors.Is(err, services.ErrInvalidPhoneNumber) {
+			respondJSON(c, http.StatusBadRequest, invalidPhoneNumberResponse("phone_number"))
 			return
 		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate OTP"})
+		respondInternalError(c, err, "Failed to cancel OTP")
 		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	respondJSON(c, http.StatusOK, SuccessResponse{Message: "OTP cancelled"})
 }
 
 // VerifyOTP godoc
@@ -60,29 +189,228 @@ func (h *AuthHandler) GenerateOTP(c *gin.Context) {
 // @Success 200 {object} models.AuthResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "Registration disabled or account suspended"
 // @Router /auth/otp/verify [post]
 func (h *AuthHandler) VerifyOTP(c *gin.Context) {
 	var request models.OTPVerification
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid request body"))
 		return
 	}
 
 	response, err := h.authService.VerifyOTP(c.Request.Context(), request)
 	if err != nil {
-		if err.Error() == "invalid or expired OTP" ||
-			err.Error() == "invalid OTP code" ||
-			err.Error() == "OTP has expired" {
-			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+		if errors.Is(err, services.ErrRequestCancelled) {
+			c.AbortWithStatus(StatusClientClosedRequest)
+			return
+		}
+		if code := verificationErrorCode(err); code != "" {
+			respondJSON(c, http.StatusUnauthorized, ErrorResponse{Error: err.Error(), Code: code})
+			return
+		}
+		if errors.Is(err, services.ErrRegistrationDisabled) {
+			respondJSON(c, http.StatusForbidden, ErrorResponse{Error: err.Error(), Code: ErrCodeRegistrationDisabled})
+			return
+		}
+		if errors.Is(err, services.ErrAccountSuspended) {
+			respondJSON(c, http.StatusForbidden, ErrorResponse{Error: err.Error(), Code: ErrCodeAccountSuspended})
+			return
+		}
+		if errors.Is(err, services.ErrUserNotFound) {
+			respondJSON(c, http.StatusUnauthorized, ErrorResponse{Error: err.Error(), Code: ErrCodeUserNotFound})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidPhoneNumber) {
+			respondJSON(c, http.StatusBadRequest, invalidPhoneNumberResponse("phone_number"))
 			return
 		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to verify OTP"})
+		respondInternalError(c, err, "Failed to verify OTP")
 		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	respondJSON(c, http.StatusOK, response)
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
+// RefreshClaims godoc
+// @Summary Refresh token claims
+// @Description Issue a new token carrying the user's current details without another OTP. The login time used for step-up checks is kept.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.AuthResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /auth/token/refresh-claims [post]
+func (h *AuthHandler) RefreshClaims(c *gin.Context) {
+	claims, ok := middleware.ClaimsFromContext(c)
+	if !ok {
+		respondJSON(c, http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired token"})
+		return
+	}
+
+	response, err := h.authService.RefreshClaims(c.Request.Context(), claims)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			respondJSON(c, http.StatusUnauthorized, ErrorResponse{Error: err.Error(), Code: ErrCodeUserNotFound})
+			return
+		}
+		if errors.Is(err, services.ErrAccountSuspended) {
+			respondJSON(c, http.StatusForbidden, ErrorResponse{Error: err.Error(), Code: ErrCodeAccountSuspended})
+			return
+		}
+		respondInternalError(c, err, "Failed to refresh token")
+		return
+	}
+
+	respondJSON(c, http.StatusOK, response)
+}
+
+// TokenInfo godoc
+// @Summary Describe the current token
+// @Description Return who the bearer token was issued to, when it was issued and how many seconds it has left, so clients can refresh it before it expires
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.TokenInfo
+// @Failure 401 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /auth/token/info [get]
+func (h *AuthHandler) TokenInfo(c *gin.Context) {
+	claims, ok := middleware.ClaimsFromContext(c)
+	if !ok {
+		respondJSON(c, http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired token"})
+		return
+	}
+
+	respondJSON(c, http.StatusOK, claims.Info(time.Now()))
+}
+
+// RequestPhoneChange godoc
+// @Summary Request a phone number change
+// @Description Send an OTP to the new phone number to prove control of it before it replaces the current one
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.PhoneChangeRequest true "New phone number"
+// @Success 200 {object} models.OTPResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /auth/phone/change-request [post]
+func (h *AuthHandler) RequestPhoneChange(c *gin.Context) {
+	var request models.PhoneChangeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid request body"))
+		return
+	}
+	if !h.allowCodeRequest(c, request.NewPhoneNumber, request.CaptchaToken) {
+		return
+	}
+
+	ctx := services.ContextWithClientIP(c.Request.Context(), c.ClientIP())
+	response, err := h.authService.RequestPhoneChange(ctx, middleware.UserIDFromContext(c), request)
+	if err != nil {
+		if h.respondPhoneChangeError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrRateLimitExceeded) {
+			respondJSON(c, http.StatusTooManyRequests, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrDailyLimitExceeded) {
+			respondJSON(c, http.StatusTooManyRequests, ErrorResponse{Error: err.Error(), Code: ErrCodeDailyLimitExceeded})
+			return
+		}
+		if errors.Is(err, services.ErrResendCooldown) {
+			respondJSON(c, http.StatusTooManyRequests, ErrorResponse{Error: err.Error(), Code: ErrCodeResendCooldown})
+			return
+		}
+		respondInternalError(c, err, "Failed to request phone change")
+		return
+	}
+
+	respondJSON(c, http.StatusOK, response)
+}
+
+// ConfirmPhoneChange godoc
+// @Summary Confirm a phone number change
+// @Description Verify the OTP sent to the new phone number and move the account to it
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.PhoneChangeConfirmation true "New phone number and OTP"
+// @Success 200 {object} models.AuthResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /auth/phone/change-confirm [post]
+func (h *AuthHandler) ConfirmPhoneChange(c *gin.Context) {
+	var request models.PhoneChangeConfirmation
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid request body"))
+		return
+	}
+
+	userID := middleware.UserIDFromContext(c)
+	ctx := services.ContextWithClientIP(c.Request.Context(), c.ClientIP())
+	response, err := h.authService.ConfirmPhoneChange(ctx, userID, request)
+	if err != nil {
+		if h.respondPhoneChangeError(c, err) {
+			return
+		}
+		if code := verificationErrorCode(err); code != "" {
+			respondJSON(c, http.StatusUnauthorized, ErrorResponse{Error: err.Error(), Code: code})
+			return
+		}
+		respondInternalError(c, err, "Failed to change phone number")
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"old_phone_number": models.MaskPhone(middleware.PhoneNumberFromContext(c)),
+		"new_phone_number": models.MaskPhone(request.NewPhoneNumber),
+	}
+	if err := h.auditLogger.Record(ctx, userID, services.AuditActionUserPhoneChange, userID, metadata); err != nil {
+		log.Printf("Failed to record audit event for phone change of user %s: %v", userID, err)
+	}
+
+	respondJSON(c, http.StatusOK, response)
+}
+
+// respondPhoneChangeError writes the response for errors shared by both
+// phone change steps, reporting whether it handled err.
+func (h *AuthHandler) respondPhoneChangeError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		respondJSON(c, http.StatusNotFound, ErrorResponse{Error: "User not found"})
+	case errors.Is(err, services.ErrSamePhoneNumber):
+		respondJSON(c, http.StatusBadRequest, ErrorResponse{Error: err.Error(), Code: ErrCodeSamePhoneNumber})
+	case errors.Is(err, services.ErrPhoneNumberTaken):
+		respondJSON(c, http.StatusConflict, ErrorResponse{Error: err.Error(), Code: ErrCodePhoneNumberTaken})
+	case errors.Is(err, services.ErrInvalidNewPhoneNumber):
+		respondJSON(c, http.StatusBadRequest, invalidPhoneNumberResponse("new_phone_number"))
+	case errors.Is(err, services.ErrRequestCancelled):
+		c.AbortWithStatus(StatusClientClosedRequest)
+	default:
+		return false
+	}
+	return true
+}
+
+// verificationErrorCode maps OTP verification failures to response codes
+func verificationErrorCode(err error) string {
+	switch {
+	case errors.Is(err, services.ErrOTPNotFound):
+		return ErrCodeOTPNotFound
+	case errors.Is(err, services.ErrOTPExpired):
+		return ErrCodeOTPExpired
+	case errors.Is(err, services.ErrOTPWrongCode):
+		return ErrCodeOTPWrongCode
+	case errors.Is(err, services.ErrOTPAlreadyUsed):
+		return ErrCodeOTPAlreadyUsed
+	default:
+		return ""
+	}
 }
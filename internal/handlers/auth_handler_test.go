@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"otp/internal/captcha"
+	"otp/internal/middleware"
+	"otp/internal/models"
+	"otp/internal/ratelimit"
+	"otp/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type stubCaptchaVerifier struct {
+	err error
+}
+
+func (v stubCaptchaVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	return v.err
+}
+
+func TestGenerateOTPCaptcha(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		body       string
+		verifyErr  error
+		wantStatus int
+		wantCode   string
+	}{
+		{"missing token", `{"phone_number":"+1234567890"}`, nil, http.StatusBadRequest, ErrCodeCaptchaRequired},
+		{"rejected token", `{"phone_number":"+1234567890","captcha_token":"bad"}`, fmt.Errorf("%w: invalid-input-response", captcha.ErrFailed), http.StatusBadRequest, ErrCodeCaptchaFailed},
+		{"provider unavailable", `{"phone_number":"+1234567890","captcha_token":"token"}`, captcha.ErrUnavailable, http.StatusServiceUnavailable, ErrCodeCaptchaUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(nil, nil, nil, stubCaptchaVerifier{err: tt.verifyErr}, nil)
+			router := gin.New()
+			router.POST("/generate", handler.GenerateOTP)
+
+			req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Expected JSON body, got %s", w.Body.String())
+			}
+			if response.Code != tt.wantCode {
+				t.Errorf("Expected code %q, got %q", tt.wantCode, response.Code)
+			}
+		})
+	}
+}
+
+type denyingPhoneTracker struct{}
+
+func (denyingPhoneTracker) Allow(ip, phoneNumber string) bool {
+	return false
+}
+
+func TestCodeSendingEndpointsShareAbuseChecks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	endpoints := []struct {
+		name    string
+		handler func(*AuthHandler) gin.HandlerFunc
+		body    string
+	}{
+		{"generate", func(h *AuthHandler) gin.HandlerFunc { return h.GenerateOTP }, `{"phone_number":"+1234567890"}`},
+		{"phone change", func(h *AuthHandler) gin.HandlerFunc { return h.RequestPhoneChange }, `{"new_phone_number":"+1234567890"}`},
+		{"recovery phone", func(h *AuthHandler) gin.HandlerFunc { return h.RequestRecoveryPhone }, `{"recovery_phone":"+1234567890"}`},
+		{"account recovery", func(h *AuthHandler) gin.HandlerFunc { return h.RequestAccountRecovery }, `{"recovery_phone":"+1234567890"}`},
+		{"recovery to a new number", func(h *AuthHandler) gin.HandlerFunc { return h.RecoverAccount }, `{"recovery_phone":"+1987654321","new_phone_number":"+1234567890","code":"123456"}`},
+	}
+
+	send := func(handler gin.HandlerFunc, body string) (int, string) {
+		router := gin.New()
+		router.POST("/", handler)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Code
+	}
+
+	for _, endpoint := range endpoints {
+		t.Run(endpoint.name, func(t *testing.T) {
+			withCaptcha := NewAuthHandler(nil, nil, nil, stubCaptchaVerifier{}, nil)
+			if status, code := send(endpoint.handler(withCaptcha), endpoint.body); status != http.StatusBadRequest || code != ErrCodeCaptchaRequired {
+				t.Errorf("Expected 400 %s without a CAPTCHA token, got %d %q", ErrCodeCaptchaRequired, status, code)
+			}
+
+			// Every endpoint fails closed the same way when the provider is down
+			unavailable := NewAuthHandler(nil, nil, nil, stubCaptchaVerifier{err: captcha.ErrUnavailable}, nil)
+			withToken := strings.TrimSuffix(endpoint.body, "}") + `,"captcha_token":"token"}`
+			if status, code := send(endpoint.handler(unavailable), withToken); status != http.StatusServiceUnavailable || code != ErrCodeCaptchaUnavailable {
+				t.Errorf("Expected 503 %s while the provider is unavailable, got %d %q", ErrCodeCaptchaUnavailable, status, code)
+			}
+
+			withTracker := NewAuthHandler(nil, denyingPhoneTracker{}, nil, nil, nil)
+			if status, code := send(endpoint.handler(withTracker), endpoint.body); status != http.StatusTooManyRequests || code != ErrCodeTooManyNumbers {
+				t.Errorf("Expected 429 %s past the per-IP number budget, got %d %q", ErrCodeTooManyNumbers, status, code)
+			}
+		})
+	}
+}
+
+// rateLimitedAuthService refuses every code request with
+// services.ErrRateLimitExceeded; its other methods are not implemented
+type rateLimitedAuthService struct {
+	services.AuthService
+}
+
+func (rateLimitedAuthService) GenerateOTP(ctx context.Context, phoneNumber string) (*models.OTPResponse, error) {
+	return nil, services.ErrRateLimitExceeded
+}
+
+func (rateLimitedAuthService) RequestPhoneChange(ctx context.Context, userID string, request models.PhoneChangeRequest) (*models.OTPResponse, error) {
+	return nil, services.ErrRateLimitExceeded
+}
+
+func (rateLimitedAuthService) RequestRecoveryPhone(ctx context.Context, userID string, request models.RecoveryPhoneRequest) (*models.OTPResponse, error) {
+	return nil, services.ErrRateLimitExceeded
+}
+
+func (rateLimitedAuthService) RequestAccountRecovery(ctx context.Context, request models.RecoveryPhoneRequest) (*models.OTPResponse, error) {
+	return nil, services.ErrRateLimitExceeded
+}
+
+func TestCodeRequestRateLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewAuthHandler(rateLimitedAuthService{}, ratelimit.NewMemoryPhoneTracker(5, time.Minute), nil, nil, nil)
+	endpoints := []struct {
+		name    string
+		handler gin.HandlerFunc
+		body    string
+	}{
+		{"generate", handler.GenerateOTP, `{"phone_number":"+1234567890"}`},
+		{"phone change", handler.RequestPhoneChange, `{"new_phone_number":"+1234567890"}`},
+		{"recovery phone", handler.RequestRecoveryPhone, `{"recovery_phone":"+1234567890"}`},
+		{"account recovery", handler.RequestAccountRecovery, `{"recovery_phone":"+1234567890"}`},
+	}
+
+	for _, endpoint := range endpoints {
+		t.Run(endpoint.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/", endpoint.handler)
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(endpoint.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusTooManyRequests {
+				t.Errorf("Expected status 429, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// unreadablePhoneAuthService cannot read the phone numbers it is given in
+// the default region
+type unreadablePhoneAuthService struct {
+	services.AuthService
+}
+
+func (unreadablePhoneAuthService) RequestPhoneChange(ctx context.Context, userID string, request models.PhoneChangeRequest) (*models.OTPResponse, error) {
+	return nil, services.ErrInvalidNewPhoneNumber
+}
+
+func (unreadablePhoneAuthService) RequestRecoveryPhone(ctx context.Context, userID string, request models.RecoveryPhoneRequest) (*models.OTPResponse, error) {
+	return nil, services.ErrInvalidPhoneNumber
+}
+
+func TestUnreadablePhoneNumberNamesField(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewAuthHandler(unreadablePhoneAuthService{}, ratelimit.NewMemoryPhoneTracker(5, time.Minute), nil, nil, nil)
+	endpoints := []struct {
+		name      string
+		handler   gin.HandlerFunc
+		body      string
+		wantField string
+	}{
+		{"phone change", handler.RequestPhoneChange, `{"new_phone_number":"020 7946 0000"}`, "new_phone_number"},
+		{"recovery phone", handler.RequestRecoveryPhone, `{"recovery_phone":"020 7946 0000"}`, "recovery_phone"},
+	}
+
+	for _, endpoint := range endpoints {
+		t.Run(endpoint.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/", endpoint.handler)
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(endpoint.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+			}
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Expected JSON body, got %s", w.Body.String())
+			}
+			if response.Code != ErrCodeValidation || len(response.Fields) != 1 || response.Fields[0].Field != endpoint.wantField {
+				t.Errorf("Expected %s on %s, got %+v", ErrCodeValidation, endpoint.wantField, response)
+			}
+		})
+	}
+}
+
+// stubAuthService fails VerifyOTP and RefreshClaims with err; its other
+// methods are not implemented
+type stubAuthService struct {
+	services.AuthService
+	err error
+}
+
+func (s stubAuthService) VerifyOTP(ctx context.Context, verification models.OTPVerification) (*models.AuthResponse, error) {
+	return nil, s.err
+}
+
+func (s stubAuthService) RefreshClaims(ctx context.Context, claims *models.Claims) (*models.AuthResponse, error) {
+	return nil, s.err
+}
+
+func TestSuspendedAccountIsForbidden(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewAuthHandler(stubAuthService{err: services.ErrAccountSuspended}, nil, nil, nil, nil)
+	router := gin.New()
+	router.POST("/verify", handler.VerifyOTP)
+	router.POST("/refresh", func(c *gin.Context) {
+		middleware.SetClaims(c, &models.Claims{UserID: "user-1", PhoneNumber: "+1234567890"})
+		handler.RefreshClaims(c)
+	})
+
+	for _, path := range []string{"/verify", "/refresh"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"phone_number":"+1234567890","code":"123456"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected status 403, got %d: %s", path, w.Code, w.Body.String())
+		}
+		var response ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: expected JSON body, got %s", path, w.Body.String())
+		}
+		if response.Code != ErrCodeAccountSuspended || response.Message == "" {
+			t.Errorf("%s: expected code %s with a message, got %+v", path, ErrCodeAccountSuspended, response)
+		}
+	}
+}
+
+func TestTokenInfo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	issuedAt := time.Now().Add(-time.Hour)
+	claims := &models.Claims{
+		UserID:      "user-1",
+		PhoneNumber: "+1234567890",
+		Iat:         issuedAt.Unix(),
+		Exp:         time.Now().Add(30 * time.Minute).Unix(),
+	}
+
+	handler := NewAuthHandler(nil, nil, nil, nil, nil)
+	router := gin.New()
+	router.GET("/token/info", func(c *gin.Context) { middleware.SetClaims(c, claims) }, handler.TokenInfo)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/token/info", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var info models.TokenInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Expected JSON body, got %s", w.Body.String())
+	}
+	if info.SecondsRemaining < 30*60-1 || info.SecondsRemaining > 30*60 {
+		t.Errorf("Expected about 1800 seconds remaining, got %d", info.SecondsRemaining)
+	}
+	if info.UserID != "user-1" || info.IssuedAt == nil || info.IssuedAt.Unix() != issuedAt.Unix() {
+		t.Errorf("Expected user-1 issued at %v, got %+v", issuedAt, info)
+	}
+}
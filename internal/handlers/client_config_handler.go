@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"otp/internal/config"
+	"otp/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ClientConfigHandler struct {
+	authService services.AuthService
+	config      *config.Config
+}
+
+func NewClientConfigHandler(authService services.AuthService, config *config.Config) *ClientConfigHandler {
+	return &ClientConfigHandler{
+		authService: authService,
+		config:      config,
+	}
+}
+
+// ClientConfigResponse holds the settings clients need to drive the OTP UI.
+// Only add values here that are safe to publish.
+type ClientConfigResponse struct {
+	OTPLength        int `json:"otp_length"`
+	OTPExpiryMinutes int `json:"otp_expiry_minutes"`
+	// ResendCooldownSeconds is the minimum wait between OTP requests for the
+	// same phone number, or when the request names a phone number, how long
+	// that number has left to wait. 0 means a code can be requested now.
+	ResendCooldownSeconds int                     `json:"resend_cooldown_seconds"`
+	RateLimit             ClientRateLimitResponse `json:"rate_limit"`
+	// Captcha is set when OTP generation requires a CAPTCHA token
+	Captcha    *ClientCaptchaResponse `json:"captcha,omitempty"`
+	ServerTime time.Time              `json:"server_time"`
+}
+
+type ClientCaptchaResponse struct {
+	Provider string `json:"provider"`
+	SiteKey  string `json:"site_key"`
+}
+
+type ClientRateLimitResponse struct {
+	MaxRequests   int `json:"max_requests"`
+	WindowMinutes int `json:"window_minutes"`
+	// MaxPerDay is 0 when no daily cap is enforced
+	MaxPerDay int `json:"max_per_day"`
+}
+
+// GetClientConfig godoc
+// @Summary Get public OTP settings
+// @Description Report OTP length, expiry and rate limits, plus the server time for clock sync, so clients can render accurate countdowns. Given a phone number, resend_cooldown_seconds is the time left before that number can request another OTP.
+// @Tags auth
+// @Produce json
+// @Param phone_number query string false "Phone number to report the remaining resend cooldown for"
+// @Success 200 {object} ClientConfigResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /auth/config [get]
+func (h *ClientConfigHandler) GetClientConfig(c *gin.Context) {
+	cooldown := h.config.GetResendCooldown()
+	if phoneNumber := phoneNumberQuery(c, "phone_number"); phoneNumber != "" {
+		var err error
+		cooldown, err = h.authService.ResendCooldown(c.Request.Context(), phoneNumber)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidPhoneNumber) {
+				respondJSON(c, http.StatusBadRequest, invalidPhoneNumberResponse("phone_number"))
+				return
+			}
+			respondInternalError(c, err, "Failed to get resend cooldown")
+			return
+		}
+	}
+
+	var clientCaptcha *ClientCaptchaResponse
+	if h.config.Captcha.Provider != "" {
+		clientCaptcha = &ClientCaptchaResponse{
+			Provider: h.config.Captcha.Provider,
+			SiteKey:  h.config.Captcha.SiteKey,
+		}
+	}
+
+	respondJSON(c, http.StatusOK, ClientConfigResponse{
+		OTPLength:        h.config.OTP.Length,
+		OTPExpiryMinutes: h.config.OTP.ExpiryMinutes,
+		// Round up so a client never retries a moment too early
+		ResendCooldownSeconds: int(math.Ceil(cooldown.Seconds())),
+		RateLimit: ClientRateLimitResponse{
+			MaxRequests:   h.config.RateLimit.MaxRequests,
+			WindowMinutes: h.config.RateLimit.WindowMinutes,
+			MaxPerDay:     h.config.RateLimit.MaxPerDay,
+		},
+		Captcha:    clientCaptcha,
+		ServerTime: time.Now().UTC(),
+	})
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"otp/internal/config"
+	"otp/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cooldownAuthService reports a fixed resend cooldown for one phone number
+type cooldownAuthService struct {
+	services.AuthService
+	phoneNumber string
+	cooldown    time.Duration
+}
+
+func (s cooldownAuthService) ResendCooldown(ctx context.Context, phoneNumber string) (time.Duration, error) {
+	if phoneNumber != s.phoneNumber {
+		return 0, services.ErrInvalidPhoneNumber
+	}
+	return s.cooldown, nil
+}
+
+func TestGetClientConfig_ResendCooldown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{OTP: config.OTPConfig{Length: 6, ExpiryMinutes: 2, ResendCooldownSeconds: 60}}
+	authService := cooldownAuthService{phoneNumber: "+14155552671", cooldown: 41500 * time.Millisecond}
+	router := gin.New()
+	router.GET("/config", NewClientConfigHandler(authService, cfg).GetClientConfig)
+
+	tests := []struct {
+		name         string
+		query        string
+		wantStatus   int
+		wantCooldown int
+	}{
+		{"configured cooldown", "", http.StatusOK, 60},
+		{"time left for a number", "?phone_number=%2B14155552671", http.StatusOK, 42},
+		{"unencoded plus", "?phone_number=+14155552671", http.StatusOK, 42},
+		{"invalid number", "?phone_number=nope", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/config"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var response ClientConfigResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Expected JSON body, got %s", w.Body.String())
+			}
+			if response.ResendCooldownSeconds != tt.wantCooldown {
+				t.Errorf("Expected resend_cooldown_seconds %d, got %d", tt.wantCooldown, response.ResendCooldownSeconds)
+			}
+		})
+	}
+}
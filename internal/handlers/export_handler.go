@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"otp/internal/middleware"
+	"otp/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ExportHandler struct {
+	exporter    services.DataExporter
+	auditLogger services.AuditLogger
+}
+
+func NewExportHandler(exporter services.DataExporter, auditLogger services.AuditLogger) *ExportHandler {
+	return &ExportHandler{
+		exporter:    exporter,
+		auditLogger: auditLogger,
+	}
+}
+
+// ExportUser godoc
+// @Summary Export a user's data
+// @Description Return everything stored about a user, for data-subject access requests: the profile, OTP history without codes, and audit events the user performed or was the target of. Each export is recorded in the audit log.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.UserDataExport
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /admin/users/{id}/export [get]
+func (h *ExportHandler) ExportUser(c *gin.Context) {
+	userID := c.Param("id")
+	ctx := services.ContextWithClientIP(c.Request.Context(), c.ClientIP())
+
+	export, err := h.exporter.ExportUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			respondJSON(c, http.StatusNotFound, ErrorResponse{Error: "User not found"})
+			return
+		}
+		respondInternalError(c, err, "Failed to export user data")
+		return
+	}
+
+	if err := h.auditLogger.Record(ctx, middleware.UserIDFromContext(c), services.AuditActionUserExport, userID, nil); err != nil {
+		log.Printf("Failed to record audit event for export of user %s: %v", userID, err)
+	}
+
+	respondJSON(c, http.StatusOK, export)
+}
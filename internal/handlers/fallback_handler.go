@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NotFound responds to requests that match no route
+func NotFound(c *gin.Context) {
+	respondJSON(c, http.StatusNotFound, ErrorResponse{Error: "Not found", Code: ErrCodeNotFound})
+}
+
+// MethodNotAllowed responds to requests whose path exists under a different
+// method, listing the permitted methods in the Allow header. routes is
+// typically the engine's Routes method.
+func MethodNotAllowed(routes func() gin.RoutesInfo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var allowed []string
+		seen := make(map[string]bool)
+		for _, route := range routes() {
+			if !seen[route.Method] && routeMatches(route.Path, c.Request.URL.Path) {
+				seen[route.Method] = true
+				allowed = append(allowed, route.Method)
+			}
+		}
+		sort.Strings(allowed)
+
+		c.Header("Allow", strings.Join(allowed, ", "))
+		respondJSON(c, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: ErrCodeMethodNotAllowed})
+	}
+}
+
+// routeMatches reports whether path matches a gin route pattern, where
+// ":name" matches one segment and "*name" matches the remainder.
+func routeMatches(pattern, path string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "*") {
+			return true
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		if strings.HasPrefix(segment, ":") {
+			if pathSegments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return len(patternSegments) == len(pathSegments)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFallbackHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(NotFound)
+	router.NoMethod(MethodNotAllowed(router.Routes))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/users/:id", ok)
+	router.DELETE("/users/:id", ok)
+	router.GET("/users/count", ok)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedCode   string
+		expectedAllow  string
+	}{
+		{"wrong method", http.MethodPost, "/users/123", http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "DELETE, GET"},
+		{"unknown path", http.MethodGet, "/nope", http.StatusNotFound, ErrCodeNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Expected JSON body, got %q", w.Body.String())
+			}
+			if response.Code != tt.expectedCode {
+				t.Errorf("Expected code %s, got %s", tt.expectedCode, response.Code)
+			}
+			if got := w.Header().Get("Allow"); got != tt.expectedAllow {
+				t.Errorf("Expected Allow %q, got %q", tt.expectedAllow, got)
+			}
+		})
+	}
+}
+
+func TestRouteMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/users/:id", "/users/123", true},
+		{"/users/:id", "/users", false},
+		{"/users/:id", "/users/123/extra", false},
+		{"/users/count", "/users/count", true},
+		{"/swagger/*any", "/swagger/index.html", true},
+		{"/api/v1/auth/otp", "/api/v1/auth/otp/", true},
+	}
+
+	for _, tt := range tests {
+		if got := routeMatches(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("routeMatches(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"otp/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FeatureHandler struct {
+	config *config.Config
+}
+
+func NewFeatureHandler(config *config.Config) *FeatureHandler {
+	return &FeatureHandler{
+		config: config,
+	}
+}
+
+type FeaturesResponse struct {
+	Features map[string]bool `json:"features"`
+}
+
+// ListFeatures godoc
+// @Summary List public feature flags
+// @Description Report which client-visible features are enabled so clients can adapt their UI
+// @Tags features
+// @Produce json
+// @Success 200 {object} FeaturesResponse
+// @Router /features [get]
+func (h *FeatureHandler) ListFeatures(c *gin.Context) {
+	respondJSON(c, http.StatusOK, FeaturesResponse{Features: h.config.PublicFeatures()})
+}
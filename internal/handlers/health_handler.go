@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"otp/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthCheck reports that the service is up, with status "degraded" while
+// the primary database is unreachable and only reads are served
+func HealthCheck(primary middleware.HealthChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := "ok"
+		if !primary.Healthy() {
+			status = "degraded"
+		}
+		respondJSON(c, http.StatusOK, gin.H{"status": status, "timestamp": time.Now()})
+	}
+}
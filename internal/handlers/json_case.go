@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// opaqueJSONFields hold caller-defined keys that are copied verbatim when
+// renaming fields, since they are data rather than part of the API schema.
+var opaqueJSONFields = map[string]bool{
+	"metadata": true,
+	"features": true,
+}
+
+// timeJSONFields are the timestamp fields not named *_at
+var timeJSONFields = map[string]bool{
+	"server_time": true,
+}
+
+// jsonRewrite selects how rewriteJSON changes a response body
+type jsonRewrite struct {
+	// camelCase renames object keys from snake_case to camelCase
+	camelCase bool
+	// epochTimes replaces RFC 3339 timestamps with Unix seconds
+	epochTimes bool
+}
+
+// camelCaseJSON rewrites the object keys of a JSON document from snake_case
+// to camelCase, keeping key order and leaving values untouched.
+func camelCaseJSON(data []byte) ([]byte, error) {
+	return rewriteJSON(data, jsonRewrite{camelCase: true})
+}
+
+// rewriteJSON applies rewrite to a JSON document, keeping key order.
+// Timestamps are recognized by field name: *_at and timeJSONFields.
+func rewriteJSON(data []byte, rewrite jsonRewrite) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var out bytes.Buffer
+	if err := rewriteJSONValue(decoder, &out, rewrite); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func rewriteJSONValue(decoder *json.Decoder, out *bytes.Buffer, rewrite jsonRewrite) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		out.WriteByte('{')
+		for i := 0; decoder.More(); i++ {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := keyToken.(string)
+			name := key
+			if rewrite.camelCase {
+				name = snakeToCamel(key)
+			}
+			encodedKey, err := json.Marshal(name)
+			if err != nil {
+				return err
+			}
+			out.Write(encodedKey)
+			out.WriteByte(':')
+
+			if opaqueJSONFields[key] {
+				var raw json.RawMessage
+				if err := decoder.Decode(&raw); err != nil {
+					return err
+				}
+				out.Write(raw)
+				continue
+			}
+			if rewrite.epochTimes && (strings.HasSuffix(key, "_at") || timeJSONFields[key]) {
+				if err := rewriteJSONTime(decoder, out); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := rewriteJSONValue(decoder, out, rewrite); err != nil {
+				return err
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		out.WriteByte('}')
+	case json.Delim('['):
+		out.WriteByte('[')
+		for i := 0; decoder.More(); i++ {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if err := rewriteJSONValue(decoder, out, rewrite); err != nil {
+				return err
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		out.WriteByte(']')
+	default:
+		encoded, err := json.Marshal(token)
+		if err != nil {
+			return err
+		}
+		out.Write(encoded)
+	}
+	return nil
+}
+
+// rewriteJSONTime copies the next value, writing it as Unix seconds if it is
+// an RFC 3339 timestamp
+func rewriteJSONTime(decoder *json.Decoder, out *bytes.Buffer) error {
+	var raw json.RawMessage
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+	var timestamp time.Time
+	if err := json.Unmarshal(raw, &timestamp); err != nil || bytes.Equal(raw, []byte("null")) {
+		out.Write(raw)
+		return nil
+	}
+	out.WriteString(strconv.FormatInt(timestamp.Unix(), 10))
+	return nil
+}
+
+// snakeToCamel converts a snake_case name such as expires_in_minutes to
+// expiresInMinutes
+func snakeToCamel(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"otp/internal/middleware"
+	"otp/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondJSONFieldCase(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := models.UserResponse{
+		ID:          "user-1",
+		PhoneNumber: "+1234567890",
+		CreatedAt:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Metadata:    models.Metadata{"plan_tier": "pro"},
+		Status:      models.UserStatusActive,
+	}
+
+	tests := []struct {
+		name        string
+		defaultCase string
+		accept      string
+		want        string
+	}{
+		{
+			name:        "snake by default",
+			defaultCase: middleware.JSONCaseSnake,
+			want:        `{"id":"user-1","phone_number":"+1234567890","created_at":"2024-01-01T00:00:00Z","metadata":{"plan_tier":"pro"},"status":"active"}`,
+		},
+		{
+			name:        "camel profile",
+			defaultCase: middleware.JSONCaseSnake,
+			accept:      `application/json; profile="camelCase"`,
+			want:        `{"id":"user-1","phoneNumber":"+1234567890","createdAt":"2024-01-01T00:00:00Z","metadata":{"plan_tier":"pro"},"status":"active"}`,
+		},
+		{
+			name:        "camel default",
+			defaultCase: middleware.JSONCaseCamel,
+			accept:      "application/json",
+			want:        `{"id":"user-1","phoneNumber":"+1234567890","createdAt":"2024-01-01T00:00:00Z","metadata":{"plan_tier":"pro"},"status":"active"}`,
+		},
+		{
+			name:        "snake profile overrides camel default",
+			defaultCase: middleware.JSONCaseCamel,
+			accept:      "application/json;profile=snake_case",
+			want:        `{"id":"user-1","phone_number":"+1234567890","created_at":"2024-01-01T00:00:00Z","metadata":{"plan_tier":"pro"},"status":"active"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", middleware.JSONCaseMiddleware(tt.defaultCase), func(c *gin.Context) {
+				respondJSON(c, http.StatusOK, user)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Body.String() != tt.want {
+				t.Errorf("Expected body\n%s\ngot\n%s", tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCamelCaseJSONNested(t *testing.T) {
+	input := `{"users":[{"last_login_at":null,"page_size":20}],"total_pages":1.5}`
+	want := `{"users":[{"lastLoginAt":null,"pageSize":20}],"totalPages":1.5}`
+
+	got, err := camelCaseJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestRespondJSONTimeFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	lastLogin := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	user := models.UserResponse{
+		ID:          "user-1",
+		PhoneNumber: "+1234567890",
+		CreatedAt:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		LastLoginAt: &lastLogin,
+		Metadata:    models.Metadata{"signed_up_at": "2023-12-31T00:00:00Z"},
+		Status:      models.UserStatusActive,
+	}
+
+	tests := []struct {
+		name          string
+		defaultFormat string
+		accept        string
+		want          string
+	}{
+		{
+			name:          "rfc3339 by default",
+			defaultFormat: middleware.JSONTimeRFC3339,
+			want:          `{"id":"user-1","phone_number":"+1234567890","created_at":"2024-01-01T00:00:00Z","last_login_at":"2024-01-02T03:04:05Z","metadata":{"signed_up_at":"2023-12-31T00:00:00Z"},"status":"active"}`,
+		},
+		{
+			name:          "epoch profile",
+			defaultFormat: middleware.JSONTimeRFC3339,
+			accept:        `application/json; profile="epoch"`,
+			want:          `{"id":"user-1","phone_number":"+1234567890","created_at":1704067200,"last_login_at":1704164645,"metadata":{"signed_up_at":"2023-12-31T00:00:00Z"},"status":"active"}`,
+		},
+		{
+			name:          "unix default",
+			defaultFormat: middleware.JSONTimeUnix,
+			want:          `{"id":"user-1","phone_number":"+1234567890","created_at":1704067200,"last_login_at":1704164645,"metadata":{"signed_up_at":"2023-12-31T00:00:00Z"},"status":"active"}`,
+		},
+		{
+			name:          "epoch default",
+			defaultFormat: "epoch",
+			want:          `{"id":"user-1","phone_number":"+1234567890","created_at":1704067200,"last_login_at":1704164645,"metadata":{"signed_up_at":"2023-12-31T00:00:00Z"},"status":"active"}`,
+		},
+		{
+			name:          "rfc3339 profile overrides unix default",
+			defaultFormat: middleware.JSONTimeUnix,
+			accept:        `application/json; profile=rfc3339`,
+			want:          `{"id":"user-1","phone_number":"+1234567890","created_at":"2024-01-01T00:00:00Z","last_login_at":"2024-01-02T03:04:05Z","metadata":{"signed_up_at":"2023-12-31T00:00:00Z"},"status":"active"}`,
+		},
+		{
+			name:          "combined with camel case",
+			defaultFormat: middleware.JSONTimeRFC3339,
+			accept:        `application/json; profile="camelCase epoch"`,
+			want:          `{"id":"user-1","phoneNumber":"+1234567890","createdAt":1704067200,"lastLoginAt":1704164645,"metadata":{"signed_up_at":"2023-12-31T00:00:00Z"},"status":"active"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", middleware.JSONCaseMiddleware(middleware.JSONCaseSnake), middleware.JSONTimeFormatMiddleware(tt.defaultFormat), func(c *gin.Context) {
+				respondJSON(c, http.StatusOK, user)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Body.String() != tt.want {
+				t.Errorf("Expected body\n%s\ngot\n%s", tt.want, w.Body.String())
+			}
+			if vary := w.Header().Values("Vary"); len(vary) != 1 || vary[0] != "Accept" {
+				t.Errorf("Expected a single Vary: Accept, got %q", vary)
+			}
+		})
+	}
+}
+
+func TestEpochTimeJSONRoundTrip(t *testing.T) {
+	lastLogin := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	user := models.UserResponse{
+		ID:          "user-1",
+		CreatedAt:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		LastLoginAt: &lastLogin,
+	}
+	encoded, err := json.Marshal(user)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// RFC 3339 decodes straight back into the response type
+	var fromRFC3339 models.UserResponse
+	if err := json.Unmarshal(encoded, &fromRFC3339); err != nil {
+		t.Fatalf("Expected RFC 3339 body to decode, got %v", err)
+	}
+	if !fromRFC3339.CreatedAt.Equal(user.CreatedAt) || !fromRFC3339.LastLoginAt.Equal(lastLogin) {
+		t.Errorf("Expected RFC 3339 times to round-trip, got %+v", fromRFC3339)
+	}
+
+	// Epoch seconds decode as integers naming the same instants
+	epoch, err := rewriteJSON(encoded, jsonRewrite{epochTimes: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var fromEpoch struct {
+		CreatedAt   int64  `json:"created_at"`
+		LastLoginAt *int64 `json:"last_login_at"`
+	}
+	if err := json.Unmarshal(epoch, &fromEpoch); err != nil {
+		t.Fatalf("Expected epoch body to decode, got %v: %s", err, epoch)
+	}
+	if !time.Unix(fromEpoch.CreatedAt, 0).Equal(user.CreatedAt) || fromEpoch.LastLoginAt == nil || !time.Unix(*fromEpoch.LastLoginAt, 0).Equal(lastLogin) {
+		t.Errorf("Expected epoch times to round-trip, got %s", epoch)
+	}
+}
+
+func TestEpochTimeJSONLeavesOtherValues(t *testing.T) {
+	input := `{"last_login_at":null,"expires_at":"soon","issued_at":1700000000,"server_time":"2024-01-01T00:00:00.5Z","note":"2024-01-01T00:00:00Z"}`
+	want := `{"last_login_at":null,"expires_at":"soon","issued_at":1700000000,"server_time":1704067200,"note":"2024-01-01T00:00:00Z"}`
+
+	got, err := rewriteJSON([]byte(input), jsonRewrite{epochTimes: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
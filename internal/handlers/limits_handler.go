@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"otp/internal/middleware"
+	"otp/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LimitsHandler struct {
+	authService services.AuthService
+	auditLogger services.AuditLogger
+}
+
+func NewLimitsHandler(authService services.AuthService, auditLogger services.AuditLogger) *LimitsHandler {
+	return &LimitsHandler{
+		authService: authService,
+		auditLogger: auditLogger,
+	}
+}
+
+// ResetUserLimits godoc
+// @Summary Reset a user's rate limits
+// @Description Let a user request a new OTP immediately: their recent OTP requests stop counting toward the per-window and daily limits, and any delay for consecutive wrong codes is cleared. Pending codes stay valid. Each reset is recorded in the audit log.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.RateLimitReset
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /admin/users/{id}/reset-limits [post]
+func (h *LimitsHandler) ResetUserLimits(c *gin.Context) {
+	userID := c.Param("id")
+	adminID := middleware.UserIDFromContext(c)
+	ctx := services.ContextWithClientIP(c.Request.Context(), c.ClientIP())
+
+	reset, err := h.authService.ResetRateLimits(ctx, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			respondJSON(c, http.StatusNotFound, ErrorResponse{Error: "User not found"})
+			return
+		}
+		respondInternalError(c, err, "Failed to reset rate limits")
+		return
+	}
+	log.Printf("SECURITY: admin %s reset rate limits for user %s (%d OTP requests cleared)", adminID, userID, reset.OTPRequestsCleared)
+
+	metadata := map[string]interface{}{
+		"otp_requests_cleared":   reset.OTPRequestsCleared,
+		"verify_backoff_cleared": reset.VerifyBackoffCleared,
+	}
+	if err := h.auditLogger.Record(ctx, adminID, services.AuditActionUserLimitsReset, userID, metadata); err != nil {
+		log.Printf("Failed to record audit event for rate limit reset of user %s: %v", userID, err)
+	}
+
+	respondJSON(c, http.StatusOK, reset)
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"otp/internal/validation"
+)
+
+// TestMain registers the custom binding tags, as the server does at startup,
+// so request models that use them can be bound in any test
+func TestMain(m *testing.M) {
+	if err := validation.RegisterValidators(); err != nil {
+		log.Fatalf("Failed to register validators: %v", err)
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"otp/internal/middleware"
+	"otp/internal/models"
+	"otp/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MaintenanceHandler struct {
+	mode        *middleware.MaintenanceMode
+	auditLogger services.AuditLogger
+}
+
+func NewMaintenanceHandler(mode *middleware.MaintenanceMode, auditLogger services.AuditLogger) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		mode:        mode,
+		auditLogger: auditLogger,
+	}
+}
+
+// GetMaintenance godoc
+// @Summary Get maintenance mode
+// @Description Report whether write endpoints are currently rejected for maintenance
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.MaintenanceStatus
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /admin/maintenance [get]
+func (h *MaintenanceHandler) GetMaintenance(c *gin.Context) {
+	respondJSON(c, http.StatusOK, models.MaintenanceStatus{Enabled: h.mode.Enabled()})
+}
+
+// SetMaintenance godoc
+// @Summary Toggle maintenance mode
+// @Description Turn maintenance mode on or off for this instance. While on, write endpoints return 503 with code MAINTENANCE.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.MaintenanceRequest true "Desired state"
+// @Success 200 {object} models.MaintenanceStatus
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /admin/maintenance [post]
+func (h *MaintenanceHandler) SetMaintenance(c *gin.Context) {
+	var request models.MaintenanceRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid request body"))
+		return
+	}
+
+	h.mode.SetEnabled(*request.Enabled)
+	log.Printf("Maintenance mode set to %t by user %s", *request.Enabled, middleware.UserIDFromContext(c))
+
+	ctx := services.ContextWithClientIP(c.Request.Context(), c.ClientIP())
+	metadata := map[string]interface{}{"enabled": *request.Enabled}
+	if err := h.auditLogger.Record(ctx, middleware.UserIDFromContext(c), services.AuditActionMaintenanceUpdate, "maintenance", metadata); err != nil {
+		log.Printf("Failed to record audit event for maintenance update: %v", err)
+	}
+
+	respondJSON(c, http.StatusOK, models.MaintenanceStatus{Enabled: h.mode.Enabled()})
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"otp/internal/middleware"
+	"otp/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OTPCleanupHandler struct {
+	authService services.AuthService
+	auditLogger services.AuditLogger
+}
+
+func NewOTPCleanupHandler(authService services.AuthService, auditLogger services.AuditLogger) *OTPCleanupHandler {
+	return &OTPCleanupHandler{
+		authService: authService,
+		auditLogger: auditLogger,
+	}
+}
+
+// CleanupExpiredOTPs godoc
+// @Summary Delete expired OTPs
+// @Description Delete expired OTPs now rather than waiting for them to be cleaned up. OTPs created within the rate limit window or the last 24 hours are kept, even if expired, so they still count toward the limits. Repeating the call is harmless. Each cleanup is recorded in the audit log.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.OTPCleanup
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /admin/otp/cleanup [post]
+func (h *OTPCleanupHandler) CleanupExpiredOTPs(c *gin.Context) {
+	adminID := middleware.UserIDFromContext(c)
+	ctx := services.ContextWithClientIP(c.Request.Context(), c.ClientIP())
+
+	cleanup, err := h.authService.DeleteExpiredOTPs(ctx)
+	if err != nil {
+		respondInternalError(c, err, "Failed to delete expired OTPs")
+		return
+	}
+	log.Printf("SECURITY: admin %s deleted %d expired OTPs", adminID, cleanup.Deleted)
+
+	metadata := map[string]interface{}{"deleted": cleanup.Deleted}
+	if err := h.auditLogger.Record(ctx, adminID, services.AuditActionOTPCleanup, "otps", metadata); err != nil {
+		log.Printf("Failed to record audit event for OTP cleanup: %v", err)
+	}
+
+	respondJSON(c, http.StatusOK, cleanup)
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"otp/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newPaginationQuery binds the user list query parameters and normalizes
+// them, so absent, zero or negative page values fall back to defaults
+// instead of failing. Only malformed values, such as a non-numeric page or
+// an invalid time, return an error.
+func newPaginationQuery(c *gin.Context) (models.PaginationQuery, error) {
+	var query models.PaginationQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		return query, err
+	}
+
+	query.Normalize()
+	return query, nil
+}
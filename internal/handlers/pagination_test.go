@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"otp/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewPaginationQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		rawQuery     string
+		wantPage     int
+		wantPageSize int
+		wantErr      bool
+	}{
+		{"absent", "", 1, models.DefaultPageSize, false},
+		{"explicit", "page=3&page_size=25", 3, 25, false},
+		{"zero", "page=0&page_size=0", 1, models.DefaultPageSize, false},
+		{"negative", "page=-2&page_size=-5", 1, models.DefaultPageSize, false},
+		{"page size above max", "page_size=500", 1, models.MaxPageSize, false},
+		{"non-numeric page", "page=abc", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/users?"+tt.rawQuery, nil)
+
+			query, err := newPaginationQuery(c)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if query.Page != tt.wantPage || query.PageSize != tt.wantPageSize {
+				t.Errorf("Expected page %d size %d, got page %d size %d", tt.wantPage, tt.wantPageSize, query.Page, query.PageSize)
+			}
+		})
+	}
+}
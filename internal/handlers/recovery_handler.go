@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"otp/internal/middleware"
+	"otp/internal/models"
+	"otp/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestRecoveryPhone godoc
+// @Summary Request a recovery phone number
+// @Description Send an OTP to a recovery phone number to prove control of it before it is registered. Requires a recent login.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RecoveryPhoneRequest true "Recovery phone number"
+// @Success 200 {object} models.OTPResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /auth/recovery-phone/request [post]
+func (h *AuthHandler) RequestRecoveryPhone(c *gin.Context) {
+	var request models.RecoveryPhoneRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid request body"))
+		return
+	}
+	if !h.allowCodeRequest(c, request.RecoveryPhone, request.CaptchaToken) {
+		return
+	}
+
+	ctx := services.ContextWithClientIP(c.Request.Context(), c.ClientIP())
+	response, err := h.authService.RequestRecoveryPhone(ctx, middleware.UserIDFromContext(c), request)
+	if err != nil {
+		if h.respondRecoveryError(c, err) {
+			return
+		}
+		respondInternalError(c, err, "Failed to request recovery phone")
+		return
+	}
+
+	respondJSON(c, http.StatusOK, response)
+}
+
+// ConfirmRecoveryPhone godoc
+// @Summary Confirm a recovery phone number
+// @Description Verify the OTP sent to the recovery phone number and register it on the account. Requires a recent login.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RecoveryPhoneConfirmation true "Recovery phone number and OTP"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /auth/recovery-phone/confirm [post]
+func (h *AuthHandler) ConfirmRecoveryPhone(c *gin.Context) {
+	var request models.RecoveryPhoneConfirmation
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid request body"))
+		return
+	}
+
+	response, err := h.authService.ConfirmRecoveryPhone(c.Request.Context(), middleware.UserIDFromContext(c), request)
+	if err != nil {
+		if h.respondRecoveryError(c, err) {
+			return
+		}
+		respondInternalError(c, err, "Failed to register recovery phone")
+		return
+	}
+
+	respondJSON(c, http.StatusOK, response)
+}
+
+// RemoveRecoveryPhone godoc
+// @Summary Remove the recovery phone number
+// @Description Clear the current user's recovery phone number. Requires a recent login.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.UserResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /auth/recovery-phone [delete]
+func (h *AuthHandler) RemoveRecoveryPhone(c *gin.Context) {
+	response, err := h.authService.RemoveRecoveryPhone(c.Request.Context(), middleware.UserIDFromContext(c))
+	if err != nil {
+		if h.respondRecoveryError(c, err) {
+			return
+		}
+		respondInternalError(c, err, "Failed to remove recovery phone")
+		return
+	}
+
+	respondJSON(c, http.StatusOK, response)
+}
+
+// RequestAccountRecovery godoc
+// @Summary Request account recovery
+// @Description Send an OTP to a recovery phone number. The response does not reveal whether an account uses the number.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RecoveryPhoneRequest true "Recovery phone number"
+// @Success 200 {object} models.OTPResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /auth/recovery/request [post]
+func (h *AuthHandler) RequestAccountRecovery(c *gin.Context) {
+	var request models.RecoveryPhoneRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid request body"))
+		return
+	}
+	if !h.allowCodeRequest(c, request.RecoveryPhone, request.CaptchaToken) {
+		return
+	}
+
+	ctx := services.ContextWithClientIP(c.Request.Context(), c.ClientIP())
+	response, err := h.authService.RequestAccountRecovery(ctx, request)
+	if err != nil {
+		if h.respondRecoveryError(c, err) {
+			return
+		}
+		respondInternalError(c, err, "Failed to request account recovery")
+		return
+	}
+
+	respondJSON(c, http.StatusOK, response)
+}
+
+// RecoverAccount godoc
+// @Summary Recover an account
+// @Description Verify the OTP sent to a recovery phone number and sign in the account registered with it. A new phone number equal to the recovery phone becomes the primary number at once. Any other number is sent a code of its own (reported in phone_change), and the account moves once it is confirmed at /auth/phone/change-confirm with the returned token.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.AccountRecoveryConfirmation true "Recovery phone number, new phone number and OTP"
+// @Success 200 {object} models.AccountRecoveryResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /auth/recovery/confirm [post]
+func (h *AuthHandler) RecoverAccount(c *gin.Context) {
+	var request models.AccountRecoveryConfirmation
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid request body"))
+		return
+	}
+	// Moving to a number other than the recovery phone sends it a code
+	if request.NewPhoneNumber != request.RecoveryPhone && !h.allowCodeRequest(c, request.NewPhoneNumber, request.CaptchaToken) {
+		return
+	}
+
+	ctx := services.ContextWithClientIP(c.Request.Context(), c.ClientIP())
+	response, err := h.authService.RecoverAccount(ctx, request)
+	if err != nil {
+		if h.respondRecoveryError(c, err) {
+			return
+		}
+		respondInternalError(c, err, "Failed to recover account")
+		return
+	}
+
+	userID := response.User.ID
+	metadata := map[string]interface{}{
+		"recovery_phone":       models.MaskPhone(request.RecoveryPhone),
+		"new_phone_number":     models.MaskPhone(request.NewPhoneNumber),
+		"phone_change_pending": response.PhoneChange != nil,
+	}
+	if err := h.auditLogger.Record(ctx, userID, services.AuditActionUserRecover, userID, metadata); err != nil {
+		log.Printf("Failed to record audit event for recovery of user %s: %v", userID, err)
+	}
+
+	respondJSON(c, http.StatusOK, response)
+}
+
+// respondRecoveryError writes the response for errors shared by the recovery
+// endpoints, reporting whether it handled err.
+func (h *AuthHandler) respondRecoveryError(c *gin.Context, err error) bool {
+	if h.respondPhoneChangeError(c, err) {
+		return true
+	}
+
+	switch {
+	case errors.Is(err, services.ErrAccountSuspended):
+		respondJSON(c, http.StatusForbidden, ErrorResponse{Error: err.Error(), Code: ErrCodeAccountSuspended})
+	case errors.Is(err, services.ErrRecoveryPhoneIsPrimary):
+		respondJSON(c, http.StatusBadRequest, ErrorResponse{Error: err.Error(), Code: ErrCodeRecoveryPhoneIsPrimary})
+	case errors.Is(err, services.ErrInvalidPhoneNumber):
+		respondJSON(c, http.StatusBadRequest, invalidPhoneNumberResponse("recovery_phone"))
+	case errors.Is(err, services.ErrRateLimitExceeded):
+		respondJSON(c, http.StatusTooManyRequests, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrDailyLimitExceeded):
+		respondJSON(c, http.StatusTooManyRequests, ErrorResponse{Error: err.Error(), Code: ErrCodeDailyLimitExceeded})
+	case errors.Is(err, services.ErrResendCooldown):
+		respondJSON(c, http.StatusTooManyRequests, ErrorResponse{Error: err.Error(), Code: ErrCodeResendCooldown})
+	default:
+		code := verificationErrorCode(err)
+		if code == "" {
+			return false
+		}
+		respondJSON(c, http.StatusUnauthorized, ErrorResponse{Error: err.Error(), Code: code})
+	}
+	return true
+}
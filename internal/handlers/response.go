@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"otp/internal/captcha"
+	"otp/internal/middleware"
+	"otp/internal/response"
+	"otp/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	ErrCodeTooManyNumbers         = "TOO_MANY_NUMBERS"
+	ErrCodeDailyLimitExceeded     = "DAILY_LIMIT_EXCEEDED"
+	ErrCodeResendCooldown         = "RESEND_COOLDOWN"
+	ErrCodeOTPNotFound            = "OTP_NOT_FOUND"
+	ErrCodeOTPExpired             = "OTP_EXPIRED"
+	ErrCodeOTPWrongCode           = "OTP_WRONG_CODE"
+	ErrCodeOTPAlreadyUsed         = "OTP_ALREADY_USED"
+	ErrCodeRegistrationDisabled   = "REGISTRATION_DISABLED"
+	ErrCodeSamePhoneNumber        = "SAME_PHONE_NUMBER"
+	ErrCodePhoneNumberTaken       = "PHONE_NUMBER_TAKEN"
+	ErrCodeRecoveryPhoneIsPrimary = "RECOVERY_PHONE_IS_PRIMARY"
+	ErrCodeValidation             = "VALIDATION_ERROR"
+	ErrCodeMetadataTooLarge       = "METADATA_TOO_LARGE"
+	ErrCodeMetadataConflict       = "METADATA_CONFLICT"
+	ErrCodeNotFound               = "NOT_FOUND"
+	ErrCodeMethodNotAllowed       = "METHOD_NOT_ALLOWED"
+	ErrCodeUserNotFound           = "USER_NOT_FOUND"
+	ErrCodeCaptchaRequired        = "CAPTCHA_REQUIRED"
+	ErrCodeCaptchaFailed          = "CAPTCHA_FAILED"
+	ErrCodeAccountSuspended       = "ACCOUNT_SUSPENDED"
+	ErrCodeDBTimeout              = "DB_TIMEOUT"
+	ErrCodeServerBusy             = "SERVER_BUSY"
+	ErrCodeCaptchaUnavailable     = "CAPTCHA_UNAVAILABLE"
+)
+
+// StatusClientClosedRequest is the non-standard status (borrowed from nginx)
+// logged when the client disconnects before a response is written.
+const StatusClientClosedRequest = 499
+
+// ErrorResponse is the body of every failed API call, shared with
+// middleware. Message is filled in by respondJSON.
+type ErrorResponse = response.ErrorResponse
+
+// FieldError describes why a single request field failed validation
+type FieldError = response.FieldError
+
+type SuccessResponse struct {
+	Message string `json:"message"`
+}
+
+// respondJSON writes body as JSON along with the headers every API response
+// should carry, renaming fields to camelCase when the client negotiated it
+// (see middleware.JSONCaseMiddleware). Handlers should use it instead of
+// calling c.JSON directly.
+func respondJSON(c *gin.Context, status int, body interface{}) {
+	response.SetHeaders(c)
+	if errorResponse, ok := body.(ErrorResponse); ok {
+		body = response.Localize(c, errorResponse)
+	}
+
+	rewrite := jsonRewrite{
+		camelCase:  middleware.JSONCase(c) == middleware.JSONCaseCamel,
+		epochTimes: middleware.JSONTimeFormat(c) == middleware.JSONTimeUnix,
+	}
+	if rewrite.camelCase || rewrite.epochTimes {
+		encoded, err := json.Marshal(body)
+		if err == nil {
+			encoded, err = rewriteJSON(encoded, rewrite)
+		}
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.Data(status, "application/json; charset=utf-8", encoded)
+		return
+	}
+	c.JSON(status, body)
+}
+
+// respondInternalError responds 503 with code SERVER_BUSY when the OTP
+// generation limit was reached, 503 with code DB_TIMEOUT when err is a
+// database query timeout, 503 with code CAPTCHA_UNAVAILABLE when the CAPTCHA
+// provider could not be reached, and a plain 500 with message otherwise.
+func respondInternalError(c *gin.Context, err error, message string) {
+	if errors.Is(err, captcha.ErrUnavailable) {
+		respondJSON(c, http.StatusServiceUnavailable, ErrorResponse{Error: "CAPTCHA verification is temporarily unavailable", Code: ErrCodeCaptchaUnavailable})
+		return
+	}
+	if errors.Is(err, services.ErrServerBusy) {
+		c.Header("Retry-After", "1")
+		respondJSON(c, http.StatusServiceUnavailable, ErrorResponse{Error: err.Error(), Code: ErrCodeServerBusy})
+		return
+	}
+	if errors.Is(err, services.ErrDatabaseTimeout) {
+		respondJSON(c, http.StatusServiceUnavailable, ErrorResponse{Error: "Database query timed out", Code: ErrCodeDBTimeout})
+		return
+	}
+	respondJSON(c, http.StatusInternalServerError, ErrorResponse{Error: message})
+}
+
+// bindingErrorResponse turns a request binding error into a client-facing
+// response. Validation failures list every invalid field under the
+// VALIDATION_ERROR code; other failures, such as malformed JSON, fall back to
+// the generic message.
+func bindingErrorResponse(err error, fallback string) ErrorResponse {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) || len(validationErrors) == 0 {
+		return ErrorResponse{Error: fallback}
+	}
+
+	fields := make([]FieldError, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		fields = append(fields, FieldError{
+			Field:  fieldError.Field(),
+			Reason: validationReason(fieldError),
+		})
+	}
+
+	return ErrorResponse{
+		Error:  fmt.Sprintf("%s %s", fields[0].Field, fields[0].Reason),
+		Code:   ErrCodeValidation,
+		Fields: fields,
+	}
+}
+
+// invalidPhoneNumberResponse reports a phone number in field that passed
+// binding but could not be read as E.164 or as a national number of the
+// default region
+func invalidPhoneNumberResponse(field string) ErrorResponse {
+	reason := "must be a valid E.164 phone number (e.g. +14155552671)"
+	return ErrorResponse{
+		Error:  field + " " + reason,
+		Code:   ErrCodeValidation,
+		Fields: []FieldError{{Field: field, Reason: reason}},
+	}
+}
+
+// phoneNumberQuery returns the phone number in query parameter key. An
+// unencoded + decodes as a space, so a leading space is read back as the +
+// it almost certainly was.
+func phoneNumberQuery(c *gin.Context, key string) string {
+	phoneNumber := c.Query(key)
+	if strings.HasPrefix(phoneNumber, " ") {
+		phoneNumber = "+" + phoneNumber[1:]
+	}
+	return phoneNumber
+}
+
+func validationReason(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "e164", "strict_e164", "phone":
+		return "must be a valid E.164 phone number (e.g. +14155552671)"
+	case "min":
+		return "must be at least " + fieldError.Param()
+	case "max":
+		return "must be at most " + fieldError.Param()
+	case "oneof":
+		return "must be one of: " + fieldError.Param()
+	default:
+		return "failed " + fieldError.Tag() + " validation"
+	}
+}
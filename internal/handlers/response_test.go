@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"otp/internal/models"
+	"otp/internal/validation"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+func TestBindingErrorResponse(t *testing.T) {
+	if err := validation.RegisterValidators(); err != nil {
+		t.Fatalf("Failed to register validators: %v", err)
+	}
+
+	err := binding.Validator.ValidateStruct(&models.OTPVerification{PhoneNumber: "12"})
+	response := bindingErrorResponse(err, "Invalid request body")
+
+	if response.Code != ErrCodeValidation {
+		t.Errorf("Expected code %s, got %s", ErrCodeValidation, response.Code)
+	}
+
+	want := []FieldError{
+		{Field: "phone_number", Reason: "must be a valid E.164 phone number (e.g. +14155552671)"},
+		{Field: "code", Reason: "is required"},
+	}
+	if len(response.Fields) != len(want) {
+		t.Fatalf("Expected %d fields, got %+v", len(want), response.Fields)
+	}
+	for i := range want {
+		if response.Fields[i] != want[i] {
+			t.Errorf("Field %d: expected %+v, got %+v", i, want[i], response.Fields[i])
+		}
+	}
+
+	if response.Error != "phone_number must be a valid E.164 phone number (e.g. +14155552671)" {
+		t.Errorf("Unexpected error message %q", response.Error)
+	}
+}
+
+func TestBindingErrorResponse_NonValidationError(t *testing.T) {
+	response := bindingErrorResponse(errors.New("unexpected EOF"), "Invalid request body")
+	if response.Error != "Invalid request body" || response.Code != "" || response.Fields != nil {
+		t.Errorf("Expected generic response, got %+v", response)
+	}
+}
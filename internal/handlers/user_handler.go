@@ -1,24 +1,76 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 
+	"otp/internal/middleware"
 	"otp/internal/models"
 	"otp/internal/services"
+	"otp/internal/validation"
 
 	"github.com/gin-gonic/gin"
 )
 
 type UserHandler struct {
 	userService services.UserService
+	auditLogger services.AuditLogger
+	// defaultRegion reads phone numbers in national format, as
+	// OTP_DEFAULT_REGION does for the auth endpoints
+	defaultRegion string
 }
 
-func NewUserHandler(userService services.UserService) *UserHandler {
+func NewUserHandler(userService services.UserService, auditLogger services.AuditLogger, defaultRegion string) *UserHandler {
 	return &UserHandler{
-		userService: userService,
+		userService:   userService,
+		auditLogger:   auditLogger,
+		defaultRegion: defaultRegion,
 	}
 }
 
+// UpdateMe godoc
+// @Summary Update the current user's metadata
+// @Description Merge attributes into the authenticated user's metadata. Keys set to null are removed.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.UserMetadataUpdate true "Metadata changes"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /auth/me [patch]
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	var request models.UserMetadataUpdate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid request body"))
+		return
+	}
+
+	user, err := h.userService.UpdateMetadata(c.Request.Context(), middleware.UserIDFromContext(c), request.Metadata)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			respondJSON(c, http.StatusNotFound, ErrorResponse{Error: "User not found"})
+			return
+		}
+		if errors.Is(err, services.ErrMetadataTooLarge) {
+			respondJSON(c, http.StatusBadRequest, ErrorResponse{Error: err.Error(), Code: ErrCodeMetadataTooLarge})
+			return
+		}
+		if errors.Is(err, services.ErrMetadataConflict) {
+			respondJSON(c, http.StatusConflict, ErrorResponse{Error: err.Error(), Code: ErrCodeMetadataConflict})
+			return
+		}
+		respondInternalError(c, err, "Failed to update user")
+		return
+	}
+
+	respondJSON(c, http.StatusOK, user)
+}
+
 // GetUser godoc
 // @Summary Get user by ID
 // @Description Retrieve user details by user ID
@@ -35,21 +87,70 @@ func NewUserHandler(userService services.UserService) *UserHandler {
 func (h *UserHandler) GetUser(c *gin.Context) {
 	userID := c.Param("id")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "User ID is required"})
+		respondJSON(c, http.StatusBadRequest, ErrorResponse{Error: "User ID is required"})
 		return
 	}
 
 	user, err := h.userService.GetByID(c.Request.Context(), userID)
 	if err != nil {
-		if err.Error() == "user not found" {
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		if errors.Is(err, services.ErrUserNotFound) {
+			respondJSON(c, http.StatusNotFound, ErrorResponse{Error: "User not found"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get user"})
+		respondInternalError(c, err, "Failed to get user")
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	respondJSON(c, http.StatusOK, user)
+}
+
+// LookupUserByPhone godoc
+// @Summary Look up a user by phone number
+// @Description Find a user by phone number for support purposes. The number is read like on the auth endpoints, including national format with OTP_DEFAULT_REGION, and a leading space is read as an unencoded +. Every lookup, including one that finds no user, is recorded in the audit log.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param phone_number query string true "Phone number in E.164 format; URL-encode the + as %2B"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /admin/users/by-phone [get]
+func (h *UserHandler) LookupUserByPhone(c *gin.Context) {
+	phoneNumber, err := validation.CanonicalPhoneNumber(phoneNumberQuery(c, "phone_number"), h.defaultRegion)
+	if err != nil {
+		respondJSON(c, http.StatusBadRequest, invalidPhoneNumberResponse("phone_number"))
+		return
+	}
+
+	ctx := services.ContextWithClientIP(c.Request.Context(), c.ClientIP())
+	user, err := h.userService.GetByPhoneNumber(ctx, phoneNumber)
+	if err != nil && !errors.Is(err, services.ErrUserNotFound) {
+		respondInternalError(c, err, "Failed to get user")
+		return
+	}
+
+	// Lookups that find no one are recorded too, so probing for which
+	// numbers have accounts shows up in the log
+	target := ""
+	if user != nil {
+		target = user.ID
+	}
+	metadata := map[string]interface{}{
+		"phone_number": models.MaskPhone(phoneNumber),
+		"found":        user != nil,
+	}
+	if err := h.auditLogger.Record(ctx, middleware.UserIDFromContext(c), services.AuditActionUserLookup, target, metadata); err != nil {
+		log.Printf("Failed to record audit event for lookup of %s: %v", models.MaskPhone(phoneNumber), err)
+	}
+
+	if user == nil {
+		respondJSON(c, http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return
+	}
+	respondJSON(c, http.StatusOK, user)
 }
 
 // ListUsers godoc
@@ -58,36 +159,122 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 // @Tags users
 // @Accept json
 // @Produce json
-// @Param page query int false "Page number (default: 1)"
-// @Param page_size query int false "Page size (default: 10, max: 100)"
+// @Param page query int false "Page number (default: 1; values below 1 use the default)"
+// @Param page_size query int false "Page size (default: 10; values below 1 use the default, values above 100 are capped)"
 // @Param search query string false "Search by phone number"
+// @Param created_after query string false "Only users created at or after this RFC3339 time"
+// @Param created_before query string false "Only users created before this RFC3339 time"
+// @Param metadata_key query string false "Only users whose metadata has this key"
+// @Param metadata_value query string false "With metadata_key, only users whose value for the key equals this (as text)"
+// @Param fields query string false "Comma-separated fields to return (id, phone_number, created_at, last_login_at, metadata)"
 // @Success 200 {object} models.UserListResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Security BearerAuth
 // @Router /users [get]
 func (h *UserHandler) ListUsers(c *gin.Context) {
-	var query models.PaginationQuery
-	if err := c.ShouldBindQuery(&query); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query parameters"})
+	query, err := newPaginationQuery(c)
+	if err != nil {
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid query parameters"))
 		return
 	}
 
-	// Set default values
-	if query.Page == 0 {
-		query.Page = 1
-	}
-	if query.PageSize == 0 {
-		query.PageSize = 10
+	var fields []string
+	if rawFields, ok := c.GetQuery("fields"); ok {
+		fields, err = models.ParseUserFields(rawFields)
+		if err != nil {
+			respondJSON(c, http.StatusBadRequest, ErrorResponse{Error: "Invalid fields parameter: " + err.Error()})
+			return
+		}
 	}
 
 	users, err := h.userService.List(c.Request.Context(), query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get users"})
+		respondInternalError(c, err, "Failed to get users")
+		return
+	}
+
+	if fields != nil {
+		respondJSON(c, http.StatusOK, users.Project(fields))
+		return
+	}
+
+	respondJSON(c, http.StatusOK, users)
+}
+
+// CountUsers godoc
+// @Summary Count users
+// @Description Return the total number of users, optionally filtered like the user list
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param search query string false "Search by phone number"
+// @Param created_after query string false "Only users created at or after this RFC3339 time"
+// @Param created_before query string false "Only users created before this RFC3339 time"
+// @Param metadata_key query string false "Only users whose metadata has this key"
+// @Param metadata_value query string false "With metadata_key, only users whose value for the key equals this (as text)"
+// @Success 200 {object} models.UserCountResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /users/count [get]
+func (h *UserHandler) CountUsers(c *gin.Context) {
+	var filter models.UserFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid query parameters"))
+		return
+	}
+
+	total, err := h.userService.Count(c.Request.Context(), filter)
+	if err != nil {
+		respondInternalError(c, err, "Failed to count users")
+		return
+	}
+
+	respondJSON(c, http.StatusOK, models.UserCountResponse{Total: total})
+}
+
+// SetUserStatus godoc
+// @Summary Set a user's account status
+// @Description Suspend, ban or reactivate a user. Non-active users cannot sign in, and their existing tokens are rejected.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body models.UserStatusUpdate true "New status"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /admin/users/{id}/status [put]
+func (h *UserHandler) SetUserStatus(c *gin.Context) {
+	var request models.UserStatusUpdate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondJSON(c, http.StatusBadRequest, bindingErrorResponse(err, "Invalid request body"))
+		return
+	}
+
+	userID := c.Param("id")
+	ctx := services.ContextWithClientIP(c.Request.Context(), c.ClientIP())
+	user, err := h.userService.SetStatus(ctx, userID, request.Status)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			respondJSON(c, http.StatusNotFound, ErrorResponse{Error: "User not found"})
+			return
+		}
+		respondInternalError(c, err, "Failed to update user status")
 		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	metadata := map[string]interface{}{"status": request.Status}
+	if err := h.auditLogger.Record(ctx, middleware.UserIDFromContext(c), services.AuditActionUserStatusUpdate, userID, metadata); err != nil {
+		log.Printf("Failed to record audit event for status change of user %s: %v", userID, err)
+	}
+
+	respondJSON(c, http.StatusOK, user)
 }
 
 // DeleteUser godoc
@@ -106,23 +293,24 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	userID := c.Param("id")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "User ID is required"})
+		respondJSON(c, http.StatusBadRequest, ErrorResponse{Error: "User ID is required"})
 		return
 	}
 
-	err := h.userService.Delete(c.Request.Context(), userID)
+	ctx := services.ContextWithClientIP(c.Request.Context(), c.ClientIP())
+	err := h.userService.Delete(ctx, userID)
 	if err != nil {
-		if err.Error() == "user not found" {
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		if errors.Is(err, services.ErrUserNotFound) {
+			respondJSON(c, http.StatusNotFound, ErrorResponse{Error: "User not found"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete user"})
+		respondInternalError(c, err, "Failed to delete user")
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{Message: "User deleted successfully"})
-}
+	if err := h.auditLogger.Record(ctx, middleware.UserIDFromContext(c), services.AuditActionUserDelete, userID, nil); err != nil {
+		log.Printf("Failed to record audit event for deletion of user %s: %v", userID, err)
+	}
 
-type SuccessResponse struct {
-	Message string `json:"message"`
+	respondJSON(c, http.StatusOK, SuccessResponse{Message: "User deleted successfully"})
 }
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"otp/internal/models"
+	"otp/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lookupUserService finds only the user with one phone number
+type lookupUserService struct {
+	services.UserService
+	user *models.UserResponse
+}
+
+func (s lookupUserService) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*models.UserResponse, error) {
+	if phoneNumber != s.user.PhoneNumber {
+		return nil, services.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+// recordingAuditLogger keeps every event recorded through it
+type recordingAuditLogger struct {
+	services.AuditLogger
+	events []models.AuditEvent
+}
+
+func (l *recordingAuditLogger) Record(ctx context.Context, actor, action, target string, metadata map[string]interface{}) error {
+	l.events = append(l.events, models.AuditEvent{ActorID: actor, Action: action, Target: target, Metadata: metadata})
+	return nil
+}
+
+func TestLookupUserByPhone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	userService := lookupUserService{user: &models.UserResponse{ID: "user-1", PhoneNumber: "+14155552671"}}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantTarget string
+		wantFound  bool
+	}{
+		{"encoded plus", "phone_number=%2B14155552671", http.StatusOK, "user-1", true},
+		{"unencoded plus", "phone_number=+14155552671", http.StatusOK, "user-1", true},
+		{"national format", "phone_number=(415)%20555-2671", http.StatusOK, "user-1", true},
+		{"international prefix", "phone_number=0014155552671", http.StatusOK, "user-1", true},
+		{"unknown number", "phone_number=%2B14155550000", http.StatusNotFound, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditLogger := &recordingAuditLogger{}
+			router := gin.New()
+			router.GET("/by-phone", NewUserHandler(userService, auditLogger, "US").LookupUserByPhone)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/by-phone?"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if len(auditLogger.events) != 1 {
+				t.Fatalf("Expected the lookup to be audited once, got %d events", len(auditLogger.events))
+			}
+			event := auditLogger.events[0]
+			if event.Action != services.AuditActionUserLookup || event.Target != tt.wantTarget || event.Metadata["found"] != tt.wantFound {
+				t.Errorf("Expected a %s event for %q with found=%v, got %+v", services.AuditActionUserLookup, tt.wantTarget, tt.wantFound, event)
+			}
+			if event.Metadata["phone_number"] == "+14155552671" {
+				t.Error("Expected the audited phone number to be masked")
+			}
+		})
+	}
+
+	// Without a default region a national number can't be read
+	router := gin.New()
+	router.GET("/by-phone", NewUserHandler(userService, &recordingAuditLogger{}, "").LookupUserByPhone)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/by-phone?phone_number=4155552671", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a national number without a default region, got %d", w.Code)
+	}
+}
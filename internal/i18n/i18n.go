@@ -0,0 +1,79 @@
+package i18n
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is used when the client accepts none of the catalog's locales
+// or a message is missing from the requested one.
+const DefaultLocale = "en"
+
+//go:embed messages.json
+var catalogJSON []byte
+
+// catalog maps locale to error code to message
+var catalog = mustLoadCatalog(catalogJSON)
+
+func mustLoadCatalog(data []byte) map[string]map[string]string {
+	var c map[string]map[string]string
+	if err := json.Unmarshal(data, &c); err != nil {
+		panic("i18n: invalid message catalog: " + err.Error())
+	}
+	if _, ok := c[DefaultLocale]; !ok {
+		panic("i18n: message catalog has no " + DefaultLocale + " locale")
+	}
+	return c
+}
+
+// Message returns the message for code in the best locale the
+// Accept-Language header allows, falling back to English. It returns an
+// empty string for codes the catalog does not know.
+func Message(acceptLanguage, code string) string {
+	if message, ok := catalog[Negotiate(acceptLanguage)][code]; ok {
+		return message
+	}
+	return catalog[DefaultLocale][code]
+}
+
+// Negotiate picks the catalog locale that best matches an Accept-Language
+// header. Region subtags are ignored, so "es-MX" selects "es".
+func Negotiate(acceptLanguage string) string {
+	type preference struct {
+		locale string
+		weight float64
+	}
+
+	var preferences []preference
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		if tag == "" || weight <= 0 {
+			continue
+		}
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		preferences = append(preferences, preference{locale: base, weight: weight})
+	}
+
+	// Stable so that equally weighted tags keep the client's order
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].weight > preferences[j].weight
+	})
+
+	for _, p := range preferences {
+		if _, ok := catalog[p.locale]; ok {
+			return p.locale
+		}
+	}
+	return DefaultLocale
+}
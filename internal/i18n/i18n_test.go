@@ -0,0 +1,49 @@
+package i18n
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"es", "es"},
+		{"es-MX", "es"},
+		{"FR-ca", "fr"},
+		{"de", "en"},
+		{"de, fr;q=0.8, es;q=0.5", "fr"},
+		{"en;q=0.5, es;q=0.9", "es"},
+		{"es;q=0, fr;q=0.1", "fr"},
+		{"es;q=bogus, fr;q=0.1", "fr"},
+		{"*", "en"},
+	}
+
+	for _, tt := range tests {
+		if got := Negotiate(tt.header); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	if got := Message("es-ES", "OTP_EXPIRED"); got != catalog["es"]["OTP_EXPIRED"] {
+		t.Errorf("Expected Spanish message, got %q", got)
+	}
+	if got := Message("ja", "OTP_EXPIRED"); got != catalog["en"]["OTP_EXPIRED"] {
+		t.Errorf("Expected English fallback, got %q", got)
+	}
+	if got := Message("es", "NOT_A_CODE"); got != "" {
+		t.Errorf("Expected empty message for unknown code, got %q", got)
+	}
+}
+
+func TestCatalogLocalesCoverEnglish(t *testing.T) {
+	for locale, messages := range catalog {
+		for code := range catalog[DefaultLocale] {
+			if messages[code] == "" {
+				t.Errorf("Locale %q is missing a message for %s", locale, code)
+			}
+		}
+	}
+}
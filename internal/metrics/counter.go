@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing metric incremented by application
+// code. It is a Collector, so it can be registered like any other. A nil
+// *Counter is valid and discards increments, which lets callers treat the
+// metric as optional.
+type Counter struct {
+	name  string
+	help  string
+	value atomic.Uint64
+}
+
+func NewCounter(name, help string) *Counter {
+	return &Counter{name: name, help: help}
+}
+
+func (c *Counter) Inc() {
+	if c == nil {
+		return
+	}
+	c.value.Add(1)
+}
+
+func (c *Counter) Value() uint64 {
+	if c == nil {
+		return 0
+	}
+	return c.value.Load()
+}
+
+func (c *Counter) Collect(ctx context.Context) ([]Sample, error) {
+	return []Sample{{
+		Name:  c.name,
+		Help:  c.help,
+		Type:  TypeCounter,
+		Value: float64(c.Value()),
+	}}, nil
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+)
+
+// DBStatsSource reports connection pool statistics; *sql.DB satisfies it
+type DBStatsSource interface {
+	Stats() sql.DBStats
+}
+
+// DBPoolCollector reports connection pool usage for each named database, so
+// requests queueing for a connection can be told apart from slow queries.
+// It logs a warning when requests had to wait since the previous scrape.
+type DBPoolCollector struct {
+	pools map[string]DBStatsSource
+
+	mu        sync.Mutex
+	lastWaits map[string]int64
+}
+
+// NewDBPoolCollector reports the pools keyed by the value of their db label,
+// e.g. "primary" and "replica"
+func NewDBPoolCollector(pools map[string]DBStatsSource) *DBPoolCollector {
+	return &DBPoolCollector{pools: pools, lastWaits: make(map[string]int64)}
+}
+
+func (c *DBPoolCollector) Collect(ctx context.Context) ([]Sample, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var samples []Sample
+	for name, pool := range c.pools {
+		stats := pool.Stats()
+		labels := map[string]string{"db": name}
+
+		if waited := stats.WaitCount - c.lastWaits[name]; waited > 0 {
+			log.Printf("WARNING: %d requests waited for a %s database connection since the last scrape (%d of %d open connections in use)",
+				waited, name, stats.InUse, stats.MaxOpenConnections)
+		}
+		c.lastWaits[name] = stats.WaitCount
+
+		samples = append(samples,
+			Sample{Name: "db_max_open_connections", Help: "Maximum number of open connections to the database.", Type: TypeGauge, Labels: labels, Value: float64(stats.MaxOpenConnections)},
+			Sample{Name: "db_open_connections", Help: "Number of established connections, in use and idle.", Type: TypeGauge, Labels: labels, Value: float64(stats.OpenConnections)},
+			Sample{Name: "db_in_use", Help: "Number of connections currently in use.", Type: TypeGauge, Labels: labels, Value: float64(stats.InUse)},
+			Sample{Name: "db_idle", Help: "Number of idle connections.", Type: TypeGauge, Labels: labels, Value: float64(stats.Idle)},
+			Sample{Name: "db_wait_count", Help: "Total number of times a request waited for a connection.", Type: TypeCounter, Labels: labels, Value: float64(stats.WaitCount)},
+			Sample{Name: "db_wait_duration_seconds", Help: "Total time requests spent waiting for a connection.", Type: TypeCounter, Labels: labels, Value: stats.WaitDuration.Seconds()},
+		)
+	}
+	return samples, nil
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Gauge is a metric that application code moves up and down. Like Counter it
+// is a Collector and a nil *Gauge discards updates.
+type Gauge struct {
+	name  string
+	help  string
+	value atomic.Int64
+}
+
+func NewGauge(name, help string) *Gauge {
+	return &Gauge{name: name, help: help}
+}
+
+func (g *Gauge) Inc() {
+	if g == nil {
+		return
+	}
+	g.value.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	if g == nil {
+		return
+	}
+	g.value.Add(-1)
+}
+
+func (g *Gauge) Value() int64 {
+	if g == nil {
+		return 0
+	}
+	return g.value.Load()
+}
+
+func (g *Gauge) Collect(ctx context.Context) ([]Sample, error) {
+	return []Sample{{
+		Name:  g.name,
+		Help:  g.help,
+		Type:  TypeGauge,
+		Value: float64(g.Value()),
+	}}, nil
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metric types understood by Prometheus
+const (
+	TypeCounter = "counter"
+	TypeGauge   = "gauge"
+)
+
+// Sample is a single metric value reported by a Collector
+type Sample struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Collector produces samples on demand, when the metrics endpoint is scraped
+type Collector interface {
+	Collect(ctx context.Context) ([]Sample, error)
+}
+
+// Registry gathers collectors and exposes them in the Prometheus text format
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(collector Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collector)
+}
+
+// Gather collects samples from every registered collector. A failing
+// collector is logged and skipped so it can't break the whole scrape.
+func (r *Registry) Gather(ctx context.Context) []Sample {
+	r.mu.RLock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	var samples []Sample
+	for _, collector := range collectors {
+		collected, err := collector.Collect(ctx)
+		if err != nil {
+			log.Printf("Failed to collect metrics: %v", err)
+			continue
+		}
+		samples = append(samples, collected...)
+	}
+	return samples
+}
+
+// Handler serves the gathered metrics for Prometheus to scrape
+func (r *Registry) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		WriteText(c.Writer, r.Gather(ctx))
+	}
+}
+
+// WriteText writes samples in the Prometheus text exposition format, grouping
+// samples of the same metric under a single HELP/TYPE header.
+func WriteText(w io.Writer, samples []Sample) {
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Name < samples[j].Name
+	})
+
+	previous := ""
+	for _, sample := range samples {
+		if sample.Name != previous {
+			fmt.Fprintf(w, "# HELP %s %s\n", sample.Name, sample.Help)
+			fmt.Fprintf(w, "# TYPE %s %s\n", sample.Name, sample.Type)
+			previous = sample.Name
+		}
+		fmt.Fprintf(w, "%s%s %v\n", sample.Name, formatLabels(sample.Labels), sample.Value)
+	}
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[name])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
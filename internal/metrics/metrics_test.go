@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type staticCollector struct {
+	samples []Sample
+	err     error
+}
+
+func (c *staticCollector) Collect(ctx context.Context) ([]Sample, error) {
+	return c.samples, c.err
+}
+
+func TestRegistry_WriteText(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&staticCollector{samples: []Sample{
+		{Name: "requests", Help: "Requests.", Type: TypeCounter, Labels: map[string]string{"status": "ok"}, Value: 3},
+		{Name: "requests", Help: "Requests.", Type: TypeCounter, Labels: map[string]string{"status": `"bad"`}, Value: 1},
+	}})
+	registry.Register(&staticCollector{err: errors.New("unavailable")})
+	registry.Register(&staticCollector{samples: []Sample{
+		{Name: "queue_size", Help: "Queue size.", Type: TypeGauge, Value: 7},
+	}})
+
+	var out strings.Builder
+	WriteText(&out, registry.Gather(context.Background()))
+
+	want := `# HELP queue_size Queue size.
+# TYPE queue_size gauge
+queue_size 7
+# HELP requests Requests.
+# TYPE requests counter
+requests{status="ok"} 3
+requests{status="\"bad\""} 1
+`
+	if out.String() != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	counter := NewCounter("events_total", "Events.")
+	counter.Inc()
+	counter.Inc()
+
+	var out strings.Builder
+	samples, _ := counter.Collect(context.Background())
+	WriteText(&out, samples)
+
+	want := "# HELP events_total Events.\n# TYPE events_total counter\nevents_total 2\n"
+	if out.String() != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	var disabled *Counter
+	disabled.Inc()
+	if disabled.Value() != 0 {
+		t.Errorf("Expected nil counter to stay at 0, got %d", disabled.Value())
+	}
+}
+
+func TestGauge(t *testing.T) {
+	gauge := NewGauge("in_flight", "In flight.")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+
+	samples, _ := gauge.Collect(context.Background())
+	if len(samples) != 1 || samples[0].Value != 1 || samples[0].Type != TypeGauge {
+		t.Errorf("Unexpected samples %+v", samples)
+	}
+}
+
+type staticDBStats sql.DBStats
+
+func (s staticDBStats) Stats() sql.DBStats {
+	return sql.DBStats(s)
+}
+
+func TestDBPoolCollector(t *testing.T) {
+	collector := NewDBPoolCollector(map[string]DBStatsSource{
+		"primary": staticDBStats{MaxOpenConnections: 25, OpenConnections: 25, InUse: 25, WaitCount: 4, WaitDuration: 1500 * time.Millisecond},
+	})
+
+	var out strings.Builder
+	samples, _ := collector.Collect(context.Background())
+	WriteText(&out, samples)
+
+	for _, line := range []string{
+		`db_in_use{db="primary"} 25`,
+		`db_idle{db="primary"} 0`,
+		`db_open_connections{db="primary"} 25`,
+		`db_max_open_connections{db="primary"} 25`,
+		`db_wait_count{db="primary"} 4`,
+		`db_wait_duration_seconds{db="primary"} 1.5`,
+		"# TYPE db_wait_count counter",
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"context"
+
+	"otp/internal/repository"
+)
+
+// OTPTableCollector reports the size of the otps table. A steadily growing
+// number of expired rows means expired OTPs are not being cleaned up.
+type OTPTableCollector struct {
+	otpRepo repository.OTPRepository
+}
+
+func NewOTPTableCollector(otpRepo repository.OTPRepository) *OTPTableCollector {
+	return &OTPTableCollector{otpRepo: otpRepo}
+}
+
+func (c *OTPTableCollector) Collect(ctx context.Context) ([]Sample, error) {
+	total, expired, err := c.otpRepo.CountRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Sample{
+		{
+			Name:  "otps_total",
+			Help:  "Number of rows in the otps table.",
+			Type:  TypeGauge,
+			Value: float64(total),
+		},
+		{
+			Name:  "otps_expired_total",
+			Help:  "Number of expired rows in the otps table that have not been cleaned up yet.",
+			Type:  TypeGauge,
+			Value: float64(expired),
+		},
+	}, nil
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"otp/internal/config"
+	"otp/internal/models"
+	"otp/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ErrCodeAdminRequired = "ADMIN_REQUIRED"
+
+// AdminMiddleware restricts a route to the phone numbers listed in
+// ADMIN_PHONE_NUMBERS. It must run after AuthMiddleware.
+func AdminMiddleware(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cfg.IsAdmin(PhoneNumberFromContext(c)) {
+			response.AbortWithError(c, http.StatusForbidden, response.ErrorResponse{Error: "Admin access required", Code: ErrCodeAdminRequired})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// PhoneMaskingMiddleware asks for masked phone numbers in user responses when
+// masking is enabled and the caller is not an admin. It must run after
+// AuthMiddleware.
+func PhoneMaskingMiddleware(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.Privacy.MaskPhoneNumbers && !cfg.IsAdmin(PhoneNumberFromContext(c)) {
+			c.Request = c.Request.WithContext(models.ContextWithMaskedPhones(c.Request.Context()))
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"otp/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	APIVersionHeader             = "X-API-Version"
+	ErrCodeUnsupportedAPIVersion = "UNSUPPORTED_API_VERSION"
+)
+
+// vendorMediaType matches application/vnd.otp+json, optionally carrying a
+// version such as application/vnd.otp.v2+json
+var vendorMediaType = regexp.MustCompile(`^application/vnd\.otp(?:\.v(\d+))?\+json$`)
+
+// APIVersionMiddleware negotiates the API version from the Accept header so
+// clients can select newer behavior without changing the base URL. Requests
+// without a vendor media type get defaultVersion. The version is stored as
+// "api_version" in the context and echoed in the X-API-Version header;
+// versions other than defaultVersion and supported are rejected with 406.
+func APIVersionMiddleware(defaultVersion int, supported ...int) gin.HandlerFunc {
+	allowed := map[int]bool{defaultVersion: true}
+	for _, version := range supported {
+		allowed[version] = true
+	}
+
+	return func(c *gin.Context) {
+		version, ok := parseAPIVersion(c.GetHeader("Accept"))
+		if !ok {
+			version = defaultVersion
+		}
+
+		if !allowed[version] {
+			response.AbortWithError(c, http.StatusNotAcceptable, response.ErrorResponse{
+				Error: fmt.Sprintf("API version %d is not supported", version),
+				Code:  ErrCodeUnsupportedAPIVersion,
+			})
+			return
+		}
+
+		c.Set("api_version", version)
+		c.Header(APIVersionHeader, strconv.Itoa(version))
+		c.Writer.Header().Add("Vary", "Accept")
+
+		c.Next()
+	}
+}
+
+// parseAPIVersion returns the version requested by the first vendor media
+// type in an Accept header. A vendor media type without a version reports
+// false so the default applies.
+func parseAPIVersion(accept string) (int, bool) {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		match := vendorMediaType.FindStringSubmatch(strings.ToLower(strings.TrimSpace(mediaType)))
+		if match == nil {
+			continue
+		}
+		if match[1] == "" {
+			return 0, false
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return 0, false
+		}
+		return version, true
+	}
+	return 0, false
+}
+
+// APIVersion returns the version negotiated by APIVersionMiddleware, or 0
+// if the middleware did not run.
+func APIVersion(c *gin.Context) int {
+	return c.GetInt("api_version")
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIVersionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		accept         string
+		expectedStatus int
+		expectedVer    int
+	}{
+		{"no accept header", "", http.StatusOK, 1},
+		{"plain json", "application/json", http.StatusOK, 1},
+		{"unversioned vendor type", "application/vnd.otp+json", http.StatusOK, 1},
+		{"explicit v1", "application/vnd.otp.v1+json", http.StatusOK, 1},
+		{"v2 supported", "application/json;q=0.5, application/vnd.otp.v2+json", http.StatusOK, 2},
+		{"unsupported version", "application/vnd.otp.v3+json", http.StatusNotAcceptable, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen int
+			router := gin.New()
+			router.GET("/", APIVersionMiddleware(1, 2), func(c *gin.Context) {
+				seen = APIVersion(c)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if seen != tt.expectedVer {
+				t.Errorf("Expected version %d, got %d", tt.expectedVer, seen)
+			}
+			if tt.expectedStatus == http.StatusOK && w.Header().Get(APIVersionHeader) == "" {
+				t.Error("Expected X-API-Version header to be set")
+			}
+		})
+	}
+}
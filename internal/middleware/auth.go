@@ -1,46 +1,181 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"otp/internal/models"
+	"otp/internal/response"
 	"otp/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	ErrCodeMissingToken             = "MISSING_TOKEN"
+	ErrCodeInvalidToken             = "INVALID_TOKEN"
+	ErrCodeStepUpRequired           = "STEP_UP_REQUIRED"
+	ErrCodeAccountSuspended         = "ACCOUNT_SUSPENDED"
+	ErrCodeAccountStatusUnavailable = "ACCOUNT_STATUS_UNAVAILABLE"
+)
+
+// maxAuthorizationHeaderBytes bounds the Authorization header. Tokens this
+// service issues are a few hundred bytes, so anything near this is an attack.
+const maxAuthorizationHeaderBytes = 4096
+
+// ContextKey is a key AuthMiddleware sets on the gin.Context. The values are
+// prefixed with "otp." so they can't collide with keys of other middleware
+// when this service is embedded in a larger app. Read them through
+// ClaimsFromContext and its siblings rather than directly.
+type ContextKey string
+
+const (
+	ContextKeyClaims ContextKey = "otp.claims"
+)
+
+// ClaimsFromContext returns the claims of the token AuthMiddleware accepted,
+// or false if it did not run
+func ClaimsFromContext(c *gin.Context) (*models.Claims, bool) {
+	value, _ := c.Get(string(ContextKeyClaims))
+	claims, ok := value.(*models.Claims)
+	return claims, ok && claims != nil
+}
+
+// SetClaims stores claims as AuthMiddleware does, for tests and for apps
+// that authenticate requests their own way
+func SetClaims(c *gin.Context, claims *models.Claims) {
+	c.Set(string(ContextKeyClaims), claims)
+}
+
+// UserIDFromContext returns the authenticated user's ID, or "" if
+// AuthMiddleware did not run or the token has none (verify-only mode)
+func UserIDFromContext(c *gin.Context) string {
+	if claims, ok := ClaimsFromContext(c); ok {
+		return claims.UserID
+	}
+	return ""
+}
+
+// PhoneNumberFromContext returns the authenticated phone number, or "" if
+// AuthMiddleware did not run
+func PhoneNumberFromContext(c *gin.Context) string {
+	if claims, ok := ClaimsFromContext(c); ok {
+		return claims.PhoneNumber
+	}
+	return ""
+}
+
 func AuthMiddleware(authService services.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			c.Abort()
+		header := c.GetHeader("Authorization")
+		if len(header) > maxAuthorizationHeaderBytes {
+			abortUnauthorized(c, "Invalid authorization header format", ErrCodeInvalidToken)
 			return
 		}
 
-		// Check if the header starts with "Bearer "
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+		// Split "<scheme> <token>", tolerating surrounding and repeated whitespace
+		fields := strings.Fields(header)
+		if len(fields) == 0 {
+			abortUnauthorized(c, "Authorization header is required", ErrCodeMissingToken)
 			return
 		}
 
-		// Extract the token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		// The scheme is case-insensitive per RFC 6750
+		if !strings.EqualFold(fields[0], "Bearer") {
+			abortUnauthorized(c, "Invalid authorization header format", ErrCodeInvalidToken)
+			return
+		}
+
+		if len(fields) == 1 {
+			abortUnauthorized(c, "Bearer token is required", ErrCodeMissingToken)
+			return
+		}
+
+		if len(fields) > 2 {
+			abortUnauthorized(c, "Invalid authorization header format", ErrCodeInvalidToken)
+			return
+		}
 
-		// Validate the token
-		claims, err := authService.ValidateToken(tokenString)
+		// Validate the token, rejecting anything not shaped like a JWT unparsed
+		if !wellFormedJWT(fields[1]) {
+			abortUnauthorized(c, "Invalid or expired token", ErrCodeInvalidToken)
+			return
+		}
+		claims, err := validateToken(authService, fields[1])
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+			abortUnauthorized(c, "Invalid or expired token", ErrCodeInvalidToken)
+			return
+		}
+
+		// Reject tokens of users suspended or deleted since issuance
+		if err := authService.CheckAccountStatus(c.Request.Context(), claims.UserID); err != nil {
+			switch {
+			case errors.Is(err, services.ErrAccountSuspended):
+				response.AbortWithError(c, http.StatusForbidden, response.ErrorResponse{Error: "Account is suspended", Code: ErrCodeAccountSuspended})
+			case errors.Is(err, services.ErrUserNotFound):
+				abortUnauthorized(c, "Invalid or expired token", ErrCodeInvalidToken)
+			default:
+				response.AbortWithError(c, http.StatusServiceUnavailable, response.ErrorResponse{Error: "Failed to verify account status", Code: ErrCodeAccountStatusUnavailable})
+			}
 			return
 		}
 
-		// Set user information in context
-		c.Set("user_id", claims.UserID)
-		c.Set("phone_number", claims.PhoneNumber)
-		c.Set("claims", claims)
+		SetClaims(c, claims)
 
 		c.Next()
 	}
 }
+
+// RequireRecentAuth rejects tokens issued more than maxAge ago, so that
+// sensitive changes need a fresh OTP login. It must run after AuthMiddleware.
+func RequireRecentAuth(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := ClaimsFromContext(c)
+		if !ok || claims.AuthenticatedAt().IsZero() || time.Since(claims.AuthenticatedAt()) > maxAge {
+			abortUnauthorized(c, "Recent authentication required, please log in again", ErrCodeStepUpRequired)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// wellFormedJWT reports whether token has the shape of a signed compact JWT:
+// three non-empty base64url segments separated by dots
+func wellFormedJWT(token string) bool {
+	segments, length := 1, 0
+	for i := 0; i < len(token); i++ {
+		switch b := token[i]; {
+		case b == '.':
+			if length == 0 {
+				return false
+			}
+			segments++
+			length = 0
+		case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b >= '0' && b <= '9', b == '-', b == '_':
+			length++
+		default:
+			return false
+		}
+	}
+	return segments == 3 && length > 0
+}
+
+// validateToken calls authService.ValidateToken, turning a panic on hostile
+// input into an error so the request gets a 401 rather than a 500
+func validateToken(authService services.AuthService, token string) (claims *models.Claims, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("SECURITY: recovered from panic validating token: %v", recovered)
+			claims, err = nil, errors.New("invalid token")
+		}
+	}()
+	return authService.ValidateToken(token)
+}
+
+func abortUnauthorized(c *gin.Context, message, code string) {
+	response.AbortWithError(c, http.StatusUnauthorized, response.ErrorResponse{Error: message, Code: code})
+}
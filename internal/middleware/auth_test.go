@@ -0,0 +1,363 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"otp/internal/i18n"
+	"otp/internal/models"
+	"otp/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type mockAuthService struct{}
+
+func (m *mockAuthService) GenerateOTP(ctx context.Context, phoneNumber string) (*models.OTPResponse, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) ResendCooldown(ctx context.Context, phoneNumber string) (time.Duration, error) {
+	return 0, nil
+}
+
+func (m *mockAuthService) VerifyOTP(ctx context.Context, verification models.OTPVerification) (*models.AuthResponse, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) CancelOTP(ctx context.Context, phoneNumber string) error {
+	return nil
+}
+
+func (m *mockAuthService) RequestPhoneChange(ctx context.Context, userID string, request models.PhoneChangeRequest) (*models.OTPResponse, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) ConfirmPhoneChange(ctx context.Context, userID string, confirmation models.PhoneChangeConfirmation) (*models.AuthResponse, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) RequestRecoveryPhone(ctx context.Context, userID string, request models.RecoveryPhoneRequest) (*models.OTPResponse, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) ConfirmRecoveryPhone(ctx context.Context, userID string, confirmation models.RecoveryPhoneConfirmation) (*models.UserResponse, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) RemoveRecoveryPhone(ctx context.Context, userID string) (*models.UserResponse, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) RequestAccountRecovery(ctx context.Context, request models.RecoveryPhoneRequest) (*models.OTPResponse, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) RecoverAccount(ctx context.Context, confirmation models.AccountRecoveryConfirmation) (*models.AccountRecoveryResponse, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) RefreshClaims(ctx context.Context, claims *models.Claims) (*models.AuthResponse, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) CheckAccountStatus(ctx context.Context, userID string) error {
+	return nil
+}
+
+func (m *mockAuthService) ResetRateLimits(ctx context.Context, userID string) (*models.RateLimitReset, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) DeleteExpiredOTPs(ctx context.Context) (*models.OTPCleanup, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) ValidateToken(tokenString string) (*models.Claims, error) {
+	switch tokenString {
+	case "test.valid.token":
+		return &models.Claims{UserID: "user-1", PhoneNumber: "+1234567890"}, nil
+	case "test.fresh.token":
+		return &models.Claims{UserID: "user-1", PhoneNumber: "+1234567890", Iat: time.Now().Unix()}, nil
+	case "test.stale.token":
+		return &models.Claims{UserID: "user-1", PhoneNumber: "+1234567890", Iat: time.Now().Add(-time.Hour).Unix()}, nil
+	case "test.panic.token":
+		panic("parser bug")
+	}
+	return nil, errors.New("invalid token")
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantCode   string
+	}{
+		{"missing header", "", http.StatusUnauthorized, ErrCodeMissingToken},
+		{"whitespace only", "   ", http.StatusUnauthorized, ErrCodeMissingToken},
+		{"scheme without token", "Bearer", http.StatusUnauthorized, ErrCodeMissingToken},
+		{"scheme with trailing space", "Bearer ", http.StatusUnauthorized, ErrCodeMissingToken},
+		{"no scheme", "test.valid.token", http.StatusUnauthorized, ErrCodeInvalidToken},
+		{"wrong scheme", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, ErrCodeInvalidToken},
+		{"too many parts", "Bearer test.valid.token extra", http.StatusUnauthorized, ErrCodeInvalidToken},
+		{"invalid token", "Bearer not-a-token", http.StatusUnauthorized, ErrCodeInvalidToken},
+		{"valid token", "Bearer test.valid.token", http.StatusOK, ""},
+		{"lowercase scheme", "bearer test.valid.token", http.StatusOK, ""},
+		{"uppercase scheme", "BEARER test.valid.token", http.StatusOK, ""},
+		{"extra whitespace", "  Bearer    test.valid.token  ", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", AuthMiddleware(&mockAuthService{}), func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"user_id": UserIDFromContext(c)})
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Expected JSON body, got %s", w.Body.String())
+			}
+			if body["code"] != tt.wantCode {
+				t.Errorf("Expected code %q, got %q", tt.wantCode, body["code"])
+			}
+			if tt.wantStatus == http.StatusOK && body["user_id"] != "user-1" {
+				t.Errorf("Expected user_id to be set, got %q", body["user_id"])
+			}
+		})
+	}
+}
+
+// countingAuthService records the tokens that reach ValidateToken
+type countingAuthService struct {
+	mockAuthService
+	validated []string
+}
+
+func (m *countingAuthService) ValidateToken(tokenString string) (*models.Claims, error) {
+	m.validated = append(m.validated, tokenString)
+	return m.mockAuthService.ValidateToken(tokenString)
+}
+
+func TestAuthMiddleware_MalformedTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		header       string
+		wantCode     string
+		wantValidate bool
+	}{
+		{"empty token segments", "Bearer ..", ErrCodeInvalidToken, false},
+		{"one segment", "Bearer abc", ErrCodeInvalidToken, false},
+		{"two segments", "Bearer abc.def", ErrCodeInvalidToken, false},
+		{"missing payload", "Bearer abc..ghi", ErrCodeInvalidToken, false},
+		{"missing signature", "Bearer abc.def.", ErrCodeInvalidToken, false},
+		{"four segments", "Bearer abc.def.ghi.jkl", ErrCodeInvalidToken, false},
+		{"padding", "Bearer abc=.def.ghi", ErrCodeInvalidToken, false},
+		{"standard base64", "Bearer ab+/.def.ghi", ErrCodeInvalidToken, false},
+		{"non-ASCII", "Bearer tést.valid.token", ErrCodeInvalidToken, false},
+		{"invalid UTF-8", "Bearer \xff\xfe.valid.token", ErrCodeInvalidToken, false},
+		{"control characters", "Bearer test.val\x00id.token", ErrCodeInvalidToken, false},
+		{"huge token", "Bearer " + strings.Repeat("a", 3000) + "." + strings.Repeat("b", 3000) + ".c", ErrCodeInvalidToken, false},
+		{"huge header", "Bearer test.valid.token" + strings.Repeat(" ", maxAuthorizationHeaderBytes), ErrCodeInvalidToken, false},
+		{"deeply nested payload", "Bearer eyJhbGciOiJIUzI1NiJ9." + strings.Repeat("W3t", 1000) + ".c2ln", ErrCodeInvalidToken, true},
+		{"well-formed but unknown", "Bearer test.invalid.token", ErrCodeInvalidToken, true},
+		{"validator panics", "Bearer test.panic.token", ErrCodeInvalidToken, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authService := &countingAuthService{}
+			router := gin.New()
+			router.GET("/", AuthMiddleware(authService), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", tt.header)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+			}
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Expected JSON body, got %s", w.Body.String())
+			}
+			if body["code"] != tt.wantCode {
+				t.Errorf("Expected code %q, got %q", tt.wantCode, body["code"])
+			}
+			if validated := len(authService.validated) > 0; validated != tt.wantValidate {
+				t.Errorf("Expected token to reach ValidateToken: %v, got %v", tt.wantValidate, validated)
+			}
+		})
+	}
+}
+
+func TestClaimsFromContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/me", AuthMiddleware(&mockAuthService{}), func(c *gin.Context) {
+		claims, ok := ClaimsFromContext(c)
+		if !ok || claims.UserID != "user-1" {
+			t.Errorf("Expected the token's claims, got %+v, %v", claims, ok)
+		}
+		if UserIDFromContext(c) != "user-1" || PhoneNumberFromContext(c) != "+1234567890" {
+			t.Errorf("Expected user-1 and +1234567890, got %q and %q", UserIDFromContext(c), PhoneNumberFromContext(c))
+		}
+		// Nothing is stored under bare keys other middleware might use
+		for _, key := range []string{"claims", "user", "user_id", "phone_number"} {
+			if _, exists := c.Get(key); exists {
+				t.Errorf("Expected no value under %q", key)
+			}
+		}
+	})
+	router.GET("/public", func(c *gin.Context) {
+		// Another middleware's value under the same bare name is ignored
+		c.Set("claims", "not ours")
+		if claims, ok := ClaimsFromContext(c); ok {
+			t.Errorf("Expected no claims without AuthMiddleware, got %+v", claims)
+		}
+		if UserIDFromContext(c) != "" {
+			t.Errorf("Expected no user ID without AuthMiddleware, got %q", UserIDFromContext(c))
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer test.valid.token")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/public", nil))
+}
+
+func TestRequireRecentAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{"fresh token", "test.fresh.token", http.StatusOK},
+		{"stale token", "test.stale.token", http.StatusUnauthorized},
+		{"token without issued at", "test.valid.token", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", AuthMiddleware(&mockAuthService{}), RequireRecentAuth(10*time.Minute), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && !strings.Contains(w.Body.String(), ErrCodeStepUpRequired) {
+				t.Errorf("Expected %s code, got %s", ErrCodeStepUpRequired, w.Body.String())
+			}
+		})
+	}
+}
+
+// statusAuthService reports err from every account status check
+type statusAuthService struct {
+	mockAuthService
+	err error
+}
+
+func (s *statusAuthService) CheckAccountStatus(ctx context.Context, userID string) error {
+	return s.err
+}
+
+func TestAuthMiddleware_AccountStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"active", nil, http.StatusOK, ""},
+		{"suspended", services.ErrAccountSuspended, http.StatusForbidden, ErrCodeAccountSuspended},
+		{"deleted", services.ErrUserNotFound, http.StatusUnauthorized, ErrCodeInvalidToken},
+		{"status unavailable", errors.New("connection refused"), http.StatusServiceUnavailable, ErrCodeAccountStatusUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(AuthMiddleware(&statusAuthService{err: tt.err}))
+			router.GET("/test", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Authorization", "Bearer test.valid.token")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if body["code"] != tt.wantCode || body["message"] == "" {
+				t.Errorf("Expected code %q with a message, got %v", tt.wantCode, body)
+			}
+		})
+	}
+}
+
+func TestErrorCodesHaveMessages(t *testing.T) {
+	codes := []string{
+		ErrCodeMissingToken,
+		ErrCodeInvalidToken,
+		ErrCodeStepUpRequired,
+		ErrCodeAccountSuspended,
+		ErrCodeAccountStatusUnavailable,
+		ErrCodeAdminRequired,
+		ErrCodeUnsupportedAPIVersion,
+		ErrCodeFeatureDisabled,
+		ErrCodeHTTPSRequired,
+		ErrCodeServiceDegraded,
+		ErrCodeMaintenance,
+		ErrCodeRateLimited,
+	}
+	for _, code := range codes {
+		if i18n.Message(i18n.DefaultLocale, code) == "" {
+			t.Errorf("No message for error code %s", code)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDebugBodyBytes caps how much of each body is captured for debug logs
+const maxDebugBodyBytes = 4096
+
+const redactedValue = "[REDACTED]"
+
+// DebugLogOptions configures DebugLogMiddleware
+type DebugLogOptions struct {
+	// Routes limits logging to routes whose path template starts with one of
+	// these prefixes (e.g. "/api/v1/auth/otp"). Empty logs every route.
+	Routes []string
+	// CaptureBodies adds the request and response bodies to each entry
+	CaptureBodies bool
+	// RedactFields are JSON field names whose values are replaced before a
+	// body is logged, at any depth. Matching ignores case and underscores,
+	// so "phone_number" also covers camelCase "phoneNumber".
+	RedactFields []string
+}
+
+// DebugLogMiddleware logs the method, path, status and latency of each
+// matching request, and optionally its bodies with sensitive fields
+// redacted. Bodies that are not JSON are never logged, since they cannot be
+// redacted. It is meant for debugging client integrations, not for routine
+// request logging.
+func DebugLogMiddleware(opts DebugLogOptions) gin.HandlerFunc {
+	redact := make(map[string]bool, len(opts.RedactFields))
+	for _, field := range opts.RedactFields {
+		redact[normalizeFieldName(field)] = true
+	}
+
+	return func(c *gin.Context) {
+		if !debugLogRoute(opts.Routes, c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		var requestBody []byte
+		var responseBody *limitedBuffer
+		if opts.CaptureBodies {
+			if c.Request.Body != nil {
+				requestBody, _ = io.ReadAll(io.LimitReader(c.Request.Body, maxDebugBodyBytes))
+				c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(requestBody), c.Request.Body), c.Request.Body}
+			}
+			responseBody = &limitedBuffer{}
+			c.Writer = &teeResponseWriter{ResponseWriter: c.Writer, body: responseBody}
+		}
+
+		start := time.Now()
+		c.Next()
+		latency := time.Since(start)
+
+		entry := fmt.Sprintf("%s | %s %s | %d | %v", c.GetString("request_id"), c.Request.Method, c.Request.URL.Path, c.Writer.Status(), latency)
+		if opts.CaptureBodies {
+			entry += " | request=" + redactJSONBody(requestBody, redact) + " | response=" + redactJSONBody(responseBody.Bytes(), redact)
+		}
+		log.Printf("DEBUG: %s", entry)
+	}
+}
+
+func debugLogRoute(routes []string, fullPath string) bool {
+	if len(routes) == 0 {
+		return true
+	}
+	for _, route := range routes {
+		if strings.HasPrefix(fullPath, route) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactJSONBody renders body for a log line with the redacted fields'
+// values replaced
+func redactJSONBody(body []byte, redact map[string]bool) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return "-"
+	}
+	if len(body) >= maxDebugBodyBytes {
+		return "[body too large to log]"
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return "[non-JSON body omitted]"
+	}
+	encoded, err := json.Marshal(redactValue(value, redact))
+	if err != nil {
+		return "[non-JSON body omitted]"
+	}
+	return string(encoded)
+}
+
+func redactValue(value interface{}, redact map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if redact[normalizeFieldName(key)] {
+				v[key] = redactedValue
+			} else {
+				v[key] = redactValue(field, redact)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item, redact)
+		}
+	}
+	return value
+}
+
+func normalizeFieldName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// limitedBuffer keeps the first maxDebugBodyBytes bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := maxDebugBodyBytes - b.Len(); remaining > 0 {
+		if len(p) > remaining {
+			b.Buffer.Write(p[:remaining])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// teeResponseWriter copies the response body into body as it is written
+type teeResponseWriter struct {
+	gin.ResponseWriter
+	body *limitedBuffer
+}
+
+func (w *teeResponseWriter) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *teeResponseWriter) WriteString(s string) (int, error) {
+	w.body.Write([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// readCloser replays the captured prefix of a request body before the rest,
+// closing the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
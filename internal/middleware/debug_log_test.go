@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDebugLogMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	router := gin.New()
+	router.Use(DebugLogMiddleware(DebugLogOptions{
+		Routes:        []string{"/auth/otp"},
+		CaptureBodies: true,
+		RedactFields:  []string{"code", "phone_number", "token"},
+	}))
+	var received string
+	router.POST("/auth/otp/verify", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		received = string(body)
+		c.JSON(http.StatusOK, gin.H{"token": "secret-jwt", "user": gin.H{"id": "u1", "phoneNumber": "+1234567890"}})
+	})
+	router.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	requestBody := `{"phone_number":"+1234567890","code":"123456","device":"ios"}`
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/auth/otp/verify", strings.NewReader(requestBody)))
+
+	if received != requestBody {
+		t.Errorf("Expected the handler to read the full body, got %q", received)
+	}
+	line := logs.String()
+	for _, secret := range []string{"+1234567890", "123456", "secret-jwt"} {
+		if strings.Contains(line, secret) {
+			t.Errorf("Expected %q to be redacted, got %s", secret, line)
+		}
+	}
+	for _, want := range []string{"DEBUG:", "POST /auth/otp/verify", "| 200 |", `"device":"ios"`, `"id":"u1"`, `"phoneNumber":"[REDACTED]"`} {
+		if !strings.Contains(line, want) {
+			t.Errorf("Expected log to contain %q, got %s", want, line)
+		}
+	}
+
+	logs.Reset()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	if logs.Len() != 0 {
+		t.Errorf("Expected routes outside the prefixes not to be logged, got %s", logs.String())
+	}
+}
+
+func TestRedactJSONBody_NonJSON(t *testing.T) {
+	if got := redactJSONBody([]byte("phone=+1234567890"), map[string]bool{"phone": true}); got != "[non-JSON body omitted]" {
+		t.Errorf("Expected non-JSON bodies to be omitted, got %q", got)
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"otp/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ErrCodeServiceDegraded = "SERVICE_DEGRADED"
+
+// HealthChecker reports whether a dependency needed for writes is available
+type HealthChecker interface {
+	Healthy() bool
+}
+
+// DegradedMiddleware fails write requests, including every sign-in attempt,
+// fast with 503 while primary is unhealthy instead of letting them time out.
+// Safe methods still pass so reads served by a replica keep working.
+func DegradedMiddleware(primary HealthChecker, retryAfter time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if primary.Healthy() || isSafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+		response.AbortWithError(c, http.StatusServiceUnavailable, response.ErrorResponse{
+			Error: "Service is degraded; sign-in and changes are temporarily unavailable",
+			Code:  ErrCodeServiceDegraded,
+		})
+	}
+}
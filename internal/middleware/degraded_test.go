@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type stubHealth struct {
+	healthy bool
+}
+
+func (h *stubHealth) Healthy() bool {
+	return h.healthy
+}
+
+func TestDegradedMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	primary := &stubHealth{healthy: true}
+	router := gin.New()
+	router.Use(DegradedMiddleware(primary, 10*time.Second))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/users", ok)
+	router.POST("/auth/otp/verify", ok)
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := request(http.MethodPost, "/auth/otp/verify"); w.Code != http.StatusOK {
+		t.Errorf("Expected writes to pass while healthy, got %d", w.Code)
+	}
+
+	primary.healthy = false
+
+	w := request(http.MethodPost, "/auth/otp/verify")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), ErrCodeServiceDegraded) {
+		t.Errorf("Expected %s code, got %s", ErrCodeServiceDegraded, w.Body.String())
+	}
+	if got := w.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("Expected Retry-After 10, got %q", got)
+	}
+
+	if w := request(http.MethodGet, "/users"); w.Code != http.StatusOK {
+		t.Errorf("Expected reads to pass while degraded, got %d", w.Code)
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+
+	"otp/internal/config"
+	"otp/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ErrCodeFeatureDisabled = "FEATURE_DISABLED"
+
+// RequireFeature hides a route behind a feature flag, responding 404 as if
+// the route didn't exist while the feature is disabled.
+func RequireFeature(cfg *config.Config, feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cfg.FeatureEnabled(feature) {
+			response.AbortWithError(c, http.StatusNotFound, response.ErrorResponse{Error: "Not found", Code: ErrCodeFeatureDisabled})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"otp/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ErrCodeHTTPSRequired = "HTTPS_REQUIRED"
+
+// ParseTrustedProxies parses proxy addresses and CIDR ranges, such as
+// "10.0.0.0/8" or "127.0.0.1"
+func ParseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// RequireHTTPSMiddleware rejects requests that did not reach the service
+// over HTTPS with 426 Upgrade Required. A request counts as HTTPS if it was
+// served over TLS directly, or if it came from one of trustedProxies and the
+// proxy reported https in X-Forwarded-Proto or the proto of a Forwarded
+// header. These headers are ignored from any other peer, since clients can
+// set them freely.
+func RequireHTTPSMiddleware(trustedProxies []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS != nil || (trustedPeer(c, trustedProxies) && forwardedHTTPS(c.Request)) {
+			c.Next()
+			return
+		}
+
+		c.Header("Upgrade", "TLS/1.2, HTTP/1.1")
+		response.AbortWithError(c, http.StatusUpgradeRequired, response.ErrorResponse{
+			Error: "HTTPS is required",
+			Code:  ErrCodeHTTPSRequired,
+		})
+	}
+}
+
+// HTTPSRedirectHandler permanently redirects every request to the same host
+// and path over HTTPS on httpsPort. 308 is used so clients repeat POSTs with
+// their body rather than turning them into GETs.
+func HTTPSRedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = hostname
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), httpsPort)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
+
+func trustedPeer(c *gin.Context, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHTTPS reports whether the trusted proxy in front of the service
+// saw HTTPS. Proxies append to these headers, and everything before the
+// last entry may have come from the client, so only the last one counts.
+func forwardedHTTPS(r *http.Request) bool {
+	if proto := lastForwardedEntry(r.Header.Values("X-Forwarded-Proto")); proto != "" {
+		return strings.EqualFold(proto, "https")
+	}
+
+	if forwarded := lastForwardedEntry(r.Header.Values("Forwarded")); forwarded != "" {
+		for _, pair := range strings.Split(forwarded, ";") {
+			key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if found && strings.EqualFold(key, "proto") {
+				return strings.EqualFold(strings.Trim(value, `"`), "https")
+			}
+		}
+	}
+	return false
+}
+
+// lastForwardedEntry returns the last comma-separated entry across the lines
+// of a forwarding header, or "" if there is none
+func lastForwardedEntry(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	last := values[len(values)-1]
+	if i := strings.LastIndex(last, ","); i >= 0 {
+		last = last[i+1:]
+	}
+	return strings.TrimSpace(last)
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireHTTPSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+	router := gin.New()
+	router.Use(RequireHTTPSMiddleware(proxies))
+	router.POST("/auth/otp/verify", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		tls        bool
+		want       int
+	}{
+		{"X-Forwarded-Proto https", "10.1.2.3:5000", map[string]string{"X-Forwarded-Proto": "https"}, false, http.StatusOK},
+		{"X-Forwarded-Proto uppercase", "127.0.0.1:5000", map[string]string{"X-Forwarded-Proto": "HTTPS"}, false, http.StatusOK},
+		{"X-Forwarded-Proto chain ending in https", "10.1.2.3:5000", map[string]string{"X-Forwarded-Proto": "http, https"}, false, http.StatusOK},
+		{"X-Forwarded-Proto spoofed by client", "10.1.2.3:5000", map[string]string{"X-Forwarded-Proto": "https, http"}, false, http.StatusUpgradeRequired},
+		{"X-Forwarded-Proto http", "10.1.2.3:5000", map[string]string{"X-Forwarded-Proto": "http"}, false, http.StatusUpgradeRequired},
+		{"Forwarded proto https", "10.1.2.3:5000", map[string]string{"Forwarded": `for=203.0.113.7;proto=https`}, false, http.StatusOK},
+		{"Forwarded quoted proto", "10.1.2.3:5000", map[string]string{"Forwarded": `for=10.0.0.1;proto=http, for="[2001:db8::1]";proto="https"`}, false, http.StatusOK},
+		{"Forwarded spoofed by client", "10.1.2.3:5000", map[string]string{"Forwarded": `proto=https, for=203.0.113.7;proto=http`}, false, http.StatusUpgradeRequired},
+		{"Forwarded proto http", "10.1.2.3:5000", map[string]string{"Forwarded": "proto=http"}, false, http.StatusUpgradeRequired},
+		{"no header", "10.1.2.3:5000", nil, false, http.StatusUpgradeRequired},
+		{"untrusted peer claiming https", "203.0.113.7:5000", map[string]string{"X-Forwarded-Proto": "https"}, false, http.StatusUpgradeRequired},
+		{"direct TLS", "203.0.113.7:5000", nil, true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/auth/otp/verify", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, w.Code)
+			}
+			if w.Code == http.StatusUpgradeRequired && w.Header().Get("Upgrade") == "" {
+				t.Error("Expected an Upgrade header on 426 responses")
+			}
+		})
+	}
+}
+
+func TestForwardedHTTPS_RepeatedHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Proto", "http")
+	if forwardedHTTPS(req) {
+		t.Error("Expected the last header line to decide")
+	}
+
+	req.Header.Add("X-Forwarded-Proto", "https")
+	if !forwardedHTTPS(req) {
+		t.Error("Expected https from the last header line")
+	}
+}
+
+func TestParseTrustedProxies_Invalid(t *testing.T) {
+	if _, err := ParseTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Error("Expected an error for an invalid address")
+	}
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/99"}); err == nil {
+		t.Error("Expected an error for an invalid range")
+	}
+}
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		httpsPort string
+		host      string
+		target    string
+		want      string
+	}{
+		{"8443", "example.com:8080", "/api/v1/features?x=1", "https://example.com:8443/api/v1/features?x=1"},
+		{"443", "example.com", "/health", "https://example.com/health"},
+		{"8443", "[2001:db8::1]:8080", "/health", "https://[2001:db8::1]:8443/health"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.target, nil)
+		req.Host = tt.host
+		w := httptest.NewRecorder()
+		HTTPSRedirectHandler(tt.httpsPort).ServeHTTP(w, req)
+
+		if w.Code != http.StatusPermanentRedirect {
+			t.Errorf("Expected status %d, got %d", http.StatusPermanentRedirect, w.Code)
+		}
+		if location := w.Header().Get("Location"); location != tt.want {
+			t.Errorf("Expected redirect to %s, got %s", tt.want, location)
+		}
+	}
+}
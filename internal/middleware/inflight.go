@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"otp/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InFlightMiddleware tracks the number of requests currently being served in
+// gauge, so shutdown can report how many are still draining.
+func InFlightMiddleware(gauge *metrics.Gauge) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gauge.Inc()
+		defer gauge.Dec()
+
+		c.Next()
+	}
+}
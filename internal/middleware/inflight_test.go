@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"otp/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInFlightMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	gauge := metrics.NewGauge("http_inflight_requests", "")
+	var during int64
+	router := gin.New()
+	router.GET("/", InFlightMiddleware(gauge), func(c *gin.Context) {
+		during = gauge.Value()
+		c.Status(http.StatusOK)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if during != 1 {
+		t.Errorf("Expected 1 request in flight while handling, got %d", during)
+	}
+	if gauge.Value() != 0 {
+		t.Errorf("Expected 0 requests in flight afterwards, got %d", gauge.Value())
+	}
+}
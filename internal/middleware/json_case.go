@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"mime"
+	"strings"
+
+	"otp/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JSON field naming styles for response bodies
+const (
+	JSONCaseSnake = "snake"
+	JSONCaseCamel = "camel"
+)
+
+// JSON timestamp formats for response bodies
+const (
+	JSONTimeRFC3339 = config.JSONTimeFormatRFC3339
+	JSONTimeUnix    = config.JSONTimeFormatUnix
+)
+
+// Accept profile tokens and the style or format each selects
+var (
+	jsonCaseProfiles = map[string]string{
+		"camelcase":  JSONCaseCamel,
+		"camel":      JSONCaseCamel,
+		"snake_case": JSONCaseSnake,
+		"snake":      JSONCaseSnake,
+	}
+	jsonTimeProfiles = map[string]string{
+		"epoch":   JSONTimeUnix,
+		"unix":    JSONTimeUnix,
+		"rfc3339": JSONTimeRFC3339,
+	}
+)
+
+// JSONCaseMiddleware picks the field naming style for response bodies. A
+// client selects one with a profile parameter in its Accept header, e.g.
+// `Accept: application/json; profile="camelCase"`; others get defaultCase.
+// The style is stored as "json_case" in the context.
+func JSONCaseMiddleware(defaultCase string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jsonCase, ok := parseProfile(c.GetHeader("Accept"), jsonCaseProfiles)
+		if !ok {
+			jsonCase = defaultCase
+		}
+
+		c.Set("json_case", jsonCase)
+		varyOnAccept(c)
+
+		c.Next()
+	}
+}
+
+// JSONTimeFormatMiddleware picks how timestamps in response bodies are
+// written: RFC 3339 strings or Unix seconds. Clients select one with a
+// profile token in their Accept header, e.g. `profile="epoch"`, which can
+// be combined with a naming style as `profile="camelCase epoch"`; others
+// get defaultFormat, which may also be any of the profile tokens. The format
+// is stored as "json_time_format" in the context.
+func JSONTimeFormatMiddleware(defaultFormat string) gin.HandlerFunc {
+	if format, ok := jsonTimeProfiles[strings.ToLower(defaultFormat)]; ok {
+		defaultFormat = format
+	}
+	return func(c *gin.Context) {
+		format, ok := parseProfile(c.GetHeader("Accept"), jsonTimeProfiles)
+		if !ok {
+			format = defaultFormat
+		}
+
+		c.Set("json_time_format", format)
+		varyOnAccept(c)
+
+		c.Next()
+	}
+}
+
+// varyOnAccept adds Accept to the Vary header, unless another negotiation
+// middleware already has
+func varyOnAccept(c *gin.Context) {
+	for _, value := range c.Writer.Header().Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), "Accept") {
+				return
+			}
+		}
+	}
+	c.Writer.Header().Add("Vary", "Accept")
+}
+
+// parseProfile returns the value of the first token in profiles found in the
+// profile parameter of an Accept header's media types. A profile may list
+// several whitespace-separated tokens.
+func parseProfile(accept string, profiles map[string]string) (string, bool) {
+	for _, part := range strings.Split(accept, ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		for _, token := range strings.Fields(params["profile"]) {
+			if value, ok := profiles[strings.ToLower(token)]; ok {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// JSONCase returns the style negotiated by JSONCaseMiddleware, defaulting to
+// snake case if the middleware did not run.
+func JSONCase(c *gin.Context) string {
+	if jsonCase := c.GetString("json_case"); jsonCase != "" {
+		return jsonCase
+	}
+	return JSONCaseSnake
+}
+
+// JSONTimeFormat returns the format negotiated by JSONTimeFormatMiddleware,
+// defaulting to RFC 3339 if the middleware did not run.
+func JSONTimeFormat(c *gin.Context) string {
+	if format := c.GetString("json_time_format"); format != "" {
+		return format
+	}
+	return JSONTimeRFC3339
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"otp/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ErrCodeMaintenance = "MAINTENANCE"
+
+// MaintenanceMode is the process-wide maintenance switch. It is kept in
+// memory, so a runtime toggle does not survive a restart and applies only
+// to this instance.
+type MaintenanceMode struct {
+	enabled    atomic.Bool
+	retryAfter time.Duration
+}
+
+func NewMaintenanceMode(enabled bool, retryAfter time.Duration) *MaintenanceMode {
+	m := &MaintenanceMode{retryAfter: retryAfter}
+	m.enabled.Store(enabled)
+	return m
+}
+
+func (m *MaintenanceMode) Enabled() bool {
+	return m.enabled.Load()
+}
+
+func (m *MaintenanceMode) SetEnabled(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+// MaintenanceMiddleware rejects write requests with 503 while maintenance
+// mode is on. Safe methods still pass so clients can read, and routes
+// listed in exemptPaths (matched against the route pattern) stay writable so
+// maintenance can be switched off again.
+func MaintenanceMiddleware(mode *MaintenanceMode, exemptPaths ...string) gin.HandlerFunc {
+	exempt := make(map[string]bool, len(exemptPaths))
+	for _, path := range exemptPaths {
+		exempt[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if !mode.Enabled() || isSafeMethod(c.Request.Method) || exempt[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", strconv.Itoa(int(mode.retryAfter.Seconds())))
+		response.AbortWithError(c, http.StatusServiceUnavailable, response.ErrorResponse{
+			Error: "Service is temporarily down for maintenance",
+			Code:  ErrCodeMaintenance,
+		})
+	}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
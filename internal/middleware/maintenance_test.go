@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMaintenanceMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mode := NewMaintenanceMode(false, 90*time.Second)
+	router := gin.New()
+	router.Use(MaintenanceMiddleware(mode, "/admin/maintenance"))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/users", ok)
+	router.POST("/auth/otp/generate", ok)
+	router.POST("/admin/maintenance", ok)
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := request(http.MethodPost, "/auth/otp/generate"); w.Code != http.StatusOK {
+		t.Errorf("Expected writes to pass while disabled, got %d", w.Code)
+	}
+
+	mode.SetEnabled(true)
+
+	w := request(http.MethodPost, "/auth/otp/generate")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "90" {
+		t.Errorf("Expected Retry-After 90, got %q", got)
+	}
+
+	if w := request(http.MethodGet, "/users"); w.Code != http.StatusOK {
+		t.Errorf("Expected reads to pass during maintenance, got %d", w.Code)
+	}
+	if w := request(http.MethodPost, "/admin/maintenance"); w.Code != http.StatusOK {
+		t.Errorf("Expected exempt route to pass during maintenance, got %d", w.Code)
+	}
+}
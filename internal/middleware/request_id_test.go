@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		incoming string
+		reuse    bool
+	}{
+		{"absent", "", false},
+		{"valid uuid", "0b8f6a2e-3c4d-4e5f-8a9b-0c1d2e3f4a5b", true},
+		{"valid gateway id", "gw:abc.123_XYZ", true},
+		{"too long", strings.Repeat("a", 129), false},
+		{"invalid characters", "abc<script>", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			router := gin.New()
+			router.GET("/", RequestIDMiddleware(), func(c *gin.Context) {
+				seen = c.GetString("request_id")
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			echoed := w.Header().Get(RequestIDHeader)
+			if echoed == "" || echoed != seen {
+				t.Fatalf("Expected echoed ID %q to match context ID %q", echoed, seen)
+			}
+			if tt.reuse && echoed != tt.incoming {
+				t.Errorf("Expected incoming ID %q to be reused, got %q", tt.incoming, echoed)
+			}
+			if !tt.reuse && echoed == tt.incoming {
+				t.Errorf("Expected a generated ID, got incoming %q", echoed)
+			}
+		})
+	}
+}
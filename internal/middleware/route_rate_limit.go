@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"otp/internal/config"
+	"otp/internal/ratelimit"
+	"otp/internal/response"
+	"otp/internal/services"
+	"otp/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ErrCodeRateLimited = "RATE_LIMITED"
+
+// maxPhoneKeyBodyBytes caps how much of a request body is read to find the
+// phone number for phone-keyed limits
+const maxPhoneKeyBodyBytes = 4096
+
+type routeLimit struct {
+	policy  ratelimit.RoutePolicy
+	limiter ratelimit.Limiter
+}
+
+// RouteRateLimitMiddleware applies each matching policy to the request,
+// answering 429 with a Retry-After header, in retryAfterFormat, once any of
+// them is exhausted.
+// Phone-keyed policies read phone_number from the JSON body, in canonical
+// form for defaultRegion, and user-keyed ones the bearer token's user;
+// requests without one are counted by IP.
+// Exempt IPs bypass every policy, while exempt phone numbers only bypass
+// phone-keyed ones: the body is the client's to choose, so it must not lift
+// limits counted per IP or user.
+func RouteRateLimitMiddleware(policies []ratelimit.RoutePolicy, exemptions *ratelimit.Exemptions, authService services.AuthService, retryAfterFormat, defaultRegion string) gin.HandlerFunc {
+	limits := make([]routeLimit, 0, len(policies))
+	for _, policy := range policies {
+		limits = append(limits, routeLimit{policy: policy, limiter: ratelimit.NewMemoryLimiter(policy.Requests, policy.Window)})
+	}
+
+	return func(c *gin.Context) {
+		var matched []routeLimit
+		keyByPhone := false
+		for _, limit := range limits {
+			if limit.policy.Matches(c.Request.Method, c.FullPath()) {
+				matched = append(matched, limit)
+				keyByPhone = keyByPhone || limit.policy.KeyBy == ratelimit.KeyByPhone
+			}
+		}
+		ip := c.ClientIP()
+		if len(matched) == 0 || exemptions.ExemptIP(ip) {
+			c.Next()
+			return
+		}
+
+		var phoneNumber string
+		if keyByPhone {
+			phoneNumber = requestPhoneNumber(c, defaultRegion)
+		}
+
+		for _, limit := range matched {
+			key := "ip:" + ip
+			switch limit.policy.KeyBy {
+			case ratelimit.KeyByPhone:
+				if exemptions.ExemptPhone(phoneNumber) {
+					continue
+				}
+				if phoneNumber != "" {
+					key = "phone:" + phoneNumber
+				}
+			case ratelimit.KeyByUser:
+				if userID := requestUserID(c, authService); userID != "" {
+					key = "user:" + userID
+				}
+			}
+
+			if allowed, retryAfter := limit.limiter.Allow(key); !allowed {
+				seconds := setRetryAfter(c, retryAfterFormat, retryAfter)
+				response.AbortWithError(c, http.StatusTooManyRequests, response.ErrorResponse{
+					Error:             "Too many requests. Please try again later",
+					Code:              ErrCodeRateLimited,
+					RetryAfterSeconds: seconds,
+				})
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// setRetryAfter sets the Retry-After header for a wait rounded up to whole
+// seconds, either as delta-seconds or as the HTTP-date that many seconds
+// from now, and returns the seconds
+func setRetryAfter(c *gin.Context, format string, wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if format == config.RetryAfterFormatHTTPDate {
+		// HTTP-dates have whole-second precision; round up so clients
+		// honoring the date never retry early
+		retryAt := time.Now().Add(time.Duration(seconds) * time.Second)
+		if truncated := retryAt.Truncate(time.Second); !truncated.Equal(retryAt) {
+			retryAt = truncated.Add(time.Second)
+		}
+		c.Header("Retry-After", retryAt.UTC().Format(http.TimeFormat))
+	} else {
+		c.Header("Retry-After", strconv.Itoa(seconds))
+	}
+	return seconds
+}
+
+// requestPhoneNumber returns the phone_number field of a JSON body in E.164
+// form, or "" if it has none that parses, leaving the body in place for the
+// handler
+func requestPhoneNumber(c *gin.Context, defaultRegion string) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(c.Request.Body, maxPhoneKeyBodyBytes))
+	c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(body), c.Request.Body), c.Request.Body}
+
+	var request struct {
+		PhoneNumber string `json:"phone_number"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return ""
+	}
+	phoneNumber, err := validation.CanonicalPhoneNumber(request.PhoneNumber, defaultRegion)
+	if err != nil {
+		return ""
+	}
+	return phoneNumber
+}
+
+// requestUserID returns the user of a valid bearer token, if there is one
+func requestUserID(c *gin.Context, authService services.AuthService) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > maxAuthorizationHeaderBytes {
+		return ""
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "Bearer") || !wellFormedJWT(fields[1]) {
+		return ""
+	}
+	claims, err := validateToken(authService, fields[1])
+	if err != nil {
+		return ""
+	}
+	return claims.UserID
+}
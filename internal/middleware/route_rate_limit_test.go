@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"otp/internal/config"
+	"otp/internal/i18n"
+	"otp/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRouteRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	policies := []ratelimit.RoutePolicy{
+		{Method: "POST", Path: "/auth/otp/generate", Requests: 1, Window: time.Minute, KeyBy: ratelimit.KeyByPhone},
+		{Method: "*", Path: "/users*", Requests: 2, Window: time.Minute, KeyBy: ratelimit.KeyByUser},
+	}
+	exemptions, err := ratelimit.NewExemptions([]string{"+15550000000"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to build exemptions: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(RouteRateLimitMiddleware(policies, exemptions, &mockAuthService{}, config.RetryAfterFormatSeconds, ""))
+	router.POST("/auth/otp/generate", func(c *gin.Context) {
+		// The handler still sees the whole body
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	router.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/features", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Phone-keyed: one request per number
+	body := `{"phone_number":"+1 234 567 890"}`
+	if w := send("POST", "/auth/otp/generate", body, ""); w.Code != http.StatusOK || w.Body.String() != body {
+		t.Fatalf("Expected first request to pass with its body, got %d %q", w.Code, w.Body.String())
+	}
+	w := send("POST", "/auth/otp/generate", `{"phone_number":"+1234567890"}`, "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected 429 with Retry-After 60 for the same number, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := send("POST", "/auth/otp/generate", `{"phone_number":"+1234567891"}`, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected another number to pass, got %d", w.Code)
+	}
+
+	// Exempt numbers are never limited
+	for i := 0; i < 3; i++ {
+		if w := send("POST", "/auth/otp/generate", `{"phone_number":"+15550000000"}`, ""); w.Code != http.StatusOK {
+			t.Errorf("Expected exempt number to pass, got %d", w.Code)
+		}
+	}
+
+	// User-keyed: requests without a valid token are counted by IP instead
+	for i := 0; i < 2; i++ {
+		if w := send("GET", "/users/1", "", "test.valid.token"); w.Code != http.StatusOK {
+			t.Fatalf("Expected request %d for the user to pass, got %d", i+1, w.Code)
+		}
+	}
+	if w := send("GET", "/users/1", "", "test.valid.token"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for the user's third request, got %d", w.Code)
+	}
+	if w := send("GET", "/users/1", "", "invalid-token"); w.Code != http.StatusOK {
+		t.Errorf("Expected anonymous request to be counted by IP, got %d", w.Code)
+	}
+
+	// Routes without a policy are untouched
+	for i := 0; i < 3; i++ {
+		if w := send("GET", "/features", "", ""); w.Code != http.StatusOK {
+			t.Errorf("Expected unlimited route to pass, got %d", w.Code)
+		}
+	}
+}
+
+func TestRouteRateLimitMiddleware_PhoneExemptionAndCanonicalNumbers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	policies := []ratelimit.RoutePolicy{
+		{Method: "POST", Path: "/auth/otp/generate", Requests: 1, Window: time.Minute, KeyBy: ratelimit.KeyByPhone},
+		{Method: "POST", Path: "/users/me", Requests: 1, Window: time.Minute, KeyBy: ratelimit.KeyByIP},
+	}
+	exemptions, err := ratelimit.NewExemptions([]string{"+15550000000"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to build exemptions: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(RequestIDMiddleware(), RouteRateLimitMiddleware(policies, exemptions, &mockAuthService{}, config.RetryAfterFormatSeconds, "GB"))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.POST("/auth/otp/generate", ok)
+	router.POST("/users/me", ok)
+
+	send := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Accept-Language", "fr")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// An exempt number in the body does not lift IP-keyed limits
+	exempt := `{"phone_number":"+15550000000"}`
+	if w := send("/users/me", exempt); w.Code != http.StatusOK {
+		t.Fatalf("Expected first request to pass, got %d", w.Code)
+	}
+	w := send("/users/me", exempt)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 despite the exempt number, got %d", w.Code)
+	}
+
+	// The 429 carries the shared error envelope
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if body["code"] != ErrCodeRateLimited || body["message"] != i18n.Message("fr", ErrCodeRateLimited) {
+		t.Errorf("Expected a localized RATE_LIMITED error, got %v", body)
+	}
+	if w.Header().Get(RequestIDHeader) == "" {
+		t.Error("Expected the 429 to carry X-Request-ID")
+	}
+
+	// Different spellings of one number share a bucket
+	if w := send("/auth/otp/generate", `{"phone_number":"020 7123 4567"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected first request for the number to pass, got %d", w.Code)
+	}
+	if w := send("/auth/otp/generate", `{"phone_number":"0044 20 7123 4567"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for another spelling of the same number, got %d", w.Code)
+	}
+}
+
+func TestRouteRateLimitMiddleware_RetryAfterFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	policies := []ratelimit.RoutePolicy{
+		{Method: "GET", Path: "/features", Requests: 1, Window: time.Minute, KeyBy: ratelimit.KeyByIP},
+	}
+	exemptions, err := ratelimit.NewExemptions(nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to build exemptions: %v", err)
+	}
+
+	for _, format := range []string{config.RetryAfterFormatSeconds, config.RetryAfterFormatHTTPDate} {
+		router := gin.New()
+		router.Use(RouteRateLimitMiddleware(policies, exemptions, &mockAuthService{}, format, ""))
+		router.GET("/features", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/features", nil))
+		start := time.Now()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/features", nil))
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("%s: expected 429, got %d", format, w.Code)
+		}
+
+		var body struct {
+			RetryAfterSeconds int `json:"retry_after_seconds"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: failed to decode body: %v", format, err)
+		}
+		if body.RetryAfterSeconds != 60 {
+			t.Errorf("%s: expected retry_after_seconds 60, got %d", format, body.RetryAfterSeconds)
+		}
+
+		header := w.Header().Get("Retry-After")
+		if format == config.RetryAfterFormatSeconds {
+			if header != "60" {
+				t.Errorf("Expected Retry-After 60, got %q", header)
+			}
+			continue
+		}
+
+		retryAt, err := http.ParseTime(header)
+		if err != nil {
+			t.Fatalf("Expected an HTTP-date Retry-After, got %q: %v", header, err)
+		}
+		if header != retryAt.UTC().Format(http.TimeFormat) {
+			t.Errorf("Expected Retry-After in IMF-fixdate form, got %q", header)
+		}
+		// The date matches retry_after_seconds, rounded up to a whole second
+		earliest := start.Add(60 * time.Second).Truncate(time.Second)
+		latest := time.Now().Add(61 * time.Second)
+		if retryAt.Before(earliest) || retryAt.After(latest) {
+			t.Errorf("Expected Retry-After about 60s from now, got %v (now %v)", retryAt, start)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+type AuditEvent struct {
+	ID        int64                  `json:"id" db:"id"`
+	ActorID   string                 `json:"actor_id" db:"actor_id"`
+	Action    string                 `json:"action" db:"action"`
+	Target    string                 `json:"target" db:"target"`
+	IP        string                 `json:"ip" db:"ip"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
+	CreatedAt time.Time              `json:"created_at" db:"created_at"`
+	PrevHash  string                 `json:"prev_hash" db:"prev_hash"`
+	Hash      string                 `json:"hash" db:"hash"`
+}
+
+// AuditEventQuery filters audit events. The admin endpoint pages through
+// them with Pagination; Limit caps a single unpaged List.
+type AuditEventQuery struct {
+	Pagination
+	ActorID string     `form:"actor_id"`
+	Action  string     `form:"action"`
+	Target  string     `form:"target"`
+	Since   *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until   *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit   int        `form:"limit" binding:"omitempty,min=1,max=1000"`
+}
+
+// AuditChainVerification reports whether the audit event hash chain still
+// matches the stored events. Problem names the first event that doesn't.
+type AuditChainVerification struct {
+	Intact  bool   `json:"intact"`
+	Problem string `json:"problem,omitempty"`
+}
+
+type AuditEventListResponse struct {
+	Events     []AuditEvent `json:"events"`
+	Total      int          `json:"total"`
+	Page       int          `json:"page"`
+	PageSize   int          `json:"page_size"`
+	TotalPages int          `json:"total_pages"`
+}
@@ -7,15 +7,85 @@ import (
 )
 
 type AuthResponse struct {
-	Token     string       `json:"token"`
-	User      UserResponse `json:"user"`
-	ExpiresAt time.Time    `json:"expires_at"`
+	Token string `json:"token"`
+	// User is nil in verify-only mode, where no users are stored
+	User      *UserResponse `json:"user,omitempty"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	RequestID string        `json:"request_id,omitempty"`
 }
 
+// AccountRecoveryResponse signs in a user who proved control of their
+// recovery phone. When they asked to move to a number other than the
+// recovery phone, PhoneChange reports the code sent to it; the move
+// completes once that code is confirmed at /auth/phone/change-confirm
+// with Token.
+type AccountRecoveryResponse struct {
+	AuthResponse
+	PhoneChange *OTPResponse `json:"phone_change,omitempty"`
+}
+
+// VerifyOnlyAudience is the aud claim of tokens issued in verify-only mode,
+// which prove control of a phone number rather than identify a user
+const VerifyOnlyAudience = "verify-only"
+
 type Claims struct {
+	// Subject is the standard sub claim: the user ID, or the phone number
+	// if so configured. UserID is kept for clients that read it directly.
+	Subject     string `json:"sub,omitempty"`
 	UserID      string `json:"user_id"`
 	PhoneNumber string `json:"phone_number"`
 	Exp         int64  `json:"exp"`
+	// Iat is when the token was issued. Tokens issued before it was added
+	// carry 0.
+	Iat int64 `json:"iat,omitempty"`
+	// AuthTime is when the user last verified an OTP, used to require a
+	// recent login for sensitive changes. It survives claim refreshes, which
+	// only update Iat.
+	AuthTime int64 `json:"auth_time,omitempty"`
+	// Audience is VerifyOnlyAudience on verify-only tokens and empty on
+	// tokens for a user
+	Audience string `json:"aud,omitempty"`
+}
+
+// TokenInfo describes a validated token so clients can refresh it before it
+// expires without decoding it themselves
+type TokenInfo struct {
+	UserID           string    `json:"user_id"`
+	PhoneNumber      string    `json:"phone_number"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	SecondsRemaining int64     `json:"seconds_remaining"`
+	// IssuedAt is absent for tokens issued before iat was added
+	IssuedAt *time.Time `json:"issued_at,omitempty"`
+}
+
+// Info describes the token at now. SecondsRemaining is never negative.
+func (c *Claims) Info(now time.Time) TokenInfo {
+	info := TokenInfo{
+		UserID:      c.UserID,
+		PhoneNumber: c.PhoneNumber,
+		ExpiresAt:   time.Unix(c.Exp, 0).UTC(),
+	}
+	if remaining := c.Exp - now.Unix(); remaining > 0 {
+		info.SecondsRemaining = remaining
+	}
+	if c.Iat != 0 {
+		issuedAt := time.Unix(c.Iat, 0).UTC()
+		info.IssuedAt = &issuedAt
+	}
+	return info
+}
+
+// AuthenticatedAt returns when the user last verified an OTP, falling back to
+// the issue time for tokens without auth_time. It is zero if neither is set.
+func (c *Claims) AuthenticatedAt() time.Time {
+	switch {
+	case c.AuthTime != 0:
+		return time.Unix(c.AuthTime, 0)
+	case c.Iat != 0:
+		return time.Unix(c.Iat, 0)
+	default:
+		return time.Time{}
+	}
 }
 
 // GetExpirationTime implements jwt.Claims
@@ -30,7 +100,10 @@ func (c *Claims) GetNotBefore() (*jwt.NumericDate, error) {
 
 // GetIssuedAt implements jwt.Claims
 func (c *Claims) GetIssuedAt() (*jwt.NumericDate, error) {
-	return nil, nil
+	if c.Iat == 0 {
+		return nil, nil
+	}
+	return jwt.NewNumericDate(time.Unix(c.Iat, 0)), nil
 }
 
 // GetIssuer implements jwt.Claims
@@ -40,24 +113,76 @@ func (c *Claims) GetIssuer() (string, error) {
 
 // GetSubject implements jwt.Claims
 func (c *Claims) GetSubject() (string, error) {
-	return "", nil
+	return c.Subject, nil
 }
 
 // GetAudience implements jwt.Claims
 func (c *Claims) GetAudience() (jwt.ClaimStrings, error) {
-	return nil, nil
+	if c.Audience == "" {
+		return nil, nil
+	}
+	return jwt.ClaimStrings{c.Audience}, nil
 }
 
-type PaginationQuery struct {
-	Page     int    `form:"page" binding:"min=1"`
-	PageSize int    `form:"page_size" binding:"min=1,max=100"`
-	Search   string `form:"search"`
+// Pagination bounds applied by PaginationQuery.Normalize
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 100
+)
+
+// Pagination selects one page of a list endpoint's results. Page and
+// PageSize are not validated on binding; call Normalize to apply defaults
+// and bounds.
+type Pagination struct {
+	Page     int `form:"page"`
+	PageSize int `form:"page_size"`
 }
 
-func (p *PaginationQuery) GetOffset() int {
+// Normalize replaces a missing, zero or negative page with 1 and page size
+// with DefaultPageSize, and caps the page size at MaxPageSize.
+func (p *Pagination) Normalize() {
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.PageSize < 1 {
+		p.PageSize = DefaultPageSize
+	}
+	if p.PageSize > MaxPageSize {
+		p.PageSize = MaxPageSize
+	}
+}
+
+func (p *Pagination) GetOffset() int {
 	return (p.Page - 1) * p.PageSize
 }
 
-func (p *PaginationQuery) GetLimit() int {
+func (p *Pagination) GetLimit() int {
 	return p.PageSize
 }
+
+// TotalPages returns how many pages total results fill
+func (p *Pagination) TotalPages(total int) int {
+	return (total + p.PageSize - 1) / p.PageSize
+}
+
+// PaginationQuery is the user list query
+type PaginationQuery struct {
+	Pagination
+	Search        string     `form:"search"`
+	ExactSearch   bool       `form:"-"`
+	CreatedAfter  *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore *time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	MetadataKey   string     `form:"metadata_key"`
+	MetadataValue string     `form:"metadata_value"`
+}
+
+func (p *PaginationQuery) GetFilter() UserFilter {
+	return UserFilter{
+		Search:        p.Search,
+		ExactSearch:   p.ExactSearch,
+		CreatedAfter:  p.CreatedAfter,
+		CreatedBefore: p.CreatedBefore,
+		MetadataKey:   p.MetadataKey,
+		MetadataValue: p.MetadataValue,
+	}
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPagination_TotalPages(t *testing.T) {
+	tests := []struct {
+		pageSize int
+		total    int
+		want     int
+	}{
+		{10, 0, 0},
+		{10, 1, 1},
+		{10, 10, 1},
+		{10, 11, 2},
+		{25, 100, 4},
+	}
+
+	for _, tt := range tests {
+		p := Pagination{Page: 1, PageSize: tt.pageSize}
+		if got := p.TotalPages(tt.total); got != tt.want {
+			t.Errorf("TotalPages(%d) with page size %d = %d, want %d", tt.total, tt.pageSize, got, tt.want)
+		}
+	}
+}
+
+func TestClaims_Info(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	claims := Claims{UserID: "user-1", PhoneNumber: "+1234567890", Iat: now.Unix() - 600, Exp: now.Unix() + 90}
+
+	info := claims.Info(now)
+	if info.SecondsRemaining != 90 {
+		t.Errorf("Expected 90 seconds remaining, got %d", info.SecondsRemaining)
+	}
+	if !info.ExpiresAt.Equal(now.Add(90 * time.Second)) {
+		t.Errorf("Expected expiry %v, got %v", now.Add(90*time.Second), info.ExpiresAt)
+	}
+	if info.IssuedAt == nil || !info.IssuedAt.Equal(now.Add(-10*time.Minute)) {
+		t.Errorf("Expected issue time %v, got %v", now.Add(-10*time.Minute), info.IssuedAt)
+	}
+	if info.UserID != "user-1" || info.PhoneNumber != "+1234567890" {
+		t.Errorf("Expected the token's user and phone number, got %q %q", info.UserID, info.PhoneNumber)
+	}
+
+	// Expired tokens and tokens without iat
+	expired := Claims{Exp: now.Unix() - 5}
+	info = expired.Info(now)
+	if info.SecondsRemaining != 0 || info.IssuedAt != nil {
+		t.Errorf("Expected no time remaining and no issue time, got %d %v", info.SecondsRemaining, info.IssuedAt)
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// UserDataExport is everything stored about one user, assembled for a
+// data-subject access request. It never contains OTP codes or tokens.
+type UserDataExport struct {
+	ExportedAt time.Time `json:"exported_at"`
+	User       User      `json:"user"`
+	// OTPs lists the codes requested for the user's primary and recovery
+	// phone numbers, newest first, without the codes themselves
+	OTPs []OTPRecord `json:"otps"`
+	// AuditEvents lists audit entries the user performed or was the target of
+	AuditEvents []AuditEvent `json:"audit_events"`
+}
+
+// OTPRecord describes an OTP without its code
+type OTPRecord struct {
+	PhoneNumber string    `json:"phone_number"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Used        bool      `json:"used"`
+	RequestID   string    `json:"request_id"`
+	IP          string    `json:"ip,omitempty"`
+}
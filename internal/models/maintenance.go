@@ -0,0 +1,10 @@
+package models
+
+type MaintenanceRequest struct {
+	// Enabled is a pointer so that an explicit false passes the required check
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+type MaintenanceStatus struct {
+	Enabled bool `json:"enabled"`
+}
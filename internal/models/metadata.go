@@ -0,0 +1,60 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// MaxMetadataBytes bounds the JSON-encoded size of a user's metadata
+const MaxMetadataBytes = 4096
+
+// Metadata holds arbitrary per-user attributes, stored as a JSONB column
+type Metadata map[string]interface{}
+
+// Value implements driver.Valuer, storing empty metadata as NULL
+func (m Metadata) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// Scan implements sql.Scanner
+func (m *Metadata) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Metadata", src)
+	}
+	return json.Unmarshal(data, m)
+}
+
+// Merge applies patch to m following JSON merge patch semantics for the top
+// level: keys with a null value are removed and all others are set.
+func (m Metadata) Merge(patch Metadata) Metadata {
+	merged := make(Metadata, len(m)+len(patch))
+	for key, value := range m {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+type UserMetadataUpdate struct {
+	// Metadata keys set to null are removed; other keys are added or replaced
+	Metadata Metadata `json:"metadata" binding:"required"`
+}
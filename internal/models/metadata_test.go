@@ -0,0 +1,42 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMetadata_Merge(t *testing.T) {
+	existing := Metadata{"app_version": "1.2.0", "referral_source": "ads"}
+	merged := existing.Merge(Metadata{"app_version": "1.3.0", "referral_source": nil, "marketing_opt_in": true})
+
+	want := Metadata{"app_version": "1.3.0", "marketing_opt_in": true}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("Merge() = %v, want %v", merged, want)
+	}
+
+	if existing["app_version"] != "1.2.0" {
+		t.Error("Expected Merge not to modify the receiver")
+	}
+}
+
+func TestMetadata_ValueScan(t *testing.T) {
+	value, err := Metadata{"plan": "pro", "seats": 3}.Value()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var scanned Metadata
+	if err := scanned.Scan(value); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if want := (Metadata{"plan": "pro", "seats": float64(3)}); !reflect.DeepEqual(scanned, want) {
+		t.Errorf("Scan() = %v, want %v", scanned, want)
+	}
+
+	if value, _ := Metadata(nil).Value(); value != nil {
+		t.Errorf("Expected empty metadata to be stored as NULL, got %v", value)
+	}
+	if err := scanned.Scan(nil); err != nil || scanned != nil {
+		t.Errorf("Expected NULL to scan to nil metadata, got %v (%v)", scanned, err)
+	}
+}
@@ -1,7 +1,11 @@
 package models
 
 import (
+	"strings"
 	"time"
+	"unicode"
+
+	"github.com/google/uuid"
 )
 
 type OTP struct {
@@ -11,30 +15,144 @@ type OTP struct {
 	ExpiresAt   time.Time `json:"expires_at" db:"expires_at"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	Used        bool      `json:"used" db:"used"`
+	// RequestID identifies the auth attempt this OTP belongs to so generate
+	// and verify can be correlated in logs. It is unrelated to the
+	// per-request X-Request-ID header.
+	RequestID string `json:"request_id" db:"request_id"`
+	// IP is the client address the OTP was requested from, for fraud
+	// investigation. It is empty for OTPs created before it was recorded.
+	IP string `json:"ip" db:"ip"`
+	// UsesRemaining is how many more verifications the code allows; it is
+	// marked used when the last one is consumed
+	UsesRemaining int `json:"uses_remaining" db:"uses_remaining"`
+}
+
+// RateLimitReset reports what an admin reset of a user's rate limits cleared
+type RateLimitReset struct {
+	UserID string `json:"user_id"`
+	// PhoneNumber and RecoveryPhone are masked, e.g. +1******7890
+	PhoneNumber   string `json:"phone_number"`
+	RecoveryPhone string `json:"recovery_phone,omitempty"`
+	// OTPRequestsCleared is how many recent OTP requests no longer count
+	// toward the per-window and daily limits, across both numbers
+	OTPRequestsCleared int `json:"otp_requests_cleared"`
+	// VerifyBackoffCleared is set when delays for consecutive wrong codes
+	// were reset, which only happens when the backoff is enabled
+	VerifyBackoffCleared bool `json:"verify_backoff_cleared"`
+}
+
+// OTPCleanup reports what an admin cleanup of expired OTPs removed
+type OTPCleanup struct {
+	// Deleted is how many expired OTPs were removed. OTPs still counted
+	// toward rate limits are kept, so it can be 0 while some have expired.
+	Deleted int `json:"deleted"`
 }
 
 type OTPRequest struct {
-	PhoneNumber string `json:"phone_number" binding:"required"`
+	// PhoneNumber is in E.164 format, or in national format when a default
+	// region is configured
+	PhoneNumber string `json:"phone_number" binding:"required,phone"`
+	// CaptchaToken is required by generate when CAPTCHA verification is on
+	CaptchaToken string `json:"captcha_token,omitempty"`
 }
 
 type OTPVerification struct {
-	PhoneNumber string `json:"phone_number" binding:"required"`
-	Code        string `json:"code" binding:"required"`
+	PhoneNumber string `json:"phone_number" binding:"required,phone"`
+	// Code must stay a string end to end; codes may start with 0
+	Code string `json:"code" binding:"required"`
+}
+
+type PhoneChangeRequest struct {
+	NewPhoneNumber string `json:"new_phone_number" binding:"required,phone"`
+	// CaptchaToken is required when CAPTCHA verification is on
+	CaptchaToken string `json:"captcha_token,omitempty"`
+}
+
+type PhoneChangeConfirmation struct {
+	NewPhoneNumber string `json:"new_phone_number" binding:"required,phone"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type RecoveryPhoneRequest struct {
+	RecoveryPhone string `json:"recovery_phone" binding:"required,phone"`
+	// CaptchaToken is required when CAPTCHA verification is on
+	CaptchaToken string `json:"captcha_token,omitempty"`
+}
+
+type RecoveryPhoneConfirmation struct {
+	RecoveryPhone string `json:"recovery_phone" binding:"required,phone"`
+	Code          string `json:"code" binding:"required"`
+}
+
+// AccountRecoveryConfirmation moves the account registered with
+// RecoveryPhone to NewPhoneNumber, proven by the OTP sent to RecoveryPhone
+type AccountRecoveryConfirmation struct {
+	RecoveryPhone  string `json:"recovery_phone" binding:"required,phone"`
+	NewPhoneNumber string `json:"new_phone_number" binding:"required,phone"`
+	Code           string `json:"code" binding:"required"`
+	// CaptchaToken is required when CAPTCHA verification is on and
+	// NewPhoneNumber is not RecoveryPhone, since a code is then sent to it
+	CaptchaToken string `json:"captcha_token,omitempty"`
 }
 
 type OTPResponse struct {
 	Message   string `json:"message"`
 	ExpiresIn int    `json:"expires_in_minutes"`
+	RequestID string `json:"request_id"`
+	// Warning is set when the phone number is close to its rate limit
+	Warning string `json:"warning,omitempty"`
 }
 
 func NewOTP(phoneNumber, code string, expiryMinutes int) *OTP {
 	return &OTP{
-		PhoneNumber: phoneNumber,
-		Code:        code,
-		ExpiresAt:   time.Now().Add(time.Duration(expiryMinutes) * time.Minute),
-		CreatedAt:   time.Now(),
-		Used:        false,
+		PhoneNumber:   phoneNumber,
+		Code:          code,
+		ExpiresAt:     time.Now().Add(time.Duration(expiryMinutes) * time.Minute),
+		CreatedAt:     time.Now(),
+		Used:          false,
+		RequestID:     uuid.New().String(),
+		UsesRemaining: 1,
+	}
+}
+
+// ToRecord describes the OTP without its code
+func (o *OTP) ToRecord() OTPRecord {
+	return OTPRecord{
+		PhoneNumber: o.PhoneNumber,
+		CreatedAt:   o.CreatedAt,
+		ExpiresAt:   o.ExpiresAt,
+		Used:        o.Used,
+		RequestID:   o.RequestID,
+		IP:          o.IP,
+	}
+}
+
+// FormatCode renders code for display in dash-separated groups of groupSize
+// characters, e.g. "123-456". A groupSize of 0 or less returns code as is.
+func FormatCode(code string, groupSize int) string {
+	if groupSize <= 0 || len(code) <= groupSize {
+		return code
+	}
+
+	var formatted strings.Builder
+	for i, r := range code {
+		if i > 0 && i%groupSize == 0 {
+			formatted.WriteByte('-')
+		}
+		formatted.WriteRune(r)
 	}
+	return formatted.String()
+}
+
+// StripCodeSeparators removes everything but letters and digits from a
+// submitted code, so "123-456" and "123 456" both become "123456".
+func StripCodeSeparators(code string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, code)
 }
 
 func (o *OTP) IsExpired() bool {
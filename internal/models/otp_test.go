@@ -0,0 +1,60 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+
+	"otp/internal/validation"
+)
+
+func TestOTPVerification_CodeBindsAsString(t *testing.T) {
+	if err := validation.RegisterValidators(); err != nil {
+		t.Fatalf("Failed to register validators: %v", err)
+	}
+
+	var verification OTPVerification
+	err := binding.JSON.BindBody([]byte(`{"phone_number": "+1234567890", "code": "012345"}`), &verification)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if verification.Code != "012345" {
+		t.Errorf("Expected code 012345 with its leading zero, got %s", verification.Code)
+	}
+
+	// A numeric code would already have lost its leading zero, so reject it
+	// rather than coercing it to a string
+	verification = OTPVerification{}
+	err = binding.JSON.BindBody([]byte(`{"phone_number": "+1234567890", "code": 12345}`), &verification)
+	if err == nil {
+		t.Errorf("Expected error for numeric code, got code %q", verification.Code)
+	}
+}
+
+func TestFormatCode(t *testing.T) {
+	tests := []struct {
+		code      string
+		groupSize int
+		want      string
+	}{
+		{"123456", 3, "123-456"},
+		{"12345678", 4, "1234-5678"},
+		{"1234567", 3, "123-456-7"},
+		{"123456", 0, "123456"},
+		{"123", 3, "123"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatCode(tt.code, tt.groupSize); got != tt.want {
+			t.Errorf("FormatCode(%q, %d) = %q, want %q", tt.code, tt.groupSize, got, tt.want)
+		}
+	}
+}
+
+func TestStripCodeSeparators(t *testing.T) {
+	for _, input := range []string{"123-456", "123 456", " 123.456 ", "123456"} {
+		if got := StripCodeSeparators(input); got != "123456" {
+			t.Errorf("StripCodeSeparators(%q) = %q, want 123456", input, got)
+		}
+	}
+}
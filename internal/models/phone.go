@@ -0,0 +1,44 @@
+package models
+
+import (
+	"context"
+	"strings"
+)
+
+// MaskPhone hides the middle of a phone number, e.g. +14155557890 becomes
+// +1******7890. Shorter numbers reveal less so that masking still hides
+// most of the digits.
+func MaskPhone(phoneNumber string) string {
+	prefix := ""
+	digits := phoneNumber
+	if strings.HasPrefix(digits, "+") {
+		prefix = "+"
+		digits = digits[1:]
+	}
+
+	var head, tail int
+	switch {
+	case len(digits) >= 8:
+		head, tail = 1, 4
+	case len(digits) >= 5:
+		head, tail = 0, 2
+	default:
+		head, tail = 0, 0
+	}
+
+	return prefix + digits[:head] + strings.Repeat("*", len(digits)-head-tail) + digits[len(digits)-tail:]
+}
+
+type maskPhonesKey struct{}
+
+// ContextWithMaskedPhones marks ctx so that user responses built for it
+// carry masked phone numbers.
+func ContextWithMaskedPhones(ctx context.Context) context.Context {
+	return context.WithValue(ctx, maskPhonesKey{}, true)
+}
+
+// MaskPhonesFromContext reports whether ctx was marked by ContextWithMaskedPhones
+func MaskPhonesFromContext(ctx context.Context) bool {
+	masked, _ := ctx.Value(maskPhonesKey{}).(bool)
+	return masked
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMaskPhone(t *testing.T) {
+	tests := []struct {
+		phoneNumber string
+		want        string
+	}{
+		{"+14155557890", "+1******7890"},
+		{"+1234567890", "+1*****7890"},
+		{"+442071234567", "+4*******4567"},
+		{"+12345678", "+1***5678"},
+		{"+1234567", "+*****67"},
+		{"+12345", "+***45"},
+		{"+1234", "+****"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := MaskPhone(tt.phoneNumber); got != tt.want {
+			t.Errorf("MaskPhone(%q) = %q, want %q", tt.phoneNumber, got, tt.want)
+		}
+	}
+}
+
+func TestUser_ToResponseContext(t *testing.T) {
+	user := NewUser("+14155557890")
+
+	if got := user.ToResponseContext(context.Background()).PhoneNumber; got != "+14155557890" {
+		t.Errorf("Expected unmasked phone number, got %s", got)
+	}
+
+	ctx := ContextWithMaskedPhones(context.Background())
+	if got := user.ToResponseContext(ctx).PhoneNumber; got != "+1******7890" {
+		t.Errorf("Expected masked phone number, got %s", got)
+	}
+}
@@ -1,17 +1,40 @@
 package models
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// UserStatus controls whether a user may sign in
+type UserStatus string
+
+const (
+	UserStatusActive    UserStatus = "active"
+	UserStatusSuspended UserStatus = "suspended"
+	UserStatusBanned    UserStatus = "banned"
+)
+
 type User struct {
 	ID          string     `json:"id" db:"id"`
 	PhoneNumber string     `json:"phone_number" db:"phone_number"`
 	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
 	LastLoginAt *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
+	Metadata    Metadata   `json:"metadata,omitempty" db:"metadata"`
+	// RecoveryPhone is a second, verified number that can move the account to
+	// a new primary number if the user loses access to this one
+	RecoveryPhone *string `json:"recovery_phone,omitempty" db:"recovery_phone"`
+	// Status is changed by admins; only active users can sign in
+	Status UserStatus `json:"status" db:"status"`
+}
+
+// UserStatusUpdate is the body of the admin status change endpoint
+type UserStatusUpdate struct {
+	Status UserStatus `json:"status" binding:"required,oneof=active suspended banned"`
 }
 
 type UserCreate struct {
@@ -19,10 +42,31 @@ type UserCreate struct {
 }
 
 type UserResponse struct {
-	ID          string     `json:"id"`
-	PhoneNumber string     `json:"phone_number"`
-	CreatedAt   time.Time  `json:"created_at"`
-	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	ID            string     `json:"id"`
+	PhoneNumber   string     `json:"phone_number"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastLoginAt   *time.Time `json:"last_login_at,omitempty"`
+	Metadata      Metadata   `json:"metadata,omitempty"`
+	RecoveryPhone *string    `json:"recovery_phone,omitempty"`
+	Status        UserStatus `json:"status"`
+}
+
+// UserFilter narrows the set of users returned by list and count queries
+type UserFilter struct {
+	Search string `form:"search"`
+	// ExactSearch matches Search against whole phone numbers only, rather
+	// than as a substring. It is set by the service, not the client.
+	ExactSearch   bool       `form:"-"`
+	CreatedAfter  *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore *time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	// MetadataKey matches users whose metadata has the key, further narrowed
+	// to a value (compared as text) by MetadataValue
+	MetadataKey   string `form:"metadata_key"`
+	MetadataValue string `form:"metadata_value"`
+}
+
+type UserCountResponse struct {
+	Total int `json:"total"`
 }
 
 type UserListResponse struct {
@@ -33,23 +77,122 @@ type UserListResponse struct {
 	TotalPages int            `json:"total_pages"`
 }
 
+// UserResponseFields lists the fields a client may select with the `fields`
+// query parameter.
+var UserResponseFields = []string{"id", "phone_number", "created_at", "last_login_at", "metadata", "recovery_phone", "status"}
+
+// ProjectedUserListResponse is a UserListResponse restricted to a subset of
+// user fields.
+type ProjectedUserListResponse struct {
+	Users      []map[string]interface{} `json:"users"`
+	Total      int                      `json:"total"`
+	Page       int                      `json:"page"`
+	PageSize   int                      `json:"page_size"`
+	TotalPages int                      `json:"total_pages"`
+}
+
+// ParseUserFields parses a comma-separated field list, rejecting names that
+// are not in UserResponseFields.
+func ParseUserFields(raw string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		valid := false
+		for _, allowed := range UserResponseFields {
+			if field == allowed {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		fields = append(fields, field)
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("at least one field is required")
+	}
+	return fields, nil
+}
+
+// NewUser returns an active user with a random UUIDv4 ID
 func NewUser(phoneNumber string) *User {
+	return NewUserWithID(uuid.New().String(), phoneNumber)
+}
+
+// NewUserWithID returns an active user with the given ID, which must be a
+// UUID
+func NewUserWithID(id, phoneNumber string) *User {
 	now := time.Now()
 	return &User{
-		ID:          uuid.New().String(),
+		ID:          id,
 		PhoneNumber: phoneNumber,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		Status:      UserStatusActive,
 	}
 }
 
+// IsActive reports whether the user may sign in and use their tokens
+func (u *User) IsActive() bool {
+	return u.Status == UserStatusActive
+}
+
+func (u *User) SetStatus(status UserStatus) {
+	u.Status = status
+	u.UpdatedAt = time.Now()
+}
+
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:          u.ID,
-		PhoneNumber: u.PhoneNumber,
-		CreatedAt:   u.CreatedAt,
-		LastLoginAt: u.LastLoginAt,
+		ID:            u.ID,
+		PhoneNumber:   u.PhoneNumber,
+		CreatedAt:     u.CreatedAt,
+		LastLoginAt:   u.LastLoginAt,
+		Metadata:      u.Metadata,
+		RecoveryPhone: u.RecoveryPhone,
+		Status:        u.Status,
+	}
+}
+
+// ToResponseContext is ToResponse with the phone number masked when ctx asks
+// for it (see ContextWithMaskedPhones).
+func (u *User) ToResponseContext(ctx context.Context) UserResponse {
+	response := u.ToResponse()
+	if MaskPhonesFromContext(ctx) {
+		response.PhoneNumber = MaskPhone(response.PhoneNumber)
+		if response.RecoveryPhone != nil {
+			masked := MaskPhone(*response.RecoveryPhone)
+			response.RecoveryPhone = &masked
+		}
+	}
+	return response
+}
+
+func (u *User) ChangePhoneNumber(phoneNumber string) {
+	u.PhoneNumber = phoneNumber
+	u.UpdatedAt = time.Now()
+}
+
+// SetRecoveryPhone sets the recovery phone number, clearing it when
+// phoneNumber is empty
+func (u *User) SetRecoveryPhone(phoneNumber string) {
+	if phoneNumber == "" {
+		u.RecoveryPhone = nil
+	} else {
+		u.RecoveryPhone = &phoneNumber
 	}
+	u.UpdatedAt = time.Now()
+}
+
+func (u *User) UpdateMetadata(patch Metadata) {
+	u.Metadata = u.Metadata.Merge(patch)
+	u.UpdatedAt = time.Now()
 }
 
 func (u *User) UpdateLastLogin() {
@@ -57,3 +200,49 @@ func (u *User) UpdateLastLogin() {
 	u.LastLoginAt = &now
 	u.UpdatedAt = now
 }
+
+// Project returns only the requested fields of the response. Unset optional
+// fields are omitted, matching the regular JSON encoding.
+func (r UserResponse) Project(fields []string) map[string]interface{} {
+	projected := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		switch field {
+		case "id":
+			projected[field] = r.ID
+		case "phone_number":
+			projected[field] = r.PhoneNumber
+		case "created_at":
+			projected[field] = r.CreatedAt
+		case "last_login_at":
+			if r.LastLoginAt != nil {
+				projected[field] = r.LastLoginAt
+			}
+		case "metadata":
+			if len(r.Metadata) > 0 {
+				projected[field] = r.Metadata
+			}
+		case "recovery_phone":
+			if r.RecoveryPhone != nil {
+				projected[field] = r.RecoveryPhone
+			}
+		case "status":
+			projected[field] = r.Status
+		}
+	}
+	return projected
+}
+
+func (r *UserListResponse) Project(fields []string) *ProjectedUserListResponse {
+	users := make([]map[string]interface{}, 0, len(r.Users))
+	for _, user := range r.Users {
+		users = append(users, user.Project(fields))
+	}
+
+	return &ProjectedUserListResponse{
+		Users:      users,
+		Total:      r.Total,
+		Page:       r.Page,
+		PageSize:   r.PageSize,
+		TotalPages: r.TotalPages,
+	}
+}
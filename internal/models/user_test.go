@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseUserFields(t *testing.T) {
+	fields, err := ParseUserFields(" id, phone_number ")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(fields) != 2 || fields[0] != "id" || fields[1] != "phone_number" {
+		t.Errorf("Expected [id phone_number], got %v", fields)
+	}
+
+	for _, raw := range []string{"", " , ", "id,password", "ID"} {
+		if _, err := ParseUserFields(raw); err == nil {
+			t.Errorf("Expected error for %q, got nil", raw)
+		}
+	}
+}
+
+func TestUserResponse_Project(t *testing.T) {
+	response := UserResponse{
+		ID:          "user-1",
+		PhoneNumber: "+1234567890",
+		CreatedAt:   time.Now(),
+	}
+
+	projected := response.Project([]string{"id", "last_login_at"})
+	if len(projected) != 1 || projected["id"] != "user-1" {
+		t.Errorf("Expected only id to be projected, got %v", projected)
+	}
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Exemptions lists phone numbers and client IPs that bypass OTP rate
+// limiting, such as QA numbers and monitoring probes. A nil *Exemptions
+// exempts nothing.
+type Exemptions struct {
+	phones   map[string]bool
+	networks []*net.IPNet
+}
+
+// NewExemptions builds an allowlist from phone numbers and IP entries. IP
+// entries may be single addresses or CIDR ranges.
+func NewExemptions(phones, ips []string) (*Exemptions, error) {
+	e := &Exemptions{phones: make(map[string]bool, len(phones))}
+	for _, phone := range phones {
+		e.phones[phone] = true
+	}
+
+	for _, entry := range ips {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid exempt IP %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			e.networks = append(e.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exempt IP range %q: %w", entry, err)
+		}
+		e.networks = append(e.networks, network)
+	}
+
+	return e, nil
+}
+
+// Exempt reports whether a request from ip for phoneNumber bypasses rate
+// limiting, which is the case when either one is listed.
+func (e *Exemptions) Exempt(ip, phoneNumber string) bool {
+	return e.ExemptIP(ip) || e.ExemptPhone(phoneNumber)
+}
+
+func (e *Exemptions) ExemptPhone(phoneNumber string) bool {
+	return e != nil && e.phones[phoneNumber]
+}
+
+func (e *Exemptions) ExemptIP(ip string) bool {
+	if e == nil {
+		return false
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range e.networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package ratelimit
+
+import "testing"
+
+func TestExemptions(t *testing.T) {
+	exemptions, err := NewExemptions(
+		[]string{"+15550000001"},
+		[]string{"203.0.113.7", "198.51.100.0/24", "2001:db8::/32"},
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !exemptions.ExemptPhone("+15550000001") {
+		t.Error("Expected listed phone number to be exempt")
+	}
+	if exemptions.ExemptPhone("+15550000002") {
+		t.Error("Expected unlisted phone number not to be exempt")
+	}
+
+	ips := map[string]bool{
+		"203.0.113.7":   true,
+		"203.0.113.8":   false,
+		"198.51.100.42": true,
+		"198.51.101.1":  false,
+		"2001:db8::1":   true,
+		"2001:db9::1":   false,
+		"not-an-ip":     false,
+	}
+	for ip, want := range ips {
+		if got := exemptions.ExemptIP(ip); got != want {
+			t.Errorf("ExemptIP(%q) = %v, want %v", ip, got, want)
+		}
+	}
+
+	var none *Exemptions
+	if none.ExemptPhone("+15550000001") || none.ExemptIP("203.0.113.7") {
+		t.Error("Expected nil exemptions to exempt nothing")
+	}
+}
+
+func TestNewExemptions_Invalid(t *testing.T) {
+	for _, entry := range []string{"300.1.1.1", "10.0.0.0/33", "example.com"} {
+		if _, err := NewExemptions(nil, []string{entry}); err == nil {
+			t.Errorf("Expected error for %q", entry)
+		}
+	}
+}
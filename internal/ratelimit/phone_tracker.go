@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// PhoneTracker tracks the distinct phone numbers requested by a client IP
+// within a sliding window.
+type PhoneTracker interface {
+	Allow(ip, phoneNumber string) bool
+}
+
+type memoryPhoneTracker struct {
+	mu          sync.Mutex
+	maxDistinct int
+	window      time.Duration
+	entries     map[string]map[string]time.Time
+	lastSweep   time.Time
+}
+
+// NewMemoryPhoneTracker returns an in-process PhoneTracker. A maxDistinct of
+// zero or less disables the check.
+func NewMemoryPhoneTracker(maxDistinct int, window time.Duration) PhoneTracker {
+	return &memoryPhoneTracker{
+		maxDistinct: maxDistinct,
+		window:      window,
+		entries:     make(map[string]map[string]time.Time),
+		lastSweep:   time.Now(),
+	}
+}
+
+func (t *memoryPhoneTracker) Allow(ip, phoneNumber string) bool {
+	if t.maxDistinct <= 0 {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-t.window)
+
+	// Periodically drop IPs that have gone quiet so the map doesn't grow forever
+	if now.Sub(t.lastSweep) >= t.window {
+		for key, phones := range t.entries {
+			prune(phones, cutoff)
+			if len(phones) == 0 {
+				delete(t.entries, key)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	phones, exists := t.entries[ip]
+	if !exists {
+		phones = make(map[string]time.Time)
+		t.entries[ip] = phones
+	}
+	prune(phones, cutoff)
+
+	if _, seen := phones[phoneNumber]; !seen && len(phones) >= t.maxDistinct {
+		return false
+	}
+
+	phones[phoneNumber] = now
+	return true
+}
+
+func prune(phones map[string]time.Time, cutoff time.Time) {
+	for phone, seenAt := range phones {
+		if seenAt.Before(cutoff) {
+			delete(phones, phone)
+		}
+	}
+}
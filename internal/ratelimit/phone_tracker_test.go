@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryPhoneTracker_Allow(t *testing.T) {
+	tracker := NewMemoryPhoneTracker(2, 10*time.Minute)
+	ip := "203.0.113.7"
+
+	if !tracker.Allow(ip, "+1234567890") {
+		t.Error("Expected first phone number to be allowed")
+	}
+	if !tracker.Allow(ip, "+1234567891") {
+		t.Error("Expected second phone number to be allowed")
+	}
+
+	// Repeating a known number does not count as a new one
+	if !tracker.Allow(ip, "+1234567890") {
+		t.Error("Expected repeated phone number to be allowed")
+	}
+
+	if tracker.Allow(ip, "+1234567892") {
+		t.Error("Expected third distinct phone number to be rejected")
+	}
+
+	// Other IPs are tracked independently
+	if !tracker.Allow("198.51.100.1", "+1234567892") {
+		t.Error("Expected phone number from another IP to be allowed")
+	}
+}
+
+func TestMemoryPhoneTracker_Disabled(t *testing.T) {
+	tracker := NewMemoryPhoneTracker(0, 10*time.Minute)
+
+	for i := 0; i < 10; i++ {
+		if !tracker.Allow("203.0.113.7", string(rune('0'+i))) {
+			t.Fatal("Expected tracker with zero limit to allow every request")
+		}
+	}
+}
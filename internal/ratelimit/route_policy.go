@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What a RoutePolicy counts requests by
+const (
+	KeyByIP    = "ip"
+	KeyByPhone = "phone"
+	KeyByUser  = "user"
+)
+
+// RoutePolicy limits requests to the routes matching Method and Path to
+// Requests per Window for each IP, phone number or user.
+type RoutePolicy struct {
+	// Method is an HTTP method, or "*" for any
+	Method string
+	// Path is a route template such as "/api/v1/users/:id". A trailing "*"
+	// matches every route starting with the rest.
+	Path     string
+	Requests int
+	Window   time.Duration
+	KeyBy    string
+}
+
+// Matches reports whether the policy covers a request for the route template
+func (p RoutePolicy) Matches(method, fullPath string) bool {
+	if p.Method != "*" && p.Method != method {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(p.Path, "*"); ok {
+		return strings.HasPrefix(fullPath, prefix)
+	}
+	return p.Path == fullPath
+}
+
+// ParseRoutePolicies parses entries of the form
+// "METHOD PATH REQUESTS/WINDOW KEY", such as
+// "POST /api/v1/auth/otp/generate 10/1m ip". WINDOW is a Go duration and KEY
+// is ip, phone or user.
+func ParseRoutePolicies(entries []string) ([]RoutePolicy, error) {
+	policies := make([]RoutePolicy, 0, len(entries))
+	for _, entry := range entries {
+		fields := strings.Fields(entry)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid route rate limit %q: want \"METHOD PATH REQUESTS/WINDOW KEY\"", entry)
+		}
+
+		limit, window, ok := strings.Cut(fields[2], "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid route rate limit %q: want REQUESTS/WINDOW, e.g. 10/1m", entry)
+		}
+		requests, err := strconv.Atoi(limit)
+		if err != nil || requests < 1 {
+			return nil, fmt.Errorf("invalid route rate limit %q: requests must be a positive number", entry)
+		}
+		duration, err := time.ParseDuration(window)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid route rate limit %q: window must be a positive duration", entry)
+		}
+
+		switch fields[3] {
+		case KeyByIP, KeyByPhone, KeyByUser:
+		default:
+			return nil, fmt.Errorf("invalid route rate limit %q: key must be ip, phone or user", entry)
+		}
+
+		policies = append(policies, RoutePolicy{
+			Method:   strings.ToUpper(fields[0]),
+			Path:     fields[1],
+			Requests: requests,
+			Window:   duration,
+			KeyBy:    fields[3],
+		})
+	}
+	return policies, nil
+}
+
+// Limiter counts requests per key within a sliding window
+type Limiter interface {
+	// Allow records a request for key, or reports how long until one would
+	// be allowed if the key is at its limit
+	Allow(key string) (bool, time.Duration)
+}
+
+type memoryLimiter struct {
+	mu        sync.Mutex
+	requests  int
+	window    time.Duration
+	entries   map[string][]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryLimiter returns an in-process Limiter allowing requests per window
+// for each key
+func NewMemoryLimiter(requests int, window time.Duration) Limiter {
+	return &memoryLimiter{
+		requests:  requests,
+		window:    window,
+		entries:   make(map[string][]time.Time),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (l *memoryLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	cutoff := now.Add(-l.window)
+
+	// Periodically drop keys that have gone quiet so the map doesn't grow forever
+	if now.Sub(l.lastSweep) >= l.window {
+		for k, times := range l.entries {
+			if len(times) == 0 || !times[len(times)-1].After(cutoff) {
+				delete(l.entries, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	times := l.entries[key]
+	for len(times) > 0 && !times[0].After(cutoff) {
+		times = times[1:]
+	}
+
+	if len(times) >= l.requests {
+		l.entries[key] = times
+		return false, times[0].Sub(cutoff)
+	}
+
+	l.entries[key] = append(times, now)
+	return true, 0
+}
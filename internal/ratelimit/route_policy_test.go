@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRoutePolicies(t *testing.T) {
+	policies, err := ParseRoutePolicies([]string{
+		"post /api/v1/auth/otp/verify 20/1m ip",
+		"* /api/v1/users* 120/30s user",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := RoutePolicy{Method: "POST", Path: "/api/v1/auth/otp/verify", Requests: 20, Window: time.Minute, KeyBy: KeyByIP}
+	if policies[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, policies[0])
+	}
+	if !policies[0].Matches("POST", "/api/v1/auth/otp/verify") || policies[0].Matches("POST", "/api/v1/auth/otp/generate") {
+		t.Error("Expected exact path to match only its own route")
+	}
+	if !policies[1].Matches("GET", "/api/v1/users/:id") || !policies[1].Matches("DELETE", "/api/v1/users") {
+		t.Error("Expected wildcard policy to match every method and route under the prefix")
+	}
+
+	for _, entry := range []string{
+		"POST /api/v1/auth/otp/verify 20/1m",
+		"POST /api/v1/auth/otp/verify 20 ip",
+		"POST /api/v1/auth/otp/verify 0/1m ip",
+		"POST /api/v1/auth/otp/verify 20/soon ip",
+		"POST /api/v1/auth/otp/verify 20/1m session",
+	} {
+		if _, err := ParseRoutePolicies([]string{entry}); err == nil {
+			t.Errorf("Expected %q to be rejected", entry)
+		}
+	}
+}
+
+func TestMemoryLimiter_Allow(t *testing.T) {
+	limiter := NewMemoryLimiter(2, time.Minute).(*memoryLimiter)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.Allow("ip:203.0.113.7"); !allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+	allowed, retryAfter := limiter.Allow("ip:203.0.113.7")
+	if allowed || retryAfter != time.Minute {
+		t.Errorf("Expected third request to wait a minute, got allowed=%v retryAfter=%v", allowed, retryAfter)
+	}
+
+	// Keys are limited independently
+	if allowed, _ := limiter.Allow("ip:198.51.100.1"); !allowed {
+		t.Error("Expected request for another key to be allowed")
+	}
+
+	// Requests leave the window one by one
+	now = now.Add(time.Minute)
+	if allowed, _ := limiter.Allow("ip:203.0.113.7"); !allowed {
+		t.Error("Expected request to be allowed once the window has passed")
+	}
+}
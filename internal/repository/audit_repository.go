@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"otp/internal/models"
+)
+
+// auditChainLockID serializes writers so each event links to the one before it
+const auditChainLockID = 7240001
+
+// ErrAuditChainBroken is returned by Verify when a stored event does not
+// match its hash or its predecessor's
+var ErrAuditChainBroken = errors.New("audit chain is broken")
+
+type AuditRepository interface {
+	Create(ctx context.Context, event *models.AuditEvent) error
+	List(ctx context.Context, query models.AuditEventQuery) ([]models.AuditEvent, error)
+	// ListPage returns one page of matching events, newest first, with the
+	// total number of matches
+	ListPage(ctx context.Context, query models.AuditEventQuery) (*models.AuditEventListResponse, error)
+	// Verify recomputes the hash chain over every event, oldest first,
+	// returning ErrAuditChainBroken at the first event that was modified or
+	// whose predecessor was removed
+	Verify(ctx context.Context) error
+}
+
+const auditEventColumns = "id, actor_id, action, target, ip, metadata, created_at, prev_hash, hash"
+
+type auditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Create(ctx context.Context, event *models.AuditEvent) error {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit metadata: %w", err)
+	}
+	// Store exactly what is hashed: the column keeps UTC microseconds
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", auditChainLockID); err != nil {
+		return err
+	}
+
+	var prevHash string
+	err = tx.QueryRowContext(ctx, "SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	event.PrevHash = prevHash
+	if event.Hash, err = hashAuditEvent(event); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_events (actor_id, action, target, ip, metadata, created_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+	err = tx.QueryRowContext(ctx, query,
+		event.ActorID, event.Action, event.Target, event.IP, metadata, event.CreatedAt, event.PrevHash, event.Hash,
+	).Scan(&event.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *auditRepository) List(ctx context.Context, query models.AuditEventQuery) ([]models.AuditEvent, error) {
+	whereClause, args := buildAuditFilter(query)
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = 100
+	}
+	args = append(args, limit)
+
+	listQuery := fmt.Sprintf(`
+		SELECT %s
+		FROM audit_events
+		%s
+		ORDER BY id DESC
+		LIMIT $%d
+	`, auditEventColumns, whereClause, len(args))
+
+	rows, err := r.db.QueryContext(ctx, listQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (r *auditRepository) ListPage(ctx context.Context, query models.AuditEventQuery) (*models.AuditEventListResponse, error) {
+	whereClause, args := buildAuditFilter(query)
+
+	events := []models.AuditEvent{}
+	total, err := paginate(ctx, r.db, auditEventColumns, "FROM audit_events", whereClause, "id DESC", args, query.Pagination,
+		func(rows *sql.Rows) error {
+			event, err := scanAuditEvent(rows)
+			if err != nil {
+				return err
+			}
+			events = append(events, event)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuditEventListResponse{
+		Events:     events,
+		Total:      total,
+		Page:       query.Page,
+		PageSize:   query.PageSize,
+		TotalPages: query.TotalPages(total),
+	}, nil
+}
+
+func (r *auditRepository) Verify(ctx context.Context) error {
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM audit_events ORDER BY id", auditEventColumns))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	prevHash := ""
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return err
+		}
+		if event.PrevHash != prevHash {
+			return fmt.Errorf("%w: event %d does not follow the event before it", ErrAuditChainBroken, event.ID)
+		}
+		hash, err := hashAuditEvent(&event)
+		if err != nil {
+			return err
+		}
+		if hash != event.Hash {
+			return fmt.Errorf("%w: event %d was modified", ErrAuditChainBroken, event.ID)
+		}
+		prevHash = event.Hash
+	}
+	return rows.Err()
+}
+
+func buildAuditFilter(query models.AuditEventQuery) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	if query.ActorID != "" {
+		addCondition("actor_id = $%d", query.ActorID)
+	}
+	if query.Action != "" {
+		addCondition("action = $%d", query.Action)
+	}
+	if query.Target != "" {
+		addCondition("target = $%d", query.Target)
+	}
+	if query.Since != nil {
+		addCondition("created_at >= $%d", *query.Since)
+	}
+	if query.Until != nil {
+		addCondition("created_at < $%d", *query.Until)
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	return whereClause, args
+}
+
+func scanAuditEvent(rows *sql.Rows) (models.AuditEvent, error) {
+	var event models.AuditEvent
+	var metadata []byte
+	err := rows.Scan(
+		&event.ID,
+		&event.ActorID,
+		&event.Action,
+		&event.Target,
+		&event.IP,
+		&metadata,
+		&event.CreatedAt,
+		&event.PrevHash,
+		&event.Hash,
+	)
+	if err != nil {
+		return event, err
+	}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &event.Metadata); err != nil {
+			return event, fmt.Errorf("failed to decode audit metadata: %w", err)
+		}
+	}
+	return event, nil
+}
+
+// hashAuditEvent chains an event to its predecessor so that editing or
+// deleting a row breaks every hash that follows it. It hashes the event as
+// the database gives it back, so that Verify gets the same result: the time
+// at microsecond precision and the metadata as canonical JSON, since JSONB
+// reorders keys and numbers come back as floats.
+func hashAuditEvent(event *models.AuditEvent) (string, error) {
+	metadata, err := canonicalJSON(event.Metadata)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit metadata: %w", err)
+	}
+
+	h := sha256.New()
+	createdAt := event.CreatedAt.UTC().Truncate(time.Microsecond)
+	fmt.Fprintf(h, "%s|%s|%s|%s|%s|%s|", event.PrevHash, event.ActorID, event.Action, event.Target, event.IP, createdAt.Format(time.RFC3339Nano))
+	h.Write(metadata)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// canonicalJSON encodes value after a round trip through JSON, which sorts
+// object keys at every level and gives numbers one spelling
+func canonicalJSON(value interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, err
+	}
+	return json.Marshal(decoded)
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"otp/internal/models"
+)
+
+// fakeAuditTable stores the rows auditRepository inserts into a fakeDB,
+// giving metadata back with its keys reordered as JSONB does
+type fakeAuditTable struct {
+	rows [][]driver.Value
+}
+
+func (t *fakeAuditTable) respond(query string, args []driver.Value) (*fakeRows, error) {
+	switch {
+	case strings.Contains(query, "SELECT hash FROM audit_events"):
+		if len(t.rows) == 0 {
+			return &fakeRows{columns: []string{"hash"}}, nil
+		}
+		return &fakeRows{columns: []string{"hash"}, values: [][]driver.Value{{t.rows[len(t.rows)-1][8]}}}, nil
+	case strings.Contains(query, "INSERT INTO audit_events"):
+		id := int64(len(t.rows) + 1)
+		t.rows = append(t.rows, []driver.Value{id, args[0], args[1], args[2], args[3], reverseJSONKeys(args[4].([]byte)), args[5], args[6], args[7]})
+		return &fakeRows{columns: []string{"id"}, values: [][]driver.Value{{id}}}, nil
+	case strings.Contains(query, "FROM audit_events ORDER BY id"):
+		return &fakeRows{columns: strings.Split(auditEventColumns, ", "), values: t.rows}, nil
+	}
+	return nil, nil
+}
+
+// reverseJSONKeys rewrites a flat JSON object with its keys in reverse order
+func reverseJSONKeys(object []byte) []byte {
+	trimmed := strings.TrimSuffix(strings.TrimPrefix(string(object), "{"), "}")
+	if trimmed == "" || trimmed == string(object) {
+		return object
+	}
+	members := strings.Split(trimmed, ",")
+	for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+		members[i], members[j] = members[j], members[i]
+	}
+	return []byte("{" + strings.Join(members, ",") + "}")
+}
+
+func newAuditChain(t *testing.T) (AuditRepository, *fakeAuditTable) {
+	t.Helper()
+	table := &fakeAuditTable{}
+	db, _ := newFakeDB(t, table.respond)
+	repo := NewAuditRepository(db)
+
+	// Local times with nanoseconds, as time.Now gives them
+	createdAt := time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.FixedZone("CET", 3600))
+	events := []*models.AuditEvent{
+		{ActorID: "admin-1", Action: "user.delete", Target: "user-1", IP: "203.0.113.7", CreatedAt: createdAt,
+			Metadata: map[string]interface{}{"reason": "spam", "count": 3, "masked_phone": "+1******890"}},
+		{ActorID: "admin-1", Action: "maintenance.update", Target: "maintenance", CreatedAt: createdAt.Add(time.Second)},
+		{ActorID: "admin-2", Action: "user.status_update", Target: "user-2", CreatedAt: createdAt.Add(2 * time.Second),
+			Metadata: map[string]interface{}{"status": "suspended", "previous": "active"}},
+	}
+	for _, event := range events {
+		if err := repo.Create(context.Background(), event); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+	}
+	return repo, table
+}
+
+func TestAuditRepository_Verify(t *testing.T) {
+	repo, table := newAuditChain(t)
+
+	if err := repo.Verify(context.Background()); err != nil {
+		t.Fatalf("Expected the stored chain to verify, got %v", err)
+	}
+	if table.rows[1][7] != table.rows[0][8] {
+		t.Error("Expected each event to link to the previous one")
+	}
+}
+
+func TestAuditRepository_VerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(table *fakeAuditTable)
+	}{
+		{"edited metadata", func(table *fakeAuditTable) {
+			table.rows[0][5] = []byte(`{"reason":"requested by user","count":3,"masked_phone":"+1******890"}`)
+		}},
+		{"edited actor", func(table *fakeAuditTable) { table.rows[1][1] = "admin-2" }},
+		{"edited timestamp", func(table *fakeAuditTable) {
+			table.rows[2][6] = table.rows[2][6].(time.Time).Add(-time.Hour)
+		}},
+		{"deleted event", func(table *fakeAuditTable) {
+			table.rows = append(table.rows[:1], table.rows[2:]...)
+		}},
+		{"rehashed event", func(table *fakeAuditTable) {
+			// Recomputing an edited row's own hash still breaks the link
+			// from the event after it
+			table.rows[1][1] = "admin-2"
+			event := models.AuditEvent{ActorID: "admin-2", Action: "maintenance.update", Target: "maintenance",
+				CreatedAt: table.rows[1][6].(time.Time), PrevHash: table.rows[1][7].(string)}
+			table.rows[1][8], _ = hashAuditEvent(&event)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, table := newAuditChain(t)
+			tt.tamper(table)
+
+			if err := repo.Verify(context.Background()); !errors.Is(err, ErrAuditChainBroken) {
+				t.Errorf("Expected ErrAuditChainBroken, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"otp/internal/models"
+)
+
+// CacheCounter counts cache hits or misses; *metrics.Counter satisfies it
+type CacheCounter interface {
+	Inc()
+}
+
+// UserCacheOptions configures NewCachedUserRepository
+type UserCacheOptions struct {
+	// Size is the most users kept; the least recently used is evicted first
+	Size int
+	// TTL is how long a cached user is served before it is read again
+	TTL time.Duration
+	// Hits and Misses are optional counters for the cache hit ratio
+	Hits   CacheCounter
+	Misses CacheCounter
+}
+
+type cachedUser struct {
+	user      *models.User
+	expiresAt time.Time
+}
+
+type cachedUserRepository struct {
+	UserRepository
+
+	mu      sync.Mutex
+	opts    UserCacheOptions
+	entries map[string]*list.Element
+	byPhone map[string]string
+	order   *list.List
+	now     func() time.Time
+}
+
+// NewCachedUserRepository wraps repo with an in-process LRU cache for
+// GetByID and GetByPhoneNumber. Updates and deletes made through the wrapper
+// invalidate the user, but changes made by other instances are only seen
+// once the TTL expires, so keep it short when running more than one. Other
+// methods, including GetStatus, always reach repo.
+func NewCachedUserRepository(repo UserRepository, opts UserCacheOptions) UserRepository {
+	return &cachedUserRepository{
+		UserRepository: repo,
+		opts:           opts,
+		entries:        make(map[string]*list.Element),
+		byPhone:        make(map[string]string),
+		order:          list.New(),
+		now:            time.Now,
+	}
+}
+
+func (r *cachedUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	if user := r.lookup(id); user != nil {
+		return user, nil
+	}
+	user, err := r.UserRepository.GetByID(ctx, id)
+	if err != nil || user == nil {
+		return user, err
+	}
+	r.store(user)
+	return user, nil
+}
+
+func (r *cachedUserRepository) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error) {
+	r.mu.Lock()
+	id, ok := r.byPhone[phoneNumber]
+	r.mu.Unlock()
+	if ok {
+		if user := r.lookup(id); user != nil {
+			return user, nil
+		}
+	} else {
+		r.count(r.opts.Misses)
+	}
+
+	user, err := r.UserRepository.GetByPhoneNumber(ctx, phoneNumber)
+	if err != nil || user == nil {
+		return user, err
+	}
+	r.store(user)
+	return user, nil
+}
+
+func (r *cachedUserRepository) Update(ctx context.Context, user *models.User) error {
+	// Invalidate after the write as well, in case a read repopulated the
+	// entry with the old row while the update was in flight
+	r.invalidate(user.ID)
+	err := r.UserRepository.Update(ctx, user)
+	r.invalidate(user.ID)
+	return err
+}
+
+func (r *cachedUserRepository) SetStatus(ctx context.Context, id string, status models.UserStatus) (*models.User, error) {
+	r.invalidate(id)
+	user, err := r.UserRepository.SetStatus(ctx, id, status)
+	r.invalidate(id)
+	return user, err
+}
+
+func (r *cachedUserRepository) UpdateMetadata(ctx context.Context, id string, previous, metadata models.Metadata) (bool, error) {
+	// Invalidate even when nothing was updated, since a stale cached row is
+	// the likely reason previous no longer matched
+	r.invalidate(id)
+	updated, err := r.UserRepository.UpdateMetadata(ctx, id, previous, metadata)
+	r.invalidate(id)
+	return updated, err
+}
+
+func (r *cachedUserRepository) Delete(ctx context.Context, id string) error {
+	r.invalidate(id)
+	err := r.UserRepository.Delete(ctx, id)
+	r.invalidate(id)
+	return err
+}
+
+// lookup returns a copy of the cached user, counting the hit or miss
+func (r *cachedUserRepository) lookup(id string) *models.User {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	element, ok := r.entries[id]
+	if !ok {
+		r.count(r.opts.Misses)
+		return nil
+	}
+	entry := element.Value.(*cachedUser)
+	if !r.now().Before(entry.expiresAt) {
+		r.remove(element)
+		r.count(r.opts.Misses)
+		return nil
+	}
+	r.order.MoveToFront(element)
+	r.count(r.opts.Hits)
+	return copyUser(entry.user)
+}
+
+func (r *cachedUserRepository) store(user *models.User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if element, ok := r.entries[user.ID]; ok {
+		r.remove(element)
+	}
+	r.entries[user.ID] = r.order.PushFront(&cachedUser{
+		user:      copyUser(user),
+		expiresAt: r.now().Add(r.opts.TTL),
+	})
+	r.byPhone[user.PhoneNumber] = user.ID
+
+	for r.order.Len() > r.opts.Size {
+		r.remove(r.order.Back())
+	}
+}
+
+func (r *cachedUserRepository) invalidate(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if element, ok := r.entries[id]; ok {
+		r.remove(element)
+	}
+}
+
+// remove drops an entry and its phone index; callers hold mu
+func (r *cachedUserRepository) remove(element *list.Element) {
+	user := r.order.Remove(element).(*cachedUser).user
+	delete(r.entries, user.ID)
+	if r.byPhone[user.PhoneNumber] == user.ID {
+		delete(r.byPhone, user.PhoneNumber)
+	}
+}
+
+func (r *cachedUserRepository) count(counter CacheCounter) {
+	if counter != nil {
+		counter.Inc()
+	}
+}
+
+// copyUser returns a copy callers can modify without changing the cached user
+func copyUser(user *models.User) *models.User {
+	copied := *user
+	if user.LastLoginAt != nil {
+		lastLogin := *user.LastLoginAt
+		copied.LastLoginAt = &lastLogin
+	}
+	if user.RecoveryPhone != nil {
+		recoveryPhone := *user.RecoveryPhone
+		copied.RecoveryPhone = &recoveryPhone
+	}
+	if user.Metadata != nil {
+		copied.Metadata = user.Metadata.Merge(nil)
+	}
+	return &copied
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"otp/internal/models"
+)
+
+type countingUserRepository struct {
+	UserRepository
+	users map[string]*models.User
+	reads int
+}
+
+func (r *countingUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	r.reads++
+	user, ok := r.users[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *countingUserRepository) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error) {
+	r.reads++
+	for _, user := range r.users {
+		if user.PhoneNumber == phoneNumber {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *countingUserRepository) Update(ctx context.Context, user *models.User) error {
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+type testCounter struct {
+	value int
+}
+
+func (c *testCounter) Inc() {
+	c.value++
+}
+
+func TestCachedUserRepository(t *testing.T) {
+	ctx := context.Background()
+	first := models.NewUser("+14155550001")
+	second := models.NewUser("+14155550002")
+	inner := &countingUserRepository{users: map[string]*models.User{first.ID: first, second.ID: second}}
+	hits, misses := &testCounter{}, &testCounter{}
+	repo := NewCachedUserRepository(inner, UserCacheOptions{Size: 1, TTL: time.Minute, Hits: hits, Misses: misses}).(*cachedUserRepository)
+	now := time.Now()
+	repo.now = func() time.Time { return now }
+
+	// The second lookup, by ID or phone number, is served from the cache
+	if _, err := repo.GetByID(ctx, first.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	user, _ := repo.GetByPhoneNumber(ctx, first.PhoneNumber)
+	if user == nil || user.ID != first.ID || inner.reads != 1 {
+		t.Fatalf("Expected cached user after 1 read, got %+v after %d reads", user, inner.reads)
+	}
+	if hits.value != 1 || misses.value != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %d and %d", hits.value, misses.value)
+	}
+
+	// Changing the returned user does not change the cached one
+	user.PhoneNumber = "+14155559999"
+	if cached, _ := repo.GetByID(ctx, first.ID); cached.PhoneNumber != first.PhoneNumber {
+		t.Errorf("Expected cached phone number %s, got %s", first.PhoneNumber, cached.PhoneNumber)
+	}
+
+	// An update invalidates the user so the next read sees the new row
+	user.SetStatus(models.UserStatusSuspended)
+	if err := repo.Update(ctx, user); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := repo.byPhone[first.PhoneNumber]; ok {
+		t.Error("Expected the old phone number to be dropped from the cache")
+	}
+	if updated, _ := repo.GetByID(ctx, first.ID); updated.Status != models.UserStatusSuspended || inner.reads != 2 {
+		t.Errorf("Expected updated user from the repository, got %+v after %d reads", updated, inner.reads)
+	}
+
+	// With room for one user, caching the second evicts the first
+	repo.GetByID(ctx, second.ID)
+	repo.GetByID(ctx, first.ID)
+	if inner.reads != 4 {
+		t.Errorf("Expected the least recently used user to be evicted, got %d reads", inner.reads)
+	}
+
+	// Entries are read again once the TTL has passed
+	now = now.Add(time.Minute)
+	repo.GetByID(ctx, first.ID)
+	if inner.reads != 5 {
+		t.Errorf("Expected an expired entry to be read again, got %d reads", inner.reads)
+	}
+
+	// Missing users are not cached
+	repo.GetByID(ctx, "missing")
+	repo.GetByID(ctx, "missing")
+	if inner.reads != 7 {
+		t.Errorf("Expected missing users to be read every time, got %d reads", inner.reads)
+	}
+}
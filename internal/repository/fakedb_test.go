@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeStatement is a query or exec the repository sent to a fakeDB
+type fakeStatement struct {
+	query string
+	args  []driver.Value
+}
+
+// fakeRows is what a fakeDB answers to a statement
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+// fakeDB is a database/sql driver that records every statement and answers
+// each with respond, so repository SQL can be checked without PostgreSQL.
+// respond may return nil rows for statements that return none.
+type fakeDB struct {
+	mu         sync.Mutex
+	statements []fakeStatement
+	respond    func(query string, args []driver.Value) (*fakeRows, error)
+}
+
+func newFakeDB(t *testing.T, respond func(query string, args []driver.Value) (*fakeRows, error)) (*sql.DB, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{respond: respond}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+	return db, fake
+}
+
+// find returns the recorded statements whose query contains substr
+func (f *fakeDB) find(substr string) []fakeStatement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var found []fakeStatement
+	for _, statement := range f.statements {
+		if strings.Contains(statement.query, substr) {
+			found = append(found, statement)
+		}
+	}
+	return found
+}
+
+func (f *fakeDB) run(query string, named []driver.NamedValue) (*fakeRows, error) {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+	f.mu.Lock()
+	f.statements = append(f.statements, fakeStatement{query: query, args: args})
+	f.mu.Unlock()
+	if f.respond == nil {
+		return nil, nil
+	}
+	return f.respond(query, args)
+}
+
+func (f *fakeDB) Connect(ctx context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                            { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fakedb: prepared statements are not supported")
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = &fakeRows{}
+	}
+	return &fakeRowsCursor{rows: rows}, nil
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	affected := int64(1)
+	if rows != nil {
+		affected = int64(len(rows.values))
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRowsCursor struct {
+	rows *fakeRows
+	next int
+}
+
+func (r *fakeRowsCursor) Columns() []string { return r.rows.columns }
+func (r *fakeRowsCursor) Close() error      { return nil }
+
+func (r *fakeRowsCursor) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows.values) {
+		return io.EOF
+	}
+	copy(dest, r.rows.values[r.next])
+	r.next++
+	return nil
+}
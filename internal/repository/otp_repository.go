@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"otp/internal/models"
@@ -11,79 +12,296 @@ import (
 type OTPRepository interface {
 	Create(ctx context.Context, otp *models.OTP) error
 	GetByPhoneNumber(ctx context.Context, phoneNumber string) (*models.OTP, error)
+	GetRecentByPhoneNumber(ctx context.Context, phoneNumber string, limit int) ([]*models.OTP, error)
+	GetLatestByPhoneNumber(ctx context.Context, phoneNumber string) (*models.OTP, error)
+	ListByPhoneNumber(ctx context.Context, phoneNumber string) ([]*models.OTP, error)
 	MarkAsUsed(ctx context.Context, phoneNumber string) error
-	DeleteExpired(ctx context.Context) error
+	ConsumeUse(ctx context.Context, otp *models.OTP) (int, error)
+	DeleteExpired(ctx context.Context, createdBefore time.Time) (int, error)
 	GetRecentOTPCount(ctx context.Context, phoneNumber string, since time.Time) (int, error)
+	ResetRateLimit(ctx context.Context, phoneNumber string, since time.Time) (int, error)
+	CountRows(ctx context.Context) (total int, expired int, err error)
 }
 
+// ErrOTPUnavailable is returned by ConsumeUse for an OTP with no uses left
+var ErrOTPUnavailable = errors.New("OTP is no longer available")
+
 type otpRepository struct {
-	db *sql.DB
+	db           *sql.DB
+	queryTimeout time.Duration
+	phones       *PhoneProtector
 }
 
-func NewOTPRepository(db *sql.DB) OTPRepository {
-	return &otpRepository{db: db}
+// NewOTPRepository returns an OTPRepository backed by db. Each query is
+// cancelled after queryTimeout; 0 disables the limit. With phones set, phone
+// numbers are stored as keyed hashes; OTPs read back carry the number they
+// were looked up by.
+func NewOTPRepository(db *sql.DB, queryTimeout time.Duration, phones *PhoneProtector) OTPRepository {
+	return &otpRepository{db: db, queryTimeout: queryTimeout, phones: phones}
 }
 
 func (r *otpRepository) Create(ctx context.Context, otp *models.OTP) error {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
 	query := `
-		INSERT INTO otps (phone_number, code, expires_at, created_at, used)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO otps (phone_number, code, expires_at, created_at, used, request_id, ip, uses_remaining)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8)
 	`
-	_, err := r.db.ExecContext(ctx, query, otp.PhoneNumber, otp.Code, otp.ExpiresAt, otp.CreatedAt, otp.Used)
-	return err
+	_, err := r.db.ExecContext(ctx, query, r.phones.lookup(otp.PhoneNumber), otp.Code, otp.ExpiresAt, otp.CreatedAt, otp.Used, otp.RequestID, otp.IP, otp.UsesRemaining)
+	return queryError(ctx, err)
 }
 
 func (r *otpRepository) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*models.OTP, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
 	query := `
-		SELECT phone_number, code, expires_at, created_at, used
+		SELECT phone_number, code, expires_at, created_at, used, COALESCE(request_id, ''), COALESCE(ip, '')
 		FROM otps
 		WHERE phone_number = $1 AND used = false AND expires_at > NOW()
 		ORDER BY created_at DESC
 		LIMIT 1
 	`
 	otp := &models.OTP{}
-	err := r.db.QueryRowContext(ctx, query, phoneNumber).Scan(
+	err := r.db.QueryRowContext(ctx, query, r.phones.lookup(phoneNumber)).Scan(
 		&otp.PhoneNumber,
 		&otp.Code,
 		&otp.ExpiresAt,
 		&otp.CreatedAt,
 		&otp.Used,
+		&otp.RequestID,
+		&otp.IP,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		return nil, err
+		return nil, queryError(ctx, err)
 	}
+	otp.PhoneNumber = phoneNumber
 	return otp, nil
 }
 
+func (r *otpRepository) GetRecentByPhoneNumber(ctx context.Context, phoneNumber string, limit int) ([]*models.OTP, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT phone_number, code, expires_at, created_at, used, COALESCE(request_id, ''), COALESCE(ip, '')
+		FROM otps
+		WHERE phone_number = $1 AND used = false AND expires_at > NOW()
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	rows, err := r.db.QueryContext(ctx, query, r.phones.lookup(phoneNumber), limit)
+	if err != nil {
+		return nil, queryError(ctx, err)
+	}
+	defer rows.Close()
+
+	var otps []*models.OTP
+	for rows.Next() {
+		otp := &models.OTP{}
+		err := rows.Scan(
+			&otp.PhoneNumber,
+			&otp.Code,
+			&otp.ExpiresAt,
+			&otp.CreatedAt,
+			&otp.Used,
+			&otp.RequestID,
+			&otp.IP,
+		)
+		if err != nil {
+			return nil, queryError(ctx, err)
+		}
+		otp.PhoneNumber = phoneNumber
+		otps = append(otps, otp)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, queryError(ctx, err)
+	}
+
+	return otps, nil
+}
+
+// GetLatestByPhoneNumber returns the most recent OTP for the phone number
+// regardless of whether it has been used or has expired.
+func (r *otpRepository) GetLatestByPhoneNumber(ctx context.Context, phoneNumber string) (*models.OTP, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT phone_number, code, expires_at, created_at, used, COALESCE(request_id, ''), COALESCE(ip, '')
+		FROM otps
+		WHERE phone_number = $1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	otp := &models.OTP{}
+	err := r.db.QueryRowContext(ctx, query, r.phones.lookup(phoneNumber)).Scan(
+		&otp.PhoneNumber,
+		&otp.Code,
+		&otp.ExpiresAt,
+		&otp.CreatedAt,
+		&otp.Used,
+		&otp.RequestID,
+		&otp.IP,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, queryError(ctx, err)
+	}
+	otp.PhoneNumber = phoneNumber
+	return otp, nil
+}
+
+// ListByPhoneNumber returns every OTP stored for the phone number, newest
+// first, whether or not it has been used or has expired
+func (r *otpRepository) ListByPhoneNumber(ctx context.Context, phoneNumber string) ([]*models.OTP, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT phone_number, code, expires_at, created_at, used, COALESCE(request_id, ''), COALESCE(ip, '')
+		FROM otps
+		WHERE phone_number = $1
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, r.phones.lookup(phoneNumber))
+	if err != nil {
+		return nil, queryError(ctx, err)
+	}
+	defer rows.Close()
+
+	var otps []*models.OTP
+	for rows.Next() {
+		otp := &models.OTP{}
+		err := rows.Scan(
+			&otp.PhoneNumber,
+			&otp.Code,
+			&otp.ExpiresAt,
+			&otp.CreatedAt,
+			&otp.Used,
+			&otp.RequestID,
+			&otp.IP,
+		)
+		if err != nil {
+			return nil, queryError(ctx, err)
+		}
+		otp.PhoneNumber = phoneNumber
+		otps = append(otps, otp)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, queryError(ctx, err)
+	}
+
+	return otps, nil
+}
+
 func (r *otpRepository) MarkAsUsed(ctx context.Context, phoneNumber string) error {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
 	query := `
 		UPDATE otps
 		SET used = true
 		WHERE phone_number = $1 AND used = false
 	`
-	_, err := r.db.ExecContext(ctx, query, phoneNumber)
-	return err
+	_, err := r.db.ExecContext(ctx, query, r.phones.lookup(phoneNumber))
+	return queryError(ctx, err)
+}
+
+// ConsumeUse takes one use from a pending OTP, marking it used when none are
+// left, and returns how many remain. It returns ErrOTPUnavailable if the OTP
+// was used up or expired in the meantime, so concurrent verifications cannot
+// spend the same use twice.
+func (r *otpRepository) ConsumeUse(ctx context.Context, otp *models.OTP) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE otps
+		SET uses_remaining = uses_remaining - 1, used = uses_remaining <= 1
+		WHERE phone_number = $1 AND code = $2 AND created_at = $3
+			AND used = false AND uses_remaining > 0 AND expires_at > NOW()
+		RETURNING uses_remaining
+	`
+	var remaining int
+	err := r.db.QueryRowContext(ctx, query, r.phones.lookup(otp.PhoneNumber), otp.Code, otp.CreatedAt).Scan(&remaining)
+	if err == sql.ErrNoRows {
+		return 0, ErrOTPUnavailable
+	}
+	return remaining, queryError(ctx, err)
 }
 
-func (r *otpRepository) DeleteExpired(ctx context.Context) error {
+// DeleteExpired deletes expired OTPs created before createdBefore and
+// returns how many it removed. Newer expired OTPs are kept so they still
+// count toward rate limits.
+func (r *otpRepository) DeleteExpired(ctx context.Context, createdBefore time.Time) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
 	query := `
 		DELETE FROM otps
-		WHERE expires_at < NOW()
+		WHERE expires_at < NOW() AND created_at < $1
 	`
-	_, err := r.db.ExecContext(ctx, query)
-	return err
+	result, err := r.db.ExecContext(ctx, query, createdBefore)
+	if err != nil {
+		return 0, queryError(ctx, err)
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
 }
 
 func (r *otpRepository) GetRecentOTPCount(ctx context.Context, phoneNumber string, since time.Time) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
 	query := `
 		SELECT COUNT(*)
 		FROM otps
-		WHERE phone_number = $1 AND created_at >= $2
+		WHERE phone_number = $1 AND created_at >= $2 AND counts_toward_limit
 	`
 	var count int
-	err := r.db.QueryRowContext(ctx, query, phoneNumber, since).Scan(&count)
-	return count, err
+	err := r.db.QueryRowContext(ctx, query, r.phones.lookup(phoneNumber), since).Scan(&count)
+	return count, queryError(ctx, err)
+}
+
+// ResetRateLimit stops the phone number's OTPs created since the given time
+// from counting toward rate limits, returning how many were affected. The
+// OTPs themselves are kept, so pending codes stay valid.
+func (r *otpRepository) ResetRateLimit(ctx context.Context, phoneNumber string, since time.Time) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE otps
+		SET counts_toward_limit = FALSE
+		WHERE phone_number = $1 AND created_at >= $2 AND counts_toward_limit
+	`
+	result, err := r.db.ExecContext(ctx, query, r.phones.lookup(phoneNumber), since)
+	if err != nil {
+		return 0, queryError(ctx, err)
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+// CountRows returns the number of OTP rows and how many of them have expired
+func (r *otpRepository) CountRows(ctx context.Context) (int, int, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE expires_at < NOW())
+		FROM otps
+	`
+	var total, expired int
+	err := r.db.QueryRowContext(ctx, query).Scan(&total, &expired)
+	return total, expired, queryError(ctx, err)
 }
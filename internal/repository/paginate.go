@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"otp/internal/models"
+)
+
+// paginate counts the rows matching "<from> <where>" and scans one page of
+// them, selected by columns in orderBy order. args are the where clause's
+// positional arguments; the limit and offset placeholders follow them.
+func paginate(ctx context.Context, db *sql.DB, columns, from, where, orderBy string, args []interface{}, page models.Pagination, scan func(*sql.Rows) error) (int, error) {
+	var total int
+	countQuery := fmt.Sprintf("SELECT COUNT(*) %s %s", from, where)
+	if err := db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return 0, err
+	}
+
+	pageQuery := fmt.Sprintf(`
+		SELECT %s
+		%s %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, columns, from, where, orderBy, len(args)+1, len(args)+2)
+	pageArgs := append(append([]interface{}{}, args...), page.GetLimit(), page.GetOffset())
+
+	rows, err := db.QueryContext(ctx, pageQuery, pageArgs...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return 0, err
+		}
+	}
+	return total, rows.Err()
+}
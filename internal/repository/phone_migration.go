@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ProtectPlaintextUsers hashes and encrypts the phone numbers of users
+// written before HASH_PHONE_NUMBERS was enabled, which would otherwise no
+// longer be found by number. Such rows are the ones without an encrypted
+// copy. It returns how many users were converted.
+func ProtectPlaintextUsers(ctx context.Context, db *sql.DB, phones *PhoneProtector) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, phone_number, recovery_phone FROM users WHERE phone_number_encrypted IS NULL FOR UPDATE`)
+	if err != nil {
+		return 0, err
+	}
+	type plaintextUser struct {
+		id            string
+		phoneNumber   string
+		recoveryPhone *string
+	}
+	var users []plaintextUser
+	for rows.Next() {
+		var user plaintextUser
+		if err := rows.Scan(&user.id, &user.phoneNumber, &user.recoveryPhone); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		users = append(users, user)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, user := range users {
+		phoneNumber, err := phones.encrypted(&user.phoneNumber)
+		if err != nil {
+			return 0, err
+		}
+		recoveryPhone, err := phones.encrypted(user.recoveryPhone)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE users
+			SET phone_number = $2, recovery_phone = $3, phone_number_encrypted = $4, recovery_phone_encrypted = $5
+			WHERE id = $1
+		`, user.id, phones.lookup(user.phoneNumber), phones.lookupOptional(user.recoveryPhone), phoneNumber, recoveryPhone)
+		if err != nil {
+			return 0, fmt.Errorf("failed to protect phone numbers of user %s: %w", user.id, err)
+		}
+	}
+
+	return len(users), tx.Commit()
+}
+
+// ProtectPlaintextOTPs replaces the plain phone numbers of OTPs written
+// before HASH_PHONE_NUMBERS was enabled with their hashes, so pending codes
+// and rate-limit history carry over. Plain numbers are told apart by their
+// leading "+", which a hex hash never has. It returns how many numbers were
+// converted.
+func ProtectPlaintextOTPs(ctx context.Context, db *sql.DB, phones *PhoneProtector) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT DISTINCT phone_number FROM otps WHERE phone_number LIKE '+%'`)
+	if err != nil {
+		return 0, err
+	}
+	var phoneNumbers []string
+	for rows.Next() {
+		var phoneNumber string
+		if err := rows.Scan(&phoneNumber); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		phoneNumbers = append(phoneNumbers, phoneNumber)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, phoneNumber := range phoneNumbers {
+		if _, err := tx.ExecContext(ctx, `UPDATE otps SET phone_number = $2 WHERE phone_number = $1`, phoneNumber, phones.lookup(phoneNumber)); err != nil {
+			return 0, fmt.Errorf("failed to protect OTP phone numbers: %w", err)
+		}
+	}
+
+	return len(phoneNumbers), tx.Commit()
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"otp/internal/validation"
+)
+
+// PhoneKeySize is the length in bytes of both phone protection keys
+const PhoneKeySize = 32
+
+// PhoneProtector keeps raw phone numbers out of the database. Each number is
+// stored as an HMAC-SHA256 hash, which supports equality lookups, alongside an
+// AES-256-GCM encrypted copy for showing it back. A nil *PhoneProtector
+// stores numbers as they are.
+type PhoneProtector struct {
+	hashKey []byte
+	aead    cipher.AEAD
+}
+
+// NewPhoneProtector hashes with hashKey and encrypts with encryptionKey, each
+// PhoneKeySize bytes. The keys must be different.
+func NewPhoneProtector(hashKey, encryptionKey []byte) (*PhoneProtector, error) {
+	if len(hashKey) != PhoneKeySize || len(encryptionKey) != PhoneKeySize {
+		return nil, fmt.Errorf("phone protection keys must be %d bytes", PhoneKeySize)
+	}
+	if hmac.Equal(hashKey, encryptionKey) {
+		return nil, errors.New("phone hash and encryption keys must differ")
+	}
+
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &PhoneProtector{hashKey: append([]byte(nil), hashKey...), aead: aead}, nil
+}
+
+// Hash returns the lookup hash of phoneNumber. The number is put in E.164
+// form first, as the service does, so that equivalent spellings hash alike;
+// numbers that can't be are hashed with just formatting stripped.
+func (p *PhoneProtector) Hash(phoneNumber string) string {
+	canonical, err := validation.CanonicalPhoneNumber(phoneNumber, "")
+	if err != nil {
+		canonical = validation.NormalizePhoneNumber(phoneNumber)
+	}
+	mac := hmac.New(sha256.New, p.hashKey)
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Encrypt returns phoneNumber sealed with a random nonce, base64-encoded
+func (p *PhoneProtector) Encrypt(phoneNumber string) (string, error) {
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := p.aead.Seal(nonce, nonce, []byte(phoneNumber), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt
+func (p *PhoneProtector) Decrypt(encrypted string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode phone number: %w", err)
+	}
+	if len(sealed) < p.aead.NonceSize() {
+		return "", errors.New("failed to decrypt phone number: too short")
+	}
+	nonce, ciphertext := sealed[:p.aead.NonceSize()], sealed[p.aead.NonceSize():]
+	phoneNumber, err := p.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt phone number: %w", err)
+	}
+	return string(phoneNumber), nil
+}
+
+// lookup returns what the phone_number column holds for phoneNumber
+func (p *PhoneProtector) lookup(phoneNumber string) string {
+	if p == nil {
+		return phoneNumber
+	}
+	return p.Hash(phoneNumber)
+}
+
+// lookupOptional is lookup for nullable columns
+func (p *PhoneProtector) lookupOptional(phoneNumber *string) *string {
+	if phoneNumber == nil {
+		return nil
+	}
+	stored := p.lookup(*phoneNumber)
+	return &stored
+}
+
+// encrypted returns what the encrypted display column holds for
+// phoneNumber: NULL when numbers are stored as they are
+func (p *PhoneProtector) encrypted(phoneNumber *string) (*string, error) {
+	if p == nil || phoneNumber == nil {
+		return nil, nil
+	}
+	encrypted, err := p.Encrypt(*phoneNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt phone number: %w", err)
+	}
+	return &encrypted, nil
+}
+
+// reveal replaces a stored hash with the number decrypted from its display
+// column. Rows written before hashing was enabled have no display column
+// and are left as they are.
+func (p *PhoneProtector) reveal(stored *string, encrypted sql.NullString) error {
+	if p == nil || !encrypted.Valid {
+		return nil
+	}
+	phoneNumber, err := p.Decrypt(encrypted.String)
+	if err != nil {
+		return err
+	}
+	*stored = phoneNumber
+	return nil
+}
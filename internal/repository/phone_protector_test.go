@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+)
+
+func newTestPhoneProtector(t *testing.T, hashByte, encryptionByte byte) *PhoneProtector {
+	t.Helper()
+	phones, err := NewPhoneProtector(bytes.Repeat([]byte{hashByte}, PhoneKeySize), bytes.Repeat([]byte{encryptionByte}, PhoneKeySize))
+	if err != nil {
+		t.Fatalf("NewPhoneProtector returned error: %v", err)
+	}
+	return phones
+}
+
+func TestNewPhoneProtector_RejectsBadKeys(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, PhoneKeySize)
+	other := bytes.Repeat([]byte{2}, PhoneKeySize)
+
+	if _, err := NewPhoneProtector(key[:16], other); err == nil {
+		t.Error("expected an error for a short hash key")
+	}
+	if _, err := NewPhoneProtector(key, other[:16]); err == nil {
+		t.Error("expected an error for a short encryption key")
+	}
+	if _, err := NewPhoneProtector(key, key); err == nil {
+		t.Error("expected an error for identical keys")
+	}
+}
+
+func TestPhoneProtector_Hash(t *testing.T) {
+	phones := newTestPhoneProtector(t, 1, 2)
+
+	hash := phones.Hash("+1234567890")
+	if hash == "+1234567890" || len(hash) != 64 {
+		t.Fatalf("expected a 64-character hex hash, got %q", hash)
+	}
+	if got := phones.Hash("+1 234-567-890"); got != hash {
+		t.Errorf("expected formatted and normalized numbers to hash alike, got %q and %q", got, hash)
+	}
+	if got := phones.Hash("001234567890"); got != hash {
+		t.Errorf("expected the 00 prefix and E.164 to hash alike, got %q and %q", got, hash)
+	}
+	if got := phones.Hash("+1234567891"); got == hash {
+		t.Error("expected different numbers to hash differently")
+	}
+	if got := newTestPhoneProtector(t, 3, 2).Hash("+1234567890"); got == hash {
+		t.Error("expected a different key to give a different hash")
+	}
+}
+
+func TestPhoneProtector_EncryptDecrypt(t *testing.T) {
+	phones := newTestPhoneProtector(t, 1, 2)
+
+	first, err := phones.Encrypt("+1234567890")
+	if err != nil {
+		t.Fatalf("Encrypt returned error: %v", err)
+	}
+	second, err := phones.Encrypt("+1234567890")
+	if err != nil {
+		t.Fatalf("Encrypt returned error: %v", err)
+	}
+	if first == second {
+		t.Error("expected each encryption to use a fresh nonce")
+	}
+
+	phoneNumber, err := phones.Decrypt(first)
+	if err != nil {
+		t.Fatalf("Decrypt returned error: %v", err)
+	}
+	if phoneNumber != "+1234567890" {
+		t.Errorf("expected +1234567890, got %q", phoneNumber)
+	}
+
+	if _, err := newTestPhoneProtector(t, 1, 3).Decrypt(first); err == nil {
+		t.Error("expected decrypting with another key to fail")
+	}
+	if _, err := phones.Decrypt("not base64!"); err == nil {
+		t.Error("expected an error for malformed input")
+	}
+}
+
+func TestPhoneProtector_Nil(t *testing.T) {
+	var phones *PhoneProtector
+
+	if got := phones.lookup("+1234567890"); got != "+1234567890" {
+		t.Errorf("expected the number to be stored as is, got %q", got)
+	}
+	recoveryPhone := "+1987654321"
+	if got := phones.lookupOptional(&recoveryPhone); got == nil || *got != recoveryPhone {
+		t.Errorf("expected the recovery phone to be stored as is, got %v", got)
+	}
+	if encrypted, err := phones.encrypted(&recoveryPhone); err != nil || encrypted != nil {
+		t.Errorf("expected no encrypted copy, got %v, %v", encrypted, err)
+	}
+
+	stored := "+1234567890"
+	if err := phones.reveal(&stored, sql.NullString{String: "ignored", Valid: true}); err != nil || stored != "+1234567890" {
+		t.Errorf("expected the stored number to be left alone, got %q, %v", stored, err)
+	}
+}
+
+func TestPhoneProtector_Reveal(t *testing.T) {
+	phones := newTestPhoneProtector(t, 1, 2)
+
+	encrypted, err := phones.encrypted(stringPtr("+1234567890"))
+	if err != nil {
+		t.Fatalf("encrypted returned error: %v", err)
+	}
+	stored := phones.lookup("+1234567890")
+	if err := phones.reveal(&stored, sql.NullString{String: *encrypted, Valid: true}); err != nil {
+		t.Fatalf("reveal returned error: %v", err)
+	}
+	if stored != "+1234567890" {
+		t.Errorf("expected the decrypted number, got %q", stored)
+	}
+
+	legacy := "+1234567890"
+	if err := phones.reveal(&legacy, sql.NullString{}); err != nil || legacy != "+1234567890" {
+		t.Errorf("expected a row without an encrypted copy to be left alone, got %q, %v", legacy, err)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
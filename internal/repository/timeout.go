@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrQueryTimeout is returned when a single query runs longer than the
+// repository's query timeout, as opposed to the caller's own deadline.
+var ErrQueryTimeout = errors.New("database query timed out")
+
+// withQueryTimeout bounds one repository call so that a slow query is
+// cancelled before it can use up the whole request deadline. A zero timeout
+// leaves ctx unchanged.
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, timeout, ErrQueryTimeout)
+}
+
+// queryError wraps err with ErrQueryTimeout when ctx was cancelled by the
+// query timeout rather than by the caller.
+func queryError(ctx context.Context, err error) error {
+	if err != nil && errors.Is(context.Cause(ctx), ErrQueryTimeout) {
+		return fmt.Errorf("%w: %v", ErrQueryTimeout, err)
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueryError(t *testing.T) {
+	// The query timeout fires first: the error is attributed to the query
+	ctx, cancel := withQueryTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if err := queryError(ctx, ctx.Err()); !errors.Is(err, ErrQueryTimeout) {
+		t.Errorf("Expected ErrQueryTimeout, got %v", err)
+	}
+
+	// The caller's own deadline fires first: the error is passed through
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancelParent()
+	ctx, cancel = withQueryTimeout(parent, time.Hour)
+	defer cancel()
+	<-ctx.Done()
+	if err := queryError(ctx, ctx.Err()); errors.Is(err, ErrQueryTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the caller's deadline error, got %v", err)
+	}
+
+	// A zero timeout leaves the context alone
+	ctx, cancel = withQueryTimeout(context.Background(), 0)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("Expected no deadline with a zero timeout")
+	}
+	if err := queryError(ctx, nil); err != nil {
+		t.Errorf("Expected nil error, got %v", err)
+	}
+}
@@ -4,151 +4,237 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"otp/internal/models"
+	"otp/internal/validation"
 )
 
 type UserRepository interface {
 	Create(ctx context.Context, user *models.User) error
 	GetByID(ctx context.Context, id string) (*models.User, error)
 	GetByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error)
+	GetByRecoveryPhone(ctx context.Context, phoneNumber string) (*models.User, error)
+	GetStatus(ctx context.Context, id string) (models.UserStatus, error)
+	SetStatus(ctx context.Context, id string, status models.UserStatus) (*models.User, error)
+	UpdateMetadata(ctx context.Context, id string, previous, metadata models.Metadata) (bool, error)
 	Update(ctx context.Context, user *models.User) error
 	List(ctx context.Context, query models.PaginationQuery) (*models.UserListResponse, error)
+	Count(ctx context.Context, filter models.UserFilter) (int, error)
 	Delete(ctx context.Context, id string) error
 }
 
 type userRepository struct {
-	db *sql.DB
+	db           *sql.DB
+	readDB       *sql.DB
+	queryTimeout time.Duration
+	phones       *PhoneProtector
 }
 
-func NewUserRepository(db *sql.DB) UserRepository {
-	return &userRepository{db: db}
+// userColumns are the columns scanUser reads
+const userColumns = "id, phone_number, created_at, updated_at, last_login_at, metadata, recovery_phone, status, phone_number_encrypted, recovery_phone_encrypted"
+
+// NewUserRepository returns a UserRepository that writes to db and runs the
+// read-heavy List and Count queries against readDB, which may be a replica.
+// Lookups by ID and phone number stay on db so the auth flow can read its
+// own writes despite replication lag. Pass db as readDB without a replica.
+// Each query is cancelled after queryTimeout; 0 disables the limit. With
+// phones set, phone numbers are stored hashed and encrypted instead of as
+// they are.
+func NewUserRepository(db, readDB *sql.DB, queryTimeout time.Duration, phones *PhoneProtector) UserRepository {
+	return &userRepository{db: db, readDB: readDB, queryTimeout: queryTimeout, phones: phones}
 }
 
 func (r *userRepository) Create(ctx context.Context, user *models.User) error {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	phoneNumber, recoveryPhone, err := r.encryptPhones(user)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO users (id, phone_number, created_at, updated_at, last_login_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO users (id, phone_number, created_at, updated_at, last_login_at, metadata, recovery_phone, status, phone_number_encrypted, recovery_phone_encrypted)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
-	_, err := r.db.ExecContext(ctx, query, user.ID, user.PhoneNumber, user.CreatedAt, user.UpdatedAt, user.LastLoginAt)
-	return err
+	_, err = r.db.ExecContext(ctx, query, user.ID, r.phones.lookup(user.PhoneNumber), user.CreatedAt, user.UpdatedAt, user.LastLoginAt, user.Metadata,
+		r.phones.lookupOptional(user.RecoveryPhone), user.Status, phoneNumber, recoveryPhone)
+	return queryError(ctx, err)
 }
 
 func (r *userRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
-	query := `
-		SELECT id, phone_number, created_at, updated_at, last_login_at
-		FROM users
-		WHERE id = $1
-	`
-	user := &models.User{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID,
-		&user.PhoneNumber,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-		&user.LastLoginAt,
-	)
+	return r.getBy(ctx, "id", id)
+}
+
+func (r *userRepository) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error) {
+	return r.getBy(ctx, "phone_number", r.phones.lookup(phoneNumber))
+}
+
+func (r *userRepository) GetByRecoveryPhone(ctx context.Context, phoneNumber string) (*models.User, error) {
+	return r.getBy(ctx, "recovery_phone", r.phones.lookup(phoneNumber))
+}
+
+// getBy returns the user whose column equals value, or nil if there is none
+func (r *userRepository) getBy(ctx context.Context, column, value string) (*models.User, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := fmt.Sprintf("SELECT %s FROM users WHERE %s = $1", userColumns, column)
+	user, err := r.scanUser(r.db.QueryRowContext(ctx, query, value))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		return nil, err
+		return nil, queryError(ctx, err)
 	}
 	return user, nil
 }
 
-func (r *userRepository) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error) {
-	query := `
-		SELECT id, phone_number, created_at, updated_at, last_login_at
-		FROM users
-		WHERE phone_number = $1
-	`
+// scanUser reads a row of userColumns, decrypting protected phone numbers
+func (r *userRepository) scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
 	user := &models.User{}
-	err := r.db.QueryRowContext(ctx, query, phoneNumber).Scan(
+	var phoneNumber, recoveryPhone sql.NullString
+	err := row.Scan(
 		&user.ID,
 		&user.PhoneNumber,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.LastLoginAt,
+		&user.Metadata,
+		&user.RecoveryPhone,
+		&user.Status,
+		&phoneNumber,
+		&recoveryPhone,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
 		return nil, err
 	}
+
+	if err := r.phones.reveal(&user.PhoneNumber, phoneNumber); err != nil {
+		return nil, err
+	}
+	if user.RecoveryPhone != nil {
+		if err := r.phones.reveal(user.RecoveryPhone, recoveryPhone); err != nil {
+			return nil, err
+		}
+	}
 	return user, nil
 }
 
-func (r *userRepository) Update(ctx context.Context, user *models.User) error {
-	query := `
-		UPDATE users
-		SET phone_number = $2, updated_at = $3, last_login_at = $4
-		WHERE id = $1
-	`
-	_, err := r.db.ExecContext(ctx, query, user.ID, user.PhoneNumber, user.UpdatedAt, user.LastLoginAt)
-	return err
+// encryptPhones returns the encrypted display columns for the user's phone
+// numbers, both nil when numbers are stored as they are
+func (r *userRepository) encryptPhones(user *models.User) (*string, *string, error) {
+	phoneNumber, err := r.phones.encrypted(&user.PhoneNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	recoveryPhone, err := r.phones.encrypted(user.RecoveryPhone)
+	if err != nil {
+		return nil, nil, err
+	}
+	return phoneNumber, recoveryPhone, nil
 }
 
-func (r *userRepository) List(ctx context.Context, query models.PaginationQuery) (*models.UserListResponse, error) {
-	// Build the base query
-	baseQuery := "FROM users"
-	whereClause := ""
-	args := []interface{}{}
+// GetStatus returns the user's status, or "" if the user does not exist. It
+// reads from db rather than readDB so that a suspension applies to the very
+// next request instead of after the replication lag.
+func (r *userRepository) GetStatus(ctx context.Context, id string) (models.UserStatus, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
 
-	// Add search condition if provided
-	if query.Search != "" {
-		whereClause = "WHERE phone_number ILIKE $1"
-		args = append(args, "%"+query.Search+"%")
+	var status models.UserStatus
+	err := r.db.QueryRowContext(ctx, `SELECT status FROM users WHERE id = $1`, id).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", queryError(ctx, err)
 	}
+	return status, nil
+}
 
-	// Count total records
-	countQuery := fmt.Sprintf("SELECT COUNT(*) %s %s", baseQuery, whereClause)
-	var total int
-	err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&total)
+// SetStatus changes only the user's status, so that it can't undo a
+// concurrent change to other fields, and returns the updated user or nil if
+// there is none
+func (r *userRepository) SetStatus(ctx context.Context, id string, status models.UserStatus) (*models.User, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := fmt.Sprintf("UPDATE users SET status = $2, updated_at = $3 WHERE id = $1 RETURNING %s", userColumns)
+	user, err := r.scanUser(r.db.QueryRowContext(ctx, query, id, status, time.Now()))
 	if err != nil {
-		return nil, err
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, queryError(ctx, err)
 	}
+	return user, nil
+}
 
-	// Calculate pagination
-	offset := query.GetOffset()
-	limit := query.GetLimit()
-	totalPages := (total + limit - 1) / limit
+// UpdateMetadata replaces the user's metadata with metadata, but only while
+// it still equals previous, so that a concurrent change is never
+// overwritten. It reports false if the metadata changed in the meantime or
+// the user no longer exists.
+func (r *userRepository) UpdateMetadata(ctx context.Context, id string, previous, metadata models.Metadata) (bool, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
 
-	// Build the main query
-	mainQuery := fmt.Sprintf(`
-		SELECT id, phone_number, created_at, updated_at, last_login_at
-		%s %s
-		ORDER BY created_at DESC
-		LIMIT $%d OFFSET $%d
-	`, baseQuery, whereClause, len(args)+1, len(args)+2)
+	query := `
+		UPDATE users
+		SET metadata = $3, updated_at = $4
+		WHERE id = $1 AND COALESCE(metadata, '{}') = COALESCE($2::jsonb, '{}')
+	`
+	result, err := r.db.ExecContext(ctx, query, id, previous, metadata, time.Now())
+	if err != nil {
+		return false, queryError(ctx, err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return updated > 0, nil
+}
 
-	args = append(args, limit, offset)
+func (r *userRepository) Update(ctx context.Context, user *models.User) error {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
 
-	rows, err := r.db.QueryContext(ctx, mainQuery, args...)
+	phoneNumber, recoveryPhone, err := r.encryptPhones(user)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
 
-	var users []models.UserResponse
-	for rows.Next() {
-		var user models.User
-		err := rows.Scan(
-			&user.ID,
-			&user.PhoneNumber,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-			&user.LastLoginAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		users = append(users, user.ToResponse())
-	}
+	query := `
+		UPDATE users
+		SET phone_number = $2, updated_at = $3, last_login_at = $4, metadata = $5, recovery_phone = $6, status = $7,
+			phone_number_encrypted = $8, recovery_phone_encrypted = $9
+		WHERE id = $1
+	`
+	_, err = r.db.ExecContext(ctx, query, user.ID, r.phones.lookup(user.PhoneNumber), user.UpdatedAt, user.LastLoginAt, user.Metadata,
+		r.phones.lookupOptional(user.RecoveryPhone), user.Status, phoneNumber, recoveryPhone)
+	return queryError(ctx, err)
+}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+func (r *userRepository) List(ctx context.Context, query models.PaginationQuery) (*models.UserListResponse, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	whereClause, args := buildUserFilter(query.GetFilter(), r.phones)
+
+	var users []models.UserResponse
+	total, err := paginate(ctx, r.readDB, userColumns, "FROM users", whereClause, "created_at DESC", args, query.Pagination,
+		func(rows *sql.Rows) error {
+			user, err := r.scanUser(rows)
+			if err != nil {
+				return err
+			}
+			users = append(users, user.ToResponse())
+			return nil
+		})
+	if err != nil {
+		return nil, queryError(ctx, err)
 	}
 
 	return &models.UserListResponse{
@@ -156,12 +242,73 @@ func (r *userRepository) List(ctx context.Context, query models.PaginationQuery)
 		Total:      total,
 		Page:       query.Page,
 		PageSize:   query.PageSize,
-		TotalPages: totalPages,
+		TotalPages: query.TotalPages(total),
 	}, nil
 }
 
+func (r *userRepository) Count(ctx context.Context, filter models.UserFilter) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	whereClause, args := buildUserFilter(filter, r.phones)
+
+	var total int
+	err := r.readDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM users "+whereClause, args...).Scan(&total)
+	return total, queryError(ctx, err)
+}
+
 func (r *userRepository) Delete(ctx context.Context, id string) error {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
 	query := "DELETE FROM users WHERE id = $1"
 	_, err := r.db.ExecContext(ctx, query, id)
-	return err
+	return queryError(ctx, err)
+}
+
+// buildUserFilter returns the WHERE clause and positional arguments for
+// filter. Hashed phone numbers can only be searched for in full, as can any
+// number when filter.ExactSearch is set.
+func buildUserFilter(filter models.UserFilter, phones *PhoneProtector) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	// Add search condition if provided
+	if filter.Search != "" && (phones != nil || filter.ExactSearch) {
+		phoneNumber, err := validation.CanonicalPhoneNumber(filter.Search, "")
+		if err != nil {
+			phoneNumber = validation.NormalizePhoneNumber(filter.Search)
+		}
+		addCondition("phone_number = $%d", phones.lookup(phoneNumber))
+	} else if filter.Search != "" {
+		addCondition("phone_number ILIKE $%d", "%"+filter.Search+"%")
+	}
+
+	// Add creation date range if provided
+	if filter.CreatedAfter != nil {
+		addCondition("created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		addCondition("created_at < $%d", *filter.CreatedBefore)
+	}
+
+	// Add metadata key (and optionally value) match if provided
+	if filter.MetadataKey != "" {
+		if filter.MetadataValue != "" {
+			args = append(args, filter.MetadataKey, filter.MetadataValue)
+			conditions = append(conditions, fmt.Sprintf("metadata->>$%d = $%d", len(args)-1, len(args)))
+		} else {
+			addCondition("metadata ? $%d", filter.MetadataKey)
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
 }
@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"otp/internal/models"
+)
+
+// userRow returns a row of userColumns as the database would store user
+func userRow(t *testing.T, phones *PhoneProtector, user *models.User) []driver.Value {
+	t.Helper()
+	phoneNumber, recoveryPhone, err := (&userRepository{phones: phones}).encryptPhones(user)
+	if err != nil {
+		t.Fatalf("encryptPhones returned error: %v", err)
+	}
+	optional := func(value *string) driver.Value {
+		if value == nil {
+			return nil
+		}
+		return *value
+	}
+	return []driver.Value{
+		user.ID, phones.lookup(user.PhoneNumber), user.CreatedAt, user.UpdatedAt, nil, nil,
+		optional(phones.lookupOptional(user.RecoveryPhone)), string(user.Status), optional(phoneNumber), optional(recoveryPhone),
+	}
+}
+
+func TestUserRepository_LookupByHash(t *testing.T) {
+	phones := newTestPhoneProtector(t, 1, 2)
+	user := models.NewUserWithID("user-1", "+1234567890")
+	recoveryPhone := "+1987654321"
+	user.RecoveryPhone = &recoveryPhone
+	row := userRow(t, phones, user)
+
+	db, fake := newFakeDB(t, func(query string, args []driver.Value) (*fakeRows, error) {
+		if strings.HasPrefix(query, "SELECT") && (args[0] == row[1] || args[0] == row[6]) {
+			return &fakeRows{columns: strings.Split(userColumns, ", "), values: [][]driver.Value{row}}, nil
+		}
+		return &fakeRows{columns: strings.Split(userColumns, ", ")}, nil
+	})
+	repo := NewUserRepository(db, db, time.Second, phones)
+	ctx := context.Background()
+
+	// Stored numbers are hashes, never the number itself
+	if row[1] == user.PhoneNumber || row[6] == recoveryPhone {
+		t.Fatalf("Expected hashed columns, got %v and %v", row[1], row[6])
+	}
+
+	found, err := repo.GetByPhoneNumber(ctx, "+1 234-567-890")
+	if err != nil {
+		t.Fatalf("GetByPhoneNumber returned error: %v", err)
+	}
+	if found == nil || found.ID != user.ID || found.PhoneNumber != user.PhoneNumber {
+		t.Fatalf("Expected the user with its decrypted number, got %+v", found)
+	}
+	if found.RecoveryPhone == nil || *found.RecoveryPhone != recoveryPhone {
+		t.Errorf("Expected the decrypted recovery phone, got %v", found.RecoveryPhone)
+	}
+
+	found, err = repo.GetByRecoveryPhone(ctx, "00 1987654321")
+	if err != nil {
+		t.Fatalf("GetByRecoveryPhone returned error: %v", err)
+	}
+	if found == nil || found.ID != user.ID {
+		t.Errorf("Expected the user by recovery phone, got %+v", found)
+	}
+
+	found, err = repo.GetByPhoneNumber(ctx, "+1234567891")
+	if err != nil || found != nil {
+		t.Errorf("Expected no user for another number, got %+v, %v", found, err)
+	}
+
+	for _, statement := range fake.find("SELECT") {
+		if arg, _ := statement.args[0].(string); strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "00") {
+			t.Errorf("Expected lookups by hash, got %q in %s", arg, statement.query)
+		}
+	}
+}
+
+func TestUserRepository_CreateStoresHashes(t *testing.T) {
+	phones := newTestPhoneProtector(t, 1, 2)
+	db, fake := newFakeDB(t, nil)
+	repo := NewUserRepository(db, db, time.Second, phones)
+
+	user := models.NewUserWithID("user-1", "+1234567890")
+	if err := repo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	inserts := fake.find("INSERT INTO users")
+	if len(inserts) != 1 {
+		t.Fatalf("Expected one insert, got %d", len(inserts))
+	}
+	args := inserts[0].args
+	if args[1] != phones.Hash(user.PhoneNumber) {
+		t.Errorf("Expected the phone number hash, got %v", args[1])
+	}
+	encrypted, _ := args[8].(string)
+	if phoneNumber, err := phones.Decrypt(encrypted); err != nil || phoneNumber != user.PhoneNumber {
+		t.Errorf("Expected an encrypted copy of the number, got %q (%v)", phoneNumber, err)
+	}
+}
+
+func TestUserRepository_Plaintext(t *testing.T) {
+	user := models.NewUserWithID("user-1", "+1234567890")
+	db, fake := newFakeDB(t, func(query string, args []driver.Value) (*fakeRows, error) {
+		return &fakeRows{columns: strings.Split(userColumns, ", "), values: [][]driver.Value{userRow(t, nil, user)}}, nil
+	})
+	repo := NewUserRepository(db, db, time.Second, nil)
+
+	found, err := repo.GetByPhoneNumber(context.Background(), "+1234567890")
+	if err != nil || found == nil || found.PhoneNumber != user.PhoneNumber {
+		t.Fatalf("Expected the user, got %+v, %v", found, err)
+	}
+	if selects := fake.find("SELECT"); len(selects) != 1 || selects[0].args[0] != "+1234567890" {
+		t.Errorf("Expected a lookup by the number itself, got %+v", selects)
+	}
+}
+
+func TestProtectPlaintextUsers(t *testing.T) {
+	phones := newTestPhoneProtector(t, 1, 2)
+	db, fake := newFakeDB(t, func(query string, args []driver.Value) (*fakeRows, error) {
+		if strings.HasPrefix(query, "SELECT") {
+			return &fakeRows{
+				columns: []string{"id", "phone_number", "recovery_phone"},
+				values: [][]driver.Value{
+					{"user-1", "+1234567890", "+1987654321"},
+					{"user-2", "+1555000111", nil},
+				},
+			}, nil
+		}
+		return nil, nil
+	})
+
+	converted, err := ProtectPlaintextUsers(context.Background(), db, phones)
+	if err != nil {
+		t.Fatalf("ProtectPlaintextUsers returned error: %v", err)
+	}
+	if converted != 2 {
+		t.Errorf("Expected 2 users converted, got %d", converted)
+	}
+
+	updates := fake.find("UPDATE users")
+	if len(updates) != 2 {
+		t.Fatalf("Expected 2 updates, got %d", len(updates))
+	}
+	first := updates[0].args
+	if first[0] != "user-1" || first[1] != phones.Hash("+1234567890") || first[2] != phones.Hash("+1987654321") {
+		t.Errorf("Expected user-1's numbers hashed, got %v", first)
+	}
+	if encrypted, _ := first[4].(string); encrypted == "" {
+		t.Error("Expected an encrypted copy of the recovery phone")
+	}
+	if second := updates[1].args; second[2] != nil || second[4] != nil {
+		t.Errorf("Expected user-2 to keep no recovery phone, got %v", second)
+	}
+}
+
+func TestProtectPlaintextOTPs(t *testing.T) {
+	phones := newTestPhoneProtector(t, 1, 2)
+	db, fake := newFakeDB(t, func(query string, args []driver.Value) (*fakeRows, error) {
+		if strings.HasPrefix(query, "SELECT") {
+			return &fakeRows{columns: []string{"phone_number"}, values: [][]driver.Value{{"+1234567890"}}}, nil
+		}
+		return nil, nil
+	})
+
+	converted, err := ProtectPlaintextOTPs(context.Background(), db, phones)
+	if err != nil || converted != 1 {
+		t.Fatalf("Expected 1 number converted, got %d, %v", converted, err)
+	}
+	updates := fake.find("UPDATE otps")
+	if len(updates) != 1 || updates[0].args[0] != "+1234567890" || updates[0].args[1] != phones.Hash("+1234567890") {
+		t.Errorf("Expected the number replaced by its hash, got %+v", updates)
+	}
+}
+
+func TestUserRepository_UpdateMetadataOnlyIfUnchanged(t *testing.T) {
+	changed := false
+	db, fake := newFakeDB(t, func(query string, args []driver.Value) (*fakeRows, error) {
+		if changed {
+			return &fakeRows{}, nil
+		}
+		return nil, nil
+	})
+	repo := NewUserRepository(db, db, time.Second, nil)
+	ctx := context.Background()
+
+	updated, err := repo.UpdateMetadata(ctx, "user-1", models.Metadata{"plan": "free"}, models.Metadata{"plan": "pro"})
+	if err != nil || !updated {
+		t.Fatalf("Expected the update to apply, got %v, %v", updated, err)
+	}
+	statements := fake.find("UPDATE users")
+	if len(statements) != 1 || !strings.Contains(statements[0].query, "SET metadata = $3") {
+		t.Fatalf("Expected a single metadata-only update, got %+v", statements)
+	}
+	if args := statements[0].args; string(args[1].([]byte)) != `{"plan":"free"}` || string(args[2].([]byte)) != `{"plan":"pro"}` {
+		t.Errorf("Expected the previous and new metadata as arguments, got %v", args)
+	}
+
+	changed = true
+	if updated, err := repo.UpdateMetadata(ctx, "user-1", models.Metadata{"plan": "free"}, models.Metadata{"plan": "pro"}); err != nil || updated {
+		t.Errorf("Expected no update once the metadata changed, got %v, %v", updated, err)
+	}
+}
+
+func TestBuildUserFilter_Search(t *testing.T) {
+	phones := newTestPhoneProtector(t, 1, 2)
+
+	tests := []struct {
+		name   string
+		filter models.UserFilter
+		phones *PhoneProtector
+		where  string
+		arg    interface{}
+	}{
+		{"substring", models.UserFilter{Search: "555"}, nil, "WHERE phone_number ILIKE $1", "%555%"},
+		{"exact", models.UserFilter{Search: "+1 234 567 890", ExactSearch: true}, nil, "WHERE phone_number = $1", "+1234567890"},
+		{"exact partial number", models.UserFilter{Search: "555", ExactSearch: true}, nil, "WHERE phone_number = $1", "555"},
+		{"hashed", models.UserFilter{Search: "001234567890"}, phones, "WHERE phone_number = $1", phones.Hash("+1234567890")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := buildUserFilter(tt.filter, tt.phones)
+			if where != tt.where || len(args) != 1 || args[0] != tt.arg {
+				t.Errorf("Expected %q with %v, got %q with %v", tt.where, tt.arg, where, args)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// Package response holds the error envelope and headers shared by every API
+// response, so that handlers and middleware fail in the same shape.
+package response
+
+import (
+	"otp/internal/i18n"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorResponse is the body of every failed API call. Code is stable for
+// clients to branch on; Message is Code rendered in the caller's
+// Accept-Language and is filled in by Localize.
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	// RetryAfterSeconds repeats the Retry-After header when rate limited
+	RetryAfterSeconds int `json:"retry_after_seconds,omitempty"`
+	// Fields lists each invalid field when Code is VALIDATION_ERROR
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes why a single request field failed validation
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// SetHeaders sets the headers every API response should carry: the JSON
+// content type, nosniff and the request ID.
+func SetHeaders(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("X-Content-Type-Options", "nosniff")
+	if requestID := c.GetString("request_id"); requestID != "" {
+		c.Header("X-Request-ID", requestID)
+	}
+}
+
+// Localize fills in body's Message from its Code in the caller's
+// Accept-Language, unless it has one already.
+func Localize(c *gin.Context, body ErrorResponse) ErrorResponse {
+	if body.Code != "" && body.Message == "" {
+		body.Message = i18n.Message(c.GetHeader("Accept-Language"), body.Code)
+		c.Writer.Header().Add("Vary", "Accept-Language")
+	}
+	return body
+}
+
+// AbortWithError writes body with status and stops the handler chain.
+// Middleware should use it instead of calling c.JSON directly.
+func AbortWithError(c *gin.Context, status int, body ErrorResponse) {
+	SetHeaders(c)
+	c.AbortWithStatusJSON(status, Localize(c, body))
+}
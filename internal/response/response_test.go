@@ -0,0 +1,67 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"otp/internal/i18n"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAbortWithError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handled := false
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("request_id", "req-123")
+		AbortWithError(c, http.StatusForbidden, ErrorResponse{Error: "Account is suspended", Code: "ACCOUNT_SUSPENDED"})
+	})
+	router.GET("/", func(c *gin.Context) { handled = true })
+
+	w := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Accept-Language", "es")
+	router.ServeHTTP(w, request)
+
+	if handled {
+		t.Error("Expected the handler chain to stop")
+	}
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403, got %d", w.Code)
+	}
+	if got := w.Header().Get("X-Request-ID"); got != "req-123" {
+		t.Errorf("Expected the request ID to be echoed, got %q", got)
+	}
+	if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("Expected nosniff, got %q", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept-Language" {
+		t.Errorf("Expected Vary: Accept-Language, got %q", got)
+	}
+
+	var body ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if body.Code != "ACCOUNT_SUSPENDED" || body.Message != i18n.Message("es", "ACCOUNT_SUSPENDED") {
+		t.Errorf("Expected a localized ACCOUNT_SUSPENDED error, got %+v", body)
+	}
+}
+
+func TestLocalize_KeepsExistingMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+	body := Localize(c, ErrorResponse{Error: "Not found", Code: "NOT_FOUND", Message: "custom"})
+	if body.Message != "custom" {
+		t.Errorf("Expected the existing message to be kept, got %q", body.Message)
+	}
+	if body := Localize(c, ErrorResponse{Error: "Oops"}); body.Message != "" {
+		t.Errorf("Expected no message without a code, got %q", body.Message)
+	}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"otp/internal/models"
+)
+
+var ErrRecoveryPhoneIsPrimary = errors.New("recovery phone must differ from the primary phone number")
+
+// RequestRecoveryPhone sends an OTP to the recovery phone number so the user
+// can prove they control it before it is registered.
+func (s *authService) RequestRecoveryPhone(ctx context.Context, userID string, request models.RecoveryPhoneRequest) (*models.OTPResponse, error) {
+	recoveryPhone, err := s.canonicalPhoneNumber(request.RecoveryPhone)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.checkRecoveryPhone(ctx, userID, recoveryPhone); err != nil {
+		return nil, err
+	}
+
+	return s.sendOTP(ctx, recoveryPhone, false)
+}
+
+// ConfirmRecoveryPhone verifies the OTP sent to the recovery phone number and
+// registers it on the user's account.
+func (s *authService) ConfirmRecoveryPhone(ctx context.Context, userID string, confirmation models.RecoveryPhoneConfirmation) (*models.UserResponse, error) {
+	recoveryPhone, err := s.canonicalPhoneNumber(confirmation.RecoveryPhone)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.checkRecoveryPhone(ctx, userID, recoveryPhone)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.consumeOTP(ctx, recoveryPhone, confirmation.Code, false); err != nil {
+		s.recordVerifyFailure(err)
+		return nil, err
+	}
+
+	user.SetRecoveryPhone(recoveryPhone)
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	response := user.ToResponse()
+	return &response, nil
+}
+
+// RemoveRecoveryPhone clears the user's recovery phone number.
+func (s *authService) RemoveRecoveryPhone(ctx context.Context, userID string) (*models.UserResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	user.SetRecoveryPhone("")
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	response := user.ToResponse()
+	return &response, nil
+}
+
+// RequestAccountRecovery sends an OTP to a recovery phone number. Like
+// GenerateOTP, it does not reveal whether any account uses the number.
+func (s *authService) RequestAccountRecovery(ctx context.Context, request models.RecoveryPhoneRequest) (*models.OTPResponse, error) {
+	return s.sendOTP(ctx, request.RecoveryPhone, false)
+}
+
+// RecoverAccount verifies the OTP sent to a recovery phone number and signs
+// in the account registered with it. Recovering onto the recovery number
+// itself promotes it to primary and clears the recovery phone. Any other new
+// number has not been proven yet, so a code is sent to it and the move is
+// left to ConfirmPhoneChange with the returned token.
+func (s *authService) RecoverAccount(ctx context.Context, confirmation models.AccountRecoveryConfirmation) (*models.AccountRecoveryResponse, error) {
+	recoveryPhone, err := s.canonicalPhoneNumber(confirmation.RecoveryPhone)
+	if err != nil {
+		return nil, err
+	}
+	newPhoneNumber, err := s.canonicalNewPhoneNumber(confirmation.NewPhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify before any lookup so that the response reveals neither which
+	// numbers are registered as recovery phones nor which are taken
+	otp, err := s.consumeOTP(ctx, recoveryPhone, confirmation.Code, false)
+	if err != nil {
+		s.recordVerifyFailure(err)
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByRecoveryPhone(ctx, recoveryPhone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.IsActive() {
+		return nil, ErrAccountSuspended
+	}
+
+	response := &models.AccountRecoveryResponse{}
+	switch newPhoneNumber {
+	case user.PhoneNumber:
+		// Nothing to move; the user only needed to sign in
+	case recoveryPhone:
+		if _, err := s.checkPhoneChange(ctx, user.ID, newPhoneNumber); err != nil {
+			return nil, err
+		}
+		user.ChangePhoneNumber(newPhoneNumber)
+		user.SetRecoveryPhone("")
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+	default:
+		phoneChange, err := s.RequestPhoneChange(ctx, user.ID, models.PhoneChangeRequest{NewPhoneNumber: newPhoneNumber})
+		if err != nil {
+			return nil, err
+		}
+		response.PhoneChange = phoneChange
+	}
+
+	token, expiresAt, err := s.generateJWT(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	userResponse := user.ToResponse()
+	response.AuthResponse = models.AuthResponse{
+		Token:     token,
+		User:      &userResponse,
+		ExpiresAt: expiresAt,
+		RequestID: otp.RequestID,
+	}
+	return response, nil
+}
+
+// checkRecoveryPhone returns the user if they may register recoveryPhone.
+func (s *authService) checkRecoveryPhone(ctx context.Context, userID, recoveryPhone string) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if user.PhoneNumber == recoveryPhone {
+		return nil, ErrRecoveryPhoneIsPrimary
+	}
+
+	existing, err := s.userRepo.GetByRecoveryPhone(ctx, recoveryPhone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up recovery phone: %w", err)
+	}
+	if existing != nil && existing.ID != user.ID {
+		return nil, ErrPhoneNumberTaken
+	}
+
+	return user, nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"otp/internal/metrics"
+)
+
+// AnomalyDetector watches the rate of failed verifications across all phone
+// numbers. A burst of failures spread over many numbers points to credential
+// stuffing that per-number limits won't catch.
+type AnomalyDetector interface {
+	RecordFailure()
+}
+
+type failureSpikeDetector struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	// failures holds the times of the most recent threshold failures, oldest
+	// first; only these are needed to tell whether threshold were reached
+	failures  []time.Time
+	lastAlert time.Time
+	alerts    *metrics.Counter
+	now       func() time.Time
+}
+
+// NewFailureSpikeDetector returns an AnomalyDetector that logs a security
+// alert, and increments alerts, when threshold failures occur within window.
+// It alerts at most once per window.
+func NewFailureSpikeDetector(threshold int, window time.Duration, alerts *metrics.Counter) AnomalyDetector {
+	return &failureSpikeDetector{
+		threshold: threshold,
+		window:    window,
+		failures:  make([]time.Time, 0, threshold),
+		alerts:    alerts,
+		now:       time.Now,
+	}
+}
+
+func (d *failureSpikeDetector) RecordFailure() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	if len(d.failures) == d.threshold {
+		d.failures = d.failures[1:]
+	}
+	d.failures = append(d.failures, now)
+
+	if len(d.failures) < d.threshold || now.Sub(d.failures[0]) > d.window {
+		return
+	}
+	if !d.lastAlert.IsZero() && now.Sub(d.lastAlert) < d.window {
+		return
+	}
+
+	d.lastAlert = now
+	d.alerts.Inc()
+	log.Printf("SECURITY: verify failure spike detected (%d failures in %s)", d.threshold, now.Sub(d.failures[0]).Round(time.Second))
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"otp/internal/metrics"
+)
+
+func TestFailureSpikeDetector(t *testing.T) {
+	alerts := metrics.NewCounter("test_anomalies_total", "test")
+	detector := NewFailureSpikeDetector(3, time.Minute, alerts).(*failureSpikeDetector)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	detector.now = func() time.Time { return now }
+
+	// Failures spread wider than the window never alert
+	for i := 0; i < 3; i++ {
+		detector.RecordFailure()
+		now = now.Add(45 * time.Second)
+	}
+	if alerts.Value() != 0 {
+		t.Fatalf("Expected no alert for failures spread over %s, got %d", 90*time.Second, alerts.Value())
+	}
+
+	// Three failures inside the window alert once
+	for i := 0; i < 3; i++ {
+		detector.RecordFailure()
+		now = now.Add(time.Second)
+	}
+	if alerts.Value() != 1 {
+		t.Fatalf("Expected 1 alert after a spike, got %d", alerts.Value())
+	}
+
+	// Continued failures within the same window do not alert again
+	for i := 0; i < 5; i++ {
+		detector.RecordFailure()
+	}
+	if alerts.Value() != 1 {
+		t.Errorf("Expected alerts to be suppressed within the window, got %d", alerts.Value())
+	}
+
+	// Once the window has passed, a fresh spike alerts again
+	now = now.Add(2 * time.Minute)
+	for i := 0; i < 3; i++ {
+		detector.RecordFailure()
+	}
+	if alerts.Value() != 2 {
+		t.Errorf("Expected a second alert after the window, got %d", alerts.Value())
+	}
+}
+
+func TestAuthServiceReportsVerifyFailures(t *testing.T) {
+	detector := &countingDetector{}
+	service := &authService{anomalies: detector}
+
+	service.recordVerifyFailure(ErrOTPWrongCode)
+	service.recordVerifyFailure(ErrOTPExpired)
+	service.recordVerifyFailure(ErrUserNotFound)
+
+	if detector.failures != 2 {
+		t.Errorf("Expected 2 recorded failures, got %d", detector.failures)
+	}
+}
+
+type countingDetector struct {
+	failures int
+}
+
+func (d *countingDetector) RecordFailure() {
+	d.failures++
+}
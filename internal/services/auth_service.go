@@ -2,98 +2,463 @@ package services
 
 import (
 	"context"
-	"crypto/rand"
 	"errors"
 	"fmt"
-	"math/big"
+	"io"
+	"log"
+	"os"
+	"strings"
 	"time"
 
 	"otp/internal/config"
+	"otp/internal/metrics"
 	"otp/internal/models"
+	"otp/internal/ratelimit"
 	"otp/internal/repository"
+	"otp/internal/validation"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// ErrRateLimitExceeded is returned when a phone number has requested
+// RATE_LIMIT_MAX_REQUESTS OTPs within the rate limit window.
+var ErrRateLimitExceeded = errors.New("rate limit exceeded. Please try again later")
+
+// ErrDailyLimitExceeded is returned when a phone number has used up its
+// daily OTP allowance.
+var ErrDailyLimitExceeded = errors.New("daily OTP limit exceeded. Please try again tomorrow")
+
+// ErrResendCooldown is returned when a phone number requests another OTP
+// before OTP_RESEND_COOLDOWN_SECONDS have passed since its latest one.
+var ErrResendCooldown = errors.New("OTP requested too recently. Please wait before requesting another")
+
+// ErrRegistrationDisabled is returned when an unknown phone number verifies
+// an OTP while new sign-ups are switched off.
+var ErrRegistrationDisabled = errors.New("registration of new users is disabled")
+
+// ErrAccountSuspended is returned when a suspended or banned user tries to
+// sign in or use a token.
+var ErrAccountSuspended = errors.New("account is suspended")
+
+// ErrDatabaseTimeout is returned when a single database query exceeds its
+// timeout, so callers can tell a slow query from a failed one.
+var ErrDatabaseTimeout = repository.ErrQueryTimeout
+
+// ErrInvalidPhoneNumber is returned for a phone number that is neither in
+// E.164 format nor a national number of the configured default region
+var ErrInvalidPhoneNumber = validation.ErrNotE164
+
+// ErrServerBusy is returned when the global limit on concurrent OTP
+// generations has been reached
+var ErrServerBusy = errors.New("too many OTP requests in progress, please try again shortly")
+
+// ErrRequestCancelled is returned when the caller's context is cancelled or
+// times out before the operation completes.
+var ErrRequestCancelled = errors.New("request cancelled")
+
+// Verification failures, distinguished so clients can tailor their messaging
+var (
+	ErrOTPNotFound    = errors.New("no OTP has been requested for this phone number")
+	ErrOTPExpired     = errors.New("OTP has expired")
+	ErrOTPWrongCode   = errors.New("invalid OTP code")
+	ErrOTPAlreadyUsed = errors.New("OTP has already been used")
+)
+
 type AuthService interface {
 	GenerateOTP(ctx context.Context, phoneNumber string) (*models.OTPResponse, error)
+	ResendCooldown(ctx context.Context, phoneNumber string) (time.Duration, error)
 	VerifyOTP(ctx context.Context, verification models.OTPVerification) (*models.AuthResponse, error)
+	CancelOTP(ctx context.Context, phoneNumber string) error
+	RequestPhoneChange(ctx context.Context, userID string, request models.PhoneChangeRequest) (*models.OTPResponse, error)
+	ConfirmPhoneChange(ctx context.Context, userID string, confirmation models.PhoneChangeConfirmation) (*models.AuthResponse, error)
+	RequestRecoveryPhone(ctx context.Context, userID string, request models.RecoveryPhoneRequest) (*models.OTPResponse, error)
+	ConfirmRecoveryPhone(ctx context.Context, userID string, confirmation models.RecoveryPhoneConfirmation) (*models.UserResponse, error)
+	RemoveRecoveryPhone(ctx context.Context, userID string) (*models.UserResponse, error)
+	RequestAccountRecovery(ctx context.Context, request models.RecoveryPhoneRequest) (*models.OTPResponse, error)
+	RecoverAccount(ctx context.Context, confirmation models.AccountRecoveryConfirmation) (*models.AccountRecoveryResponse, error)
+	RefreshClaims(ctx context.Context, claims *models.Claims) (*models.AuthResponse, error)
+	CheckAccountStatus(ctx context.Context, userID string) error
+	ResetRateLimits(ctx context.Context, userID string) (*models.RateLimitReset, error)
+	DeleteExpiredOTPs(ctx context.Context) (*models.OTPCleanup, error)
 	ValidateToken(tokenString string) (*models.Claims, error)
 }
 
 type authService struct {
-	userRepo repository.UserRepository
-	otpRepo  repository.OTPRepository
-	config   *config.Config
+	userRepo      repository.UserRepository
+	otpRepo       repository.OTPRepository
+	config        *config.Config
+	codeGenerator CodeGenerator
+	idGenerator   IDGenerator
+	replayCounter *metrics.Counter
+	exemptions    *ratelimit.Exemptions
+	anomalies     AnomalyDetector
+	backoff       VerifyBackoff
+	// burst lets the first OTP_FREE_RESENDS resends skip the resend
+	// cooldown; nil applies the cooldown to every resend
+	burst ResendBurst
+	// generations holds one token per OTP generation in flight; nil means
+	// unlimited
+	generations chan struct{}
+	// coalesced shares concurrent generations for a phone number; nil
+	// disables it
+	coalesced *generateGroup
+	// console receives codes printed by OTP_DEBUG_PRINT; nil means stdout
+	console io.Writer
+}
+
+// AuthServiceOption customizes the auth service created by NewAuthService
+type AuthServiceOption func(*authService)
+
+// WithCodeGenerator replaces the default numeric OTP code generator
+func WithCodeGenerator(generator CodeGenerator) AuthServiceOption {
+	return func(s *authService) {
+		s.codeGenerator = generator
+	}
+}
+
+// WithIDGenerator replaces the default random UUIDv4 user IDs
+func WithIDGenerator(generator IDGenerator) AuthServiceOption {
+	return func(s *authService) {
+		s.idGenerator = generator
+	}
+}
+
+// WithReplayCounter counts verify attempts that resubmit the correct code of
+// an OTP that was already used
+func WithReplayCounter(counter *metrics.Counter) AuthServiceOption {
+	return func(s *authService) {
+		s.replayCounter = counter
+	}
+}
+
+// WithRateLimitExemptions lets allowlisted phone numbers, and client IPs
+// attached with ContextWithClientIP, skip the OTP rate limits
+func WithRateLimitExemptions(exemptions *ratelimit.Exemptions) AuthServiceOption {
+	return func(s *authService) {
+		s.exemptions = exemptions
+	}
+}
+
+// WithAnomalyDetector reports every failed verification to detector
+func WithAnomalyDetector(detector AnomalyDetector) AuthServiceOption {
+	return func(s *authService) {
+		s.anomalies = detector
+	}
+}
+
+// WithVerifyBackoff delays responses to consecutive wrong codes for a phone
+// number as backoff dictates
+func WithVerifyBackoff(backoff VerifyBackoff) AuthServiceOption {
+	return func(s *authService) {
+		s.backoff = backoff
+	}
+}
+
+// WithResendBurst lets a phone number make OTP_FREE_RESENDS resends in the
+// burst tracked by burst before the resend cooldown applies
+func WithResendBurst(burst ResendBurst) AuthServiceOption {
+	return func(s *authService) {
+		s.burst = burst
+	}
 }
 
-func NewAuthService(userRepo repository.UserRepository, otpRepo repository.OTPRepository, config *config.Config) AuthService {
-	return &authService{
-		userRepo: userRepo,
-		otpRepo:  otpRepo,
-		config:   config,
+// WithMaxConcurrentGenerations fails OTP generations fast with ErrServerBusy
+// while limit of them are already in flight, across all phone numbers and
+// clients. It is a last-resort guard on the SMS budget; a limit of zero or
+// less disables it.
+func WithMaxConcurrentGenerations(limit int) AuthServiceOption {
+	return func(s *authService) {
+		if limit > 0 {
+			s.generations = make(chan struct{}, limit)
+		}
 	}
 }
 
+// WithGenerateCoalescing makes concurrent OTP generations for the same phone
+// number share the first one's result, so a burst of identical requests
+// saves one OTP and sends one code. Callers that join a generation get its
+// outcome, including a rate limit error; exempt callers only join exempt
+// ones. A caller that cancels stops waiting but leaves the generation running.
+func WithGenerateCoalescing() AuthServiceOption {
+	return func(s *authService) {
+		s.coalesced = newGenerateGroup()
+	}
+}
+
+// WithConsole sends the codes printed by OTP_DEBUG_PRINT to w instead of
+// stdout, so tests can check what was "delivered"
+func WithConsole(w io.Writer) AuthServiceOption {
+	return func(s *authService) {
+		s.console = w
+	}
+}
+
+func NewAuthService(userRepo repository.UserRepository, otpRepo repository.OTPRepository, config *config.Config, opts ...AuthServiceOption) AuthService {
+	s := &authService{
+		userRepo:      userRepo,
+		otpRepo:       otpRepo,
+		config:        config,
+		codeGenerator: NewNumericCodeGenerator(),
+		idGenerator:   uuidV4Generator{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// GenerateOTP sends a sign-in code to the phone number
 func (s *authService) GenerateOTP(ctx context.Context, phoneNumber string) (*models.OTPResponse, error) {
-	// Check rate limiting
-	since := time.Now().Add(-s.config.GetRateLimitWindow())
-	count, err := s.otpRepo.GetRecentOTPCount(ctx, phoneNumber, since)
+	return s.sendOTP(ctx, phoneNumber, true)
+}
+
+// sendOTP issues a code for the phone number. Only sign-in codes are limited
+// to existing users by OTP_REQUIRE_EXISTING_USER: phone change and recovery
+// codes go to numbers that are not a user's primary phone.
+func (s *authService) sendOTP(ctx context.Context, phoneNumber string, signIn bool) (*models.OTPResponse, error) {
+	phoneNumber, err := s.canonicalPhoneNumber(phoneNumber)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check rate limit: %w", err)
+		return nil, err
 	}
 
-	if count >= s.config.RateLimit.MaxRequests {
-		return nil, errors.New("rate limit exceeded. Please try again later")
+	if s.coalesced == nil {
+		return s.generateOTP(ctx, phoneNumber, signIn)
+	}
+	// Only callers the rate limit treats alike share a generation, and it
+	// runs without the first caller's cancellation so that caller giving up
+	// doesn't fail the others
+	key := phoneNumber
+	if !signIn {
+		key = "account:" + phoneNumber
+	}
+	if s.exemptions.Exempt(ClientIPFromContext(ctx), phoneNumber) {
+		key += ":exempt"
+	}
+	detached := context.WithoutCancel(ctx)
+	return s.coalesced.do(ctx, key, func() (*models.OTPResponse, error) {
+		return s.generateOTP(detached, phoneNumber, signIn)
+	})
+}
+
+// generateOTP issues a code for a canonical phone number
+func (s *authService) generateOTP(ctx context.Context, phoneNumber string, signIn bool) (*models.OTPResponse, error) {
+	if s.generations != nil {
+		select {
+		case s.generations <- struct{}{}:
+			defer func() { <-s.generations }()
+		default:
+			log.Printf("WARNING: OTP generation refused for %s, %d already in flight", models.MaskPhone(phoneNumber), cap(s.generations))
+			return nil, ErrServerBusy
+		}
+	}
+
+	// Check rate limiting, unless the phone number or client is allowlisted
+	clientIP := ClientIPFromContext(ctx)
+	exempt := s.exemptions.Exempt(clientIP, phoneNumber)
+	count := 0
+	if exempt {
+		if s.config.DebugLog.Enabled {
+			log.Printf("DEBUG: rate limit exemption applied for %s from %s", models.MaskPhone(phoneNumber), clientIP)
+		}
+	} else {
+		var err error
+		if count, err = s.checkRateLimits(ctx, phoneNumber); err != nil {
+			return nil, err
+		}
+	}
+
+	// Don't issue a code for a request the client has already abandoned
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	// Only provisioned users are sent sign-in codes when so configured. To
+	// hide which numbers have users, an unknown number's OTP is still saved,
+	// so rate limits and verification treat it like any other, but never sent.
+	send := true
+	if signIn && s.config.OTP.RequireExistingUser {
+		user, err := s.userRepo.GetByPhoneNumber(ctx, phoneNumber)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		if user == nil {
+			log.Printf("SECURITY: OTP not sent to %s, which has no user", models.MaskPhone(phoneNumber))
+			if !s.config.OTP.HideUnknownUsers {
+				return nil, ErrUserNotFound
+			}
+			send = false
+		}
 	}
 
 	// Generate OTP code
-	code, err := s.generateRandomCode(s.config.OTP.Length)
+	code, err := s.generateCode(ctx, phoneNumber)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate OTP: %w", err)
+		return nil, err
 	}
 
 	// Create OTP record
 	otp := models.NewOTP(phoneNumber, code, s.config.OTP.ExpiryMinutes)
+	otp.IP = clientIP
+	otp.UsesRemaining = 1
+	if signIn {
+		otp.UsesRemaining = s.config.GetMaxOTPUses()
+	}
 	err = s.otpRepo.Create(ctx, otp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to save OTP: %w", err)
 	}
+	if s.burst != nil {
+		s.burst.Sent(phoneNumber)
+	}
 
-	// Print OTP to console (for development)
-	fmt.Printf("OTP for %s: %s (expires in %d minutes)\n", phoneNumber, code, s.config.OTP.ExpiryMinutes)
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
 
-	return &models.OTPResponse{
+	// Print OTP to console for local testing only; codes must never reach
+	// production logs
+	if send && s.config.OTP.DebugPrint && !s.config.IsProduction() {
+		console := s.console
+		if console == nil {
+			console = os.Stdout
+		}
+		fmt.Fprintf(console, "OTP for %s: %s (expires in %d minutes, request %s)\n",
+			models.MaskPhone(phoneNumber), models.FormatCode(code, s.config.OTP.CodeGroupSize), s.config.OTP.ExpiryMinutes, otp.RequestID)
+	}
+
+	response := &models.OTPResponse{
 		Message:   "OTP sent successfully",
 		ExpiresIn: s.config.OTP.ExpiryMinutes,
-	}, nil
+		RequestID: otp.RequestID,
+	}
+
+	// Warn clients approaching the limit so they can back off before a 429
+	remaining := s.config.RateLimit.MaxRequests - (count + 1)
+	if !exempt && s.config.RateLimit.WarningThreshold > 0 && remaining <= s.config.RateLimit.WarningThreshold {
+		response.Warning = fmt.Sprintf("%d OTP request(s) remaining in the current %d minute window",
+			remaining, s.config.RateLimit.WindowMinutes)
+	}
+
+	return response, nil
 }
 
-func (s *authService) VerifyOTP(ctx context.Context, verification models.OTPVerification) (*models.AuthResponse, error) {
-	// Get the latest valid OTP for the phone number
-	otp, err := s.otpRepo.GetByPhoneNumber(ctx, verification.PhoneNumber)
+// maxCodeRegenerations bounds how many times generateCode retries a code
+// that repeats the phone number's pending one
+const maxCodeRegenerations = 3
+
+// generateCode returns a new code, regenerating it if it matches the phone
+// number's most recent valid code so a resend never arrives as a duplicate
+// SMS. A generator that keeps repeating itself gets its last code issued.
+func (s *authService) generateCode(ctx context.Context, phoneNumber string) (string, error) {
+	pending, err := s.otpRepo.GetByPhoneNumber(ctx, phoneNumber)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get OTP: %w", err)
+		return "", fmt.Errorf("failed to get pending OTP: %w", err)
 	}
 
-	if otp == nil {
-		return nil, errors.New("invalid or expired OTP")
+	var code string
+	for attempt := 0; attempt <= maxCodeRegenerations; attempt++ {
+		if code, err = s.codeGenerator.Generate(s.config.OTP.Length); err != nil {
+			return "", fmt.Errorf("failed to generate OTP: %w", err)
+		}
+		if pending == nil || code != pending.Code {
+			break
+		}
 	}
+	return code, nil
+}
 
-	// Verify OTP code
-	if otp.Code != verification.Code {
-		return nil, errors.New("invalid OTP code")
+// checkRateLimits enforces the per-window and daily OTP limits for the phone
+// number, returning how many OTPs it has been sent in the current window.
+func (s *authService) checkRateLimits(ctx context.Context, phoneNumber string) (int, error) {
+	if remaining, err := s.resendCooldown(ctx, phoneNumber); err != nil {
+		return 0, err
+	} else if remaining > 0 {
+		return 0, ErrResendCooldown
 	}
 
-	// Check if OTP is still valid
-	if !otp.IsValid() {
-		return nil, errors.New("OTP has expired")
+	since := time.Now().Add(-s.config.GetRateLimitWindow())
+	count, err := s.otpRepo.GetRecentOTPCount(ctx, phoneNumber, since)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+
+	if count >= s.config.RateLimit.MaxRequests {
+		return 0, ErrRateLimitExceeded
+	}
+
+	// Check the daily cap, which bounds cost for requests spaced across windows
+	if s.config.RateLimit.MaxPerDay > 0 {
+		dailyCount, err := s.otpRepo.GetRecentOTPCount(ctx, phoneNumber, time.Now().Add(-24*time.Hour))
+		if err != nil {
+			return 0, fmt.Errorf("failed to check daily limit: %w", err)
+		}
+
+		if dailyCount >= s.config.RateLimit.MaxPerDay {
+			return 0, ErrDailyLimitExceeded
+		}
 	}
 
-	// Mark OTP as used
-	err = s.otpRepo.MarkAsUsed(ctx, verification.PhoneNumber)
+	return count, nil
+}
+
+// ResendCooldown returns how long the phone number must wait before it may
+// request another OTP, or 0 when it may request one now
+func (s *authService) ResendCooldown(ctx context.Context, phoneNumber string) (time.Duration, error) {
+	phoneNumber, err := s.canonicalPhoneNumber(phoneNumber)
 	if err != nil {
-		return nil, fmt.Errorf("failed to mark OTP as used: %w", err)
+		return 0, err
+	}
+	return s.resendCooldown(ctx, phoneNumber)
+}
+
+// resendCooldown counts the cooldown from when the canonical phone number's
+// latest OTP was created, whether or not that OTP is still pending. It only
+// applies once the number has used up its free resends.
+func (s *authService) resendCooldown(ctx context.Context, phoneNumber string) (time.Duration, error) {
+	cooldown := s.config.GetResendCooldown()
+	if cooldown <= 0 {
+		return 0, nil
+	}
+	if s.burst != nil && s.burst.Count(phoneNumber) <= s.config.OTP.FreeResends {
+		return 0, nil
+	}
+	latest, err := s.otpRepo.GetLatestByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest OTP: %w", err)
+	}
+	if latest == nil {
+		return 0, nil
+	}
+	if remaining := cooldown - time.Since(latest.CreatedAt); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+func (s *authService) VerifyOTP(ctx context.Context, verification models.OTPVerification) (*models.AuthResponse, error) {
+	phoneNumber, err := s.canonicalPhoneNumber(verification.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	verification.PhoneNumber = phoneNumber
+
+	otp, err := s.consumeOTP(ctx, verification.PhoneNumber, verification.Code, true)
+	if err != nil {
+		s.recordVerifyFailure(err)
+		return nil, err
+	}
+	log.Printf("OTP verified for %s (request %s)", models.MaskPhone(verification.PhoneNumber), otp.RequestID)
+
+	if s.config.VerifyOnly() {
+		token, expiresAt, err := s.signPhoneJWT(verification.PhoneNumber)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate token: %w", err)
+		}
+		return &models.AuthResponse{
+			Token:     token,
+			ExpiresAt: expiresAt,
+			RequestID: otp.RequestID,
+		}, nil
 	}
 
 	// Check if user exists
@@ -104,13 +469,30 @@ func (s *authService) VerifyOTP(ctx context.Context, verification models.OTPVeri
 
 	// Create new user if doesn't exist
 	if user == nil {
-		user = models.NewUser(verification.PhoneNumber)
+		// Codes for unknown numbers are never sent, but could be guessed
+		if s.config.OTP.RequireExistingUser {
+			return nil, ErrUserNotFound
+		}
+		if !s.config.FeatureEnabled(config.FeatureRegistration) {
+			return nil, ErrRegistrationDisabled
+		}
+
+		id, err := s.idGenerator.NewID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate user ID: %w", err)
+		}
+		user = models.NewUserWithID(id, verification.PhoneNumber)
 		err = s.userRepo.Create(ctx, user)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create user: %w", err)
 		}
 	}
 
+	if !user.IsActive() {
+		log.Printf("SECURITY: sign-in refused for %s user %s", user.Status, user.ID)
+		return nil, ErrAccountSuspended
+	}
+
 	// Update last login time
 	user.UpdateLastLogin()
 	err = s.userRepo.Update(ctx, user)
@@ -124,13 +506,304 @@ func (s *authService) VerifyOTP(ctx context.Context, verification models.OTPVeri
 		return nil, fmt.Errorf("failed to generate token: %w", err)
 	}
 
+	userResponse := user.ToResponse()
+	return &models.AuthResponse{
+		Token:     token,
+		User:      &userResponse,
+		ExpiresAt: expiresAt,
+		RequestID: otp.RequestID,
+	}, nil
+}
+
+// canonicalPhoneNumber converts a phone number to the E.164 form OTPs are
+// stored under, reading national numbers as belonging to the default region
+func (s *authService) canonicalPhoneNumber(phoneNumber string) (string, error) {
+	canonical, err := validation.CanonicalPhoneNumber(phoneNumber, s.config.OTP.DefaultRegion)
+	if err != nil {
+		return "", ErrInvalidPhoneNumber
+	}
+	return canonical, nil
+}
+
+// consumeOTP checks code against the pending OTP for the phone number and, if
+// it matches, marks it as used so it can't be verified again. Only with
+// multiUse does a code last for OTP_MAX_USES verifications; phone changes and
+// recovery use it up at once. It returns the OTP that matched.
+func (s *authService) consumeOTP(ctx context.Context, phoneNumber, code string, multiUse bool) (*models.OTP, error) {
+	// Forgive pasted or auto-filled codes. Separators can only be removed
+	// safely when codes are known to consist of digits alone; custom
+	// generators opt in with StripCodeSeparators.
+	code = strings.TrimSpace(code)
+	if _, numeric := s.codeGenerator.(numericCodeGenerator); numeric || s.config.OTP.StripCodeSeparators {
+		code = models.StripCodeSeparators(code)
+	}
+
+	// Get the latest valid OTPs for the phone number: as many as
+	// AcceptRecentCount allows, and at least the one before the latest when
+	// the previous code grace period is enabled
+	limit := s.config.GetAcceptRecentCount()
+	if s.config.OTP.PreviousCodeGraceSeconds > 0 && limit < 2 {
+		limit = 2
+	}
+
+	otps, err := s.otpRepo.GetRecentByPhoneNumber(ctx, phoneNumber, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OTP: %w", err)
+	}
+
+	if len(otps) == 0 {
+		return nil, s.unusableOTPReason(ctx, phoneNumber, code)
+	}
+
+	// Verify OTP code against every accepted candidate. The superseded code
+	// is also accepted if the latest one was issued within the grace period.
+	withinGrace := time.Since(otps[0].CreatedAt) <= s.config.GetPreviousCodeGrace()
+	var otp *models.OTP
+	for i, candidate := range otps {
+		accepted := i < s.config.GetAcceptRecentCount() || (i == 1 && withinGrace)
+		if accepted && candidate.Code == code {
+			otp = candidate
+			break
+		}
+	}
+
+	if otp == nil {
+		s.delayWrongCode(ctx, phoneNumber)
+		return nil, ErrOTPWrongCode
+	}
+
+	// Check if OTP is still valid
+	if !otp.IsValid() {
+		return nil, ErrOTPExpired
+	}
+
+	// Don't consume the OTP if the client has already gone away
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	// A multi-use code stays pending until its last use
+	exhausted := true
+	if multiUse && s.config.GetMaxOTPUses() > 1 {
+		remaining, err := s.otpRepo.ConsumeUse(ctx, otp)
+		if errors.Is(err, repository.ErrOTPUnavailable) {
+			return nil, ErrOTPAlreadyUsed
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to use OTP: %w", err)
+		}
+		exhausted = remaining == 0
+	}
+
+	// Mark the matching OTP, and any other pending ones, as used
+	if exhausted {
+		if err := s.otpRepo.MarkAsUsed(ctx, phoneNumber); err != nil {
+			return nil, fmt.Errorf("failed to mark OTP as used: %w", err)
+		}
+	}
+
+	if s.backoff != nil {
+		s.backoff.Reset(phoneNumber)
+	}
+	if s.burst != nil {
+		s.burst.Reset(phoneNumber)
+	}
+	return otp, nil
+}
+
+// delayWrongCode waits as long as the verify backoff asks before a wrong
+// code is reported, returning early if ctx is done
+func (s *authService) delayWrongCode(ctx context.Context, phoneNumber string) {
+	if s.backoff == nil {
+		return
+	}
+	delay := s.backoff.Failure(phoneNumber)
+	if delay <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// recordVerifyFailure reports err to the anomaly detector if it is a failed
+// verification rather than an internal or cancellation error.
+func (s *authService) recordVerifyFailure(err error) {
+	if s.anomalies == nil {
+		return
+	}
+	for _, failure := range []error{ErrOTPNotFound, ErrOTPExpired, ErrOTPWrongCode, ErrOTPAlreadyUsed} {
+		if errors.Is(err, failure) {
+			s.anomalies.RecordFailure()
+			return
+		}
+	}
+}
+
+// CancelOTP invalidates any pending OTP for the phone number. It succeeds
+// whether or not an OTP was pending so callers can't probe for one.
+func (s *authService) CancelOTP(ctx context.Context, phoneNumber string) error {
+	phoneNumber, err := s.canonicalPhoneNumber(phoneNumber)
+	if err != nil {
+		return err
+	}
+	if err := s.otpRepo.MarkAsUsed(ctx, phoneNumber); err != nil {
+		return fmt.Errorf("failed to cancel OTP: %w", err)
+	}
+	return nil
+}
+
+// unusableOTPReason explains why no valid OTP exists for the phone number by
+// inspecting the most recent one.
+func (s *authService) unusableOTPReason(ctx context.Context, phoneNumber, code string) error {
+	latest, err := s.otpRepo.GetLatestByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		return fmt.Errorf("failed to get OTP: %w", err)
+	}
+
+	switch {
+	case latest == nil:
+		return ErrOTPNotFound
+	case latest.Used:
+		s.detectReplay(latest, code)
+		return ErrOTPAlreadyUsed
+	case latest.IsExpired():
+		return ErrOTPExpired
+	default:
+		return ErrOTPNotFound
+	}
+}
+
+// detectReplay reports a resubmission of a used OTP's correct code. Only the
+// legitimate user and anyone who intercepted the code should know it, so a
+// recent match suggests the code was captured. The response is unchanged.
+func (s *authService) detectReplay(otp *models.OTP, code string) {
+	window := s.config.GetReplayWindow()
+	if window <= 0 || otp.Code != code || time.Since(otp.CreatedAt) > window {
+		return
+	}
+
+	s.replayCounter.Inc()
+	log.Printf("SECURITY: OTP replay detected for %s (request %s, code issued %s ago)",
+		models.MaskPhone(otp.PhoneNumber), otp.RequestID, time.Since(otp.CreatedAt).Round(time.Second))
+}
+
+// RefreshClaims issues a new token for the holder of claims carrying the
+// user's current details, such as a changed phone number, without another
+// OTP. The original authentication time is kept so that refreshing does not
+// satisfy step-up checks. Deleted users get ErrUserNotFound.
+func (s *authService) RefreshClaims(ctx context.Context, claims *models.Claims) (*models.AuthResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.IsActive() {
+		return nil, ErrAccountSuspended
+	}
+
+	token, expiresAt, err := s.signJWT(user, claims.AuthenticatedAt())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	userResponse := user.ToResponse()
 	return &models.AuthResponse{
 		Token:     token,
-		User:      user.ToResponse(),
+		User:      &userResponse,
 		ExpiresAt: expiresAt,
 	}, nil
 }
 
+// CheckAccountStatus returns ErrAccountSuspended if the user has been
+// suspended or banned since their token was issued, and ErrUserNotFound if
+// they have been deleted.
+func (s *authService) CheckAccountStatus(ctx context.Context, userID string) error {
+	// Verify-only tokens name a phone number, not an account
+	if s.config.VerifyOnly() {
+		return nil
+	}
+
+	status, err := s.userRepo.GetStatus(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get account status: %w", err)
+	}
+
+	switch status {
+	case "":
+		return ErrUserNotFound
+	case models.UserStatusActive:
+		return nil
+	default:
+		return ErrAccountSuspended
+	}
+}
+
+// ResetRateLimits lets a user request a new code right away by clearing the
+// OTP requests counted against their phone number and recovery phone, and
+// any wrong-code delay on either
+func (s *authService) ResetRateLimits(ctx context.Context, userID string) (*models.RateLimitReset, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	phoneNumbers := []string{user.PhoneNumber}
+	reset := &models.RateLimitReset{
+		UserID:      user.ID,
+		PhoneNumber: models.MaskPhone(user.PhoneNumber),
+	}
+	if user.RecoveryPhone != nil {
+		phoneNumbers = append(phoneNumbers, *user.RecoveryPhone)
+		reset.RecoveryPhone = models.MaskPhone(*user.RecoveryPhone)
+	}
+
+	for _, phoneNumber := range phoneNumbers {
+		cleared, err := s.otpRepo.ResetRateLimit(ctx, phoneNumber, s.rateLimitHorizon())
+		if err != nil {
+			return nil, fmt.Errorf("failed to reset rate limit: %w", err)
+		}
+		reset.OTPRequestsCleared += cleared
+		if s.backoff != nil {
+			s.backoff.Reset(phoneNumber)
+			reset.VerifyBackoffCleared = true
+		}
+		if s.burst != nil {
+			s.burst.Reset(phoneNumber)
+		}
+	}
+	return reset, nil
+}
+
+// DeleteExpiredOTPs removes expired OTPs that no longer count toward any
+// rate limit. It is safe to call repeatedly.
+func (s *authService) DeleteExpiredOTPs(ctx context.Context) (*models.OTPCleanup, error) {
+	deleted, err := s.otpRepo.DeleteExpired(ctx, s.rateLimitHorizon())
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired OTPs: %w", err)
+	}
+	return &models.OTPCleanup{Deleted: deleted}, nil
+}
+
+// rateLimitHorizon returns how far back OTP requests are counted: the
+// daily limit or the window, whichever is longer
+func (s *authService) rateLimitHorizon() time.Time {
+	since := time.Now().Add(-24 * time.Hour)
+	if window := time.Now().Add(-s.config.GetRateLimitWindow()); window.Before(since) {
+		since = window
+	}
+	return since
+}
+
 func (s *authService) ValidateToken(tokenString string) (*models.Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &models.Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -143,35 +816,75 @@ func (s *authService) ValidateToken(tokenString string) (*models.Claims, error)
 		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 
-	if claims, ok := token.Claims.(*models.Claims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*models.Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
 	}
 
-	return nil, errors.New("invalid token")
+	// A token is only accepted in the mode that issued it: after a switch to
+	// verify-only, a user token would otherwise skip account status checks
+	if (claims.Audience == models.VerifyOnlyAudience) != s.config.VerifyOnly() {
+		return nil, errors.New("invalid token: issued in another auth mode")
+	}
+	return claims, nil
 }
 
-func (s *authService) generateRandomCode(length int) (string, error) {
-	const digits = "0123456789"
-	code := make([]byte, length)
-
-	for i := range code {
-		num, err := rand.Int(rand.Reader, big.NewInt(int64(len(digits))))
-		if err != nil {
-			return "", err
-		}
-		code[i] = digits[num.Int64()]
+// checkContext returns ErrRequestCancelled if ctx is done
+func checkContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrRequestCancelled, err)
 	}
-
-	return string(code), nil
+	return nil
 }
 
+// generateJWT issues a token for a user who has just verified an OTP
 func (s *authService) generateJWT(user *models.User) (string, time.Time, error) {
-	expiresAt := time.Now().Add(s.config.GetJWTExpiry())
+	return s.signJWT(user, time.Now())
+}
+
+// signJWT issues a token for user carrying authTime as when they last
+// verified an OTP
+func (s *authService) signJWT(user *models.User, authTime time.Time) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.config.GetJWTExpiry())
+
+	subject := user.ID
+	if s.config.JWT.SubjectClaim == config.JWTSubjectPhoneNumber {
+		subject = user.PhoneNumber
+	}
 
 	claims := &models.Claims{
+		Subject:     subject,
 		UserID:      user.ID,
 		PhoneNumber: user.PhoneNumber,
 		Exp:         expiresAt.Unix(),
+		Iat:         now.Unix(),
+		AuthTime:    authTime.Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(s.config.JWT.Secret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expiresAt, nil
+}
+
+// signPhoneJWT issues the short-lived verify-only token proving ownership of
+// phoneNumber, which is also its subject. Its audience sets it apart from
+// user tokens.
+func (s *authService) signPhoneJWT(phoneNumber string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.config.GetVerifyOnlyTokenExpiry())
+
+	claims := &models.Claims{
+		Subject:     phoneNumber,
+		PhoneNumber: phoneNumber,
+		Exp:         expiresAt.Unix(),
+		Iat:         now.Unix(),
+		AuthTime:    now.Unix(),
+		Audience:    models.VerifyOnlyAudience,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -1,12 +1,22 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"otp/internal/config"
+	"otp/internal/metrics"
 	"otp/internal/models"
+	"otp/internal/ratelimit"
+	"otp/internal/repository"
 )
 
 // Mock repositories for testing
@@ -35,6 +45,40 @@ func (m *mockUserRepository) GetByPhoneNumber(ctx context.Context, phoneNumber s
 	return nil, nil
 }
 
+func (m *mockUserRepository) GetByRecoveryPhone(ctx context.Context, phoneNumber string) (*models.User, error) {
+	for _, user := range m.users {
+		if user.RecoveryPhone != nil && *user.RecoveryPhone == phoneNumber {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockUserRepository) GetStatus(ctx context.Context, id string) (models.UserStatus, error) {
+	if user, exists := m.users[id]; exists {
+		return user.Status, nil
+	}
+	return "", nil
+}
+
+func (m *mockUserRepository) SetStatus(ctx context.Context, id string, status models.UserStatus) (*models.User, error) {
+	user, exists := m.users[id]
+	if !exists {
+		return nil, nil
+	}
+	user.SetStatus(status)
+	return user, nil
+}
+
+func (m *mockUserRepository) UpdateMetadata(ctx context.Context, id string, previous, metadata models.Metadata) (bool, error) {
+	user, exists := m.users[id]
+	if !exists {
+		return false, nil
+	}
+	user.Metadata = metadata
+	return true, nil
+}
+
 func (m *mockUserRepository) Update(ctx context.Context, user *models.User) error {
 	m.users[user.ID] = user
 	return nil
@@ -45,6 +89,10 @@ func (m *mockUserRepository) List(ctx context.Context, query models.PaginationQu
 	return &models.UserListResponse{}, nil
 }
 
+func (m *mockUserRepository) Count(ctx context.Context, filter models.UserFilter) (int, error) {
+	return len(m.users), nil
+}
+
 func (m *mockUserRepository) Delete(ctx context.Context, id string) error {
 	delete(m.users, id)
 	return nil
@@ -52,6 +100,12 @@ func (m *mockUserRepository) Delete(ctx context.Context, id string) error {
 
 type mockOTPRepository struct {
 	otps map[string]*models.OTP
+	// recent holds newest-first OTP history for tests that need more than
+	// the latest OTP per phone number
+	recent map[string][]*models.OTP
+	// limitResets holds when each phone number's rate limit was last reset;
+	// OTPs created before then no longer count
+	limitResets map[string]time.Time
 }
 
 func (m *mockOTPRepository) Create(ctx context.Context, otp *models.OTP) error {
@@ -66,27 +120,102 @@ func (m *mockOTPRepository) GetByPhoneNumber(ctx context.Context, phoneNumber st
 	return nil, nil
 }
 
+func (m *mockOTPRepository) GetRecentByPhoneNumber(ctx context.Context, phoneNumber string, limit int) ([]*models.OTP, error) {
+	var otps []*models.OTP
+	if history, exists := m.recent[phoneNumber]; exists {
+		otps = history
+	} else if otp, exists := m.otps[phoneNumber]; exists {
+		otps = []*models.OTP{otp}
+	}
+
+	var valid []*models.OTP
+	for _, otp := range otps {
+		if otp.IsValid() && len(valid) < limit {
+			valid = append(valid, otp)
+		}
+	}
+	return valid, nil
+}
+
+func (m *mockOTPRepository) GetLatestByPhoneNumber(ctx context.Context, phoneNumber string) (*models.OTP, error) {
+	if history, exists := m.recent[phoneNumber]; exists && len(history) > 0 {
+		return history[0], nil
+	}
+	if otp, exists := m.otps[phoneNumber]; exists {
+		return otp, nil
+	}
+	return nil, nil
+}
+
+func (m *mockOTPRepository) ListByPhoneNumber(ctx context.Context, phoneNumber string) ([]*models.OTP, error) {
+	if history, exists := m.recent[phoneNumber]; exists {
+		return history, nil
+	}
+	if otp, exists := m.otps[phoneNumber]; exists {
+		return []*models.OTP{otp}, nil
+	}
+	return nil, nil
+}
+
 func (m *mockOTPRepository) MarkAsUsed(ctx context.Context, phoneNumber string) error {
 	if otp, exists := m.otps[phoneNumber]; exists {
 		otp.Used = true
 	}
+	for _, otp := range m.recent[phoneNumber] {
+		otp.Used = true
+	}
 	return nil
 }
 
-func (m *mockOTPRepository) DeleteExpired(ctx context.Context) error {
-	return nil
+func (m *mockOTPRepository) ConsumeUse(ctx context.Context, otp *models.OTP) (int, error) {
+	if otp.Used || otp.UsesRemaining < 1 {
+		return 0, repository.ErrOTPUnavailable
+	}
+	otp.UsesRemaining--
+	otp.Used = otp.UsesRemaining == 0
+	return otp.UsesRemaining, nil
+}
+
+func (m *mockOTPRepository) DeleteExpired(ctx context.Context, createdBefore time.Time) (int, error) {
+	deleted := 0
+	for phoneNumber, otp := range m.otps {
+		if otp.IsExpired() && otp.CreatedAt.Before(createdBefore) {
+			delete(m.otps, phoneNumber)
+			deleted++
+		}
+	}
+	return deleted, nil
 }
 
 func (m *mockOTPRepository) GetRecentOTPCount(ctx context.Context, phoneNumber string, since time.Time) (int, error) {
 	count := 0
 	for _, otp := range m.otps {
-		if otp.PhoneNumber == phoneNumber && otp.CreatedAt.After(since) {
+		if otp.PhoneNumber == phoneNumber && otp.CreatedAt.After(since) && otp.CreatedAt.After(m.limitResets[phoneNumber]) {
 			count++
 		}
 	}
 	return count, nil
 }
 
+func (m *mockOTPRepository) ResetRateLimit(ctx context.Context, phoneNumber string, since time.Time) (int, error) {
+	count, _ := m.GetRecentOTPCount(ctx, phoneNumber, since)
+	if m.limitResets == nil {
+		m.limitResets = make(map[string]time.Time)
+	}
+	m.limitResets[phoneNumber] = time.Now()
+	return count, nil
+}
+
+func (m *mockOTPRepository) CountRows(ctx context.Context) (int, int, error) {
+	expired := 0
+	for _, otp := range m.otps {
+		if otp.IsExpired() {
+			expired++
+		}
+	}
+	return len(m.otps), expired, nil
+}
+
 func TestAuthService_GenerateOTP(t *testing.T) {
 	// Setup
 	cfg := &config.Config{
@@ -228,3 +357,1632 @@ func TestAuthService_ValidateToken(t *testing.T) {
 		t.Error("Expected error for empty token, got nil")
 	}
 }
+
+func TestAuthService_GenerateOTP_DailyLimit(t *testing.T) {
+	// Setup
+	cfg := &config.Config{
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   3,
+			WindowMinutes: 10,
+			MaxPerDay:     1,
+		},
+	}
+
+	userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(userRepo, otpRepo, cfg)
+
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+
+	if _, err := authService.GenerateOTP(ctx, phoneNumber); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The window limit still has room, so the daily cap is the one that trips
+	_, err := authService.GenerateOTP(ctx, phoneNumber)
+	if !errors.Is(err, ErrDailyLimitExceeded) {
+		t.Errorf("Expected ErrDailyLimitExceeded, got %v", err)
+	}
+}
+
+func TestAuthService_VerifyOTP_PreviousCodeGrace(t *testing.T) {
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+
+	tests := []struct {
+		name          string
+		graceSeconds  int
+		latestAge     time.Duration
+		submittedCode string
+		wantErr       bool
+	}{
+		{"latest code accepted", 0, 0, "222222", false},
+		{"previous code rejected when grace disabled", 0, 0, "111111", true},
+		{"previous code accepted within grace", 30, 10 * time.Second, "111111", false},
+		{"previous code rejected after grace", 30, 45 * time.Second, "111111", true},
+		{"unknown code rejected within grace", 30, 10 * time.Second, "333333", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				JWT: config.JWTConfig{
+					Secret:      "test-secret",
+					ExpiryHours: 24,
+				},
+				OTP: config.OTPConfig{
+					PreviousCodeGraceSeconds: tt.graceSeconds,
+				},
+			}
+
+			previous := models.NewOTP(phoneNumber, "111111", 2)
+			previous.CreatedAt = time.Now().Add(-time.Minute)
+			latest := models.NewOTP(phoneNumber, "222222", 2)
+			latest.CreatedAt = time.Now().Add(-tt.latestAge)
+
+			userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+			otpRepo := &mockOTPRepository{
+				otps:   make(map[string]*models.OTP),
+				recent: map[string][]*models.OTP{phoneNumber: {latest, previous}},
+			}
+			authService := NewAuthService(userRepo, otpRepo, cfg)
+
+			_, err := authService.VerifyOTP(ctx, models.OTPVerification{
+				PhoneNumber: phoneNumber,
+				Code:        tt.submittedCode,
+			})
+			if tt.wantErr && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthService_VerifyOTP_FailureReasons(t *testing.T) {
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+
+	expired := models.NewOTP(phoneNumber, "123456", 2)
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	used := models.NewOTP(phoneNumber, "123456", 2)
+	used.Used = true
+
+	tests := []struct {
+		name    string
+		otp     *models.OTP
+		code    string
+		wantErr error
+	}{
+		{"no OTP requested", nil, "123456", ErrOTPNotFound},
+		{"expired OTP", expired, "123456", ErrOTPExpired},
+		{"already used OTP", used, "123456", ErrOTPAlreadyUsed},
+		{"wrong code", models.NewOTP(phoneNumber, "123456", 2), "654321", ErrOTPWrongCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				JWT: config.JWTConfig{
+					Secret:      "test-secret",
+					ExpiryHours: 24,
+				},
+			}
+
+			userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+			otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+			if tt.otp != nil {
+				otpRepo.otps[phoneNumber] = tt.otp
+			}
+			authService := NewAuthService(userRepo, otpRepo, cfg)
+
+			_, err := authService.VerifyOTP(ctx, models.OTPVerification{
+				PhoneNumber: phoneNumber,
+				Code:        tt.code,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAuthService_CancelledContext(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   3,
+			WindowMinutes: 10,
+		},
+	}
+
+	userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(userRepo, otpRepo, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	phoneNumber := "+1234567890"
+
+	// No OTP is issued for an abandoned request
+	_, err := authService.GenerateOTP(ctx, phoneNumber)
+	if !errors.Is(err, ErrRequestCancelled) {
+		t.Errorf("Expected ErrRequestCancelled, got %v", err)
+	}
+	if _, exists := otpRepo.otps[phoneNumber]; exists {
+		t.Error("Expected no OTP to be created for a cancelled request")
+	}
+
+	// A pending OTP is not consumed by an abandoned verification
+	otp := models.NewOTP(phoneNumber, "123456", 2)
+	otpRepo.otps[phoneNumber] = otp
+
+	_, err = authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: phoneNumber, Code: "123456"})
+	if !errors.Is(err, ErrRequestCancelled) {
+		t.Errorf("Expected ErrRequestCancelled, got %v", err)
+	}
+	if otp.Used {
+		t.Error("Expected OTP to remain unused for a cancelled request")
+	}
+}
+
+type fixedCodeGenerator struct {
+	code string
+}
+
+func (g fixedCodeGenerator) Generate(length int) (string, error) {
+	return g.code, nil
+}
+
+// sequenceCodeGenerator returns its codes in order, repeating the last one
+type sequenceCodeGenerator struct {
+	codes []string
+	calls int
+}
+
+func (g *sequenceCodeGenerator) Generate(length int) (string, error) {
+	code := g.codes[len(g.codes)-1]
+	if g.calls < len(g.codes) {
+		code = g.codes[g.calls]
+	}
+	g.calls++
+	return code, nil
+}
+
+func TestAuthService_GenerateOTP_AvoidsRepeatedCode(t *testing.T) {
+	cfg := &config.Config{
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   5,
+			WindowMinutes: 10,
+		},
+	}
+
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+	userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	generator := &sequenceCodeGenerator{codes: []string{"111111", "111111", "222222"}}
+	authService := NewAuthService(userRepo, otpRepo, cfg, WithCodeGenerator(generator))
+
+	if _, err := authService.GenerateOTP(ctx, phoneNumber); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The resend collides with the pending code, so it is generated again
+	if _, err := authService.GenerateOTP(ctx, phoneNumber); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if code := otpRepo.otps[phoneNumber].Code; code != "222222" {
+		t.Errorf("Expected a different code than the pending one, got %s", code)
+	}
+
+	// A generator that only repeats itself still gets a code issued
+	generator.codes = []string{"222222"}
+	generator.calls = 0
+	if _, err := authService.GenerateOTP(ctx, phoneNumber); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if generator.calls != maxCodeRegenerations+1 {
+		t.Errorf("Expected %d attempts, got %d", maxCodeRegenerations+1, generator.calls)
+	}
+}
+
+func TestAuthService_CustomCodeGenerator(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   3,
+			WindowMinutes: 10,
+		},
+	}
+
+	userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(userRepo, otpRepo, cfg, WithCodeGenerator(fixedCodeGenerator{code: "apple-tiger"}))
+
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+
+	if _, err := authService.GenerateOTP(ctx, phoneNumber); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if otpRepo.otps[phoneNumber].Code != "apple-tiger" {
+		t.Errorf("Expected custom code to be stored, got %s", otpRepo.otps[phoneNumber].Code)
+	}
+
+	// Verification compares the custom code like any other string
+	response, err := authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: phoneNumber, Code: "apple-tiger"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.Token == "" {
+		t.Error("Expected JWT token, got empty string")
+	}
+}
+
+func TestNumericCodeGenerator(t *testing.T) {
+	generator := NewNumericCodeGenerator()
+
+	for _, length := range []int{4, 6, 8} {
+		code, err := generator.Generate(length)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(code) != length {
+			t.Errorf("Expected code length %d, got %d", length, len(code))
+		}
+		for _, r := range code {
+			if r < '0' || r > '9' {
+				t.Errorf("Expected only digits, got %q", code)
+				break
+			}
+		}
+	}
+}
+
+func TestNumericCodeGenerator_LeadingZeros(t *testing.T) {
+	generator := NewNumericCodeGenerator()
+
+	// Each code starts with 0 one time in ten, so 1000 codes without one
+	// would mean leading zeros are being dropped or never generated
+	sawLeadingZero := false
+	for i := 0; i < 1000; i++ {
+		code, err := generator.Generate(6)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(code) != 6 {
+			t.Fatalf("Expected code length 6, got %q", code)
+		}
+		if code[0] == '0' {
+			sawLeadingZero = true
+		}
+	}
+
+	if !sawLeadingZero {
+		t.Error("Expected at least one code with a leading zero")
+	}
+}
+
+func TestAuthService_VerifyOTP_LeadingZero(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+	}
+
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+
+	// The zero-stripped form of the code must not verify
+	userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	otpRepo.otps[phoneNumber] = models.NewOTP(phoneNumber, "012345", 2)
+	authService := NewAuthService(userRepo, otpRepo, cfg)
+
+	_, err := authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: phoneNumber, Code: "12345"})
+	if !errors.Is(err, ErrOTPWrongCode) {
+		t.Errorf("Expected ErrOTPWrongCode for zero-stripped code, got %v", err)
+	}
+
+	// The exact code, leading zero included, verifies
+	if _, err := authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: phoneNumber, Code: "012345"}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestAuthService_ChangePhoneNumber(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   3,
+			WindowMinutes: 10,
+		},
+	}
+
+	ctx := context.Background()
+	oldPhone := "+1234567890"
+	newPhone := "+1987654321"
+	takenPhone := "+1555000111"
+
+	user := models.NewUser(oldPhone)
+	other := models.NewUser(takenPhone)
+	userRepo := &mockUserRepository{users: map[string]*models.User{user.ID: user, other.ID: other}}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(userRepo, otpRepo, cfg, WithCodeGenerator(fixedCodeGenerator{code: "424242"}))
+
+	if _, err := authService.RequestPhoneChange(ctx, user.ID, models.PhoneChangeRequest{NewPhoneNumber: oldPhone}); !errors.Is(err, ErrSamePhoneNumber) {
+		t.Errorf("Expected ErrSamePhoneNumber, got %v", err)
+	}
+	if _, err := authService.RequestPhoneChange(ctx, user.ID, models.PhoneChangeRequest{NewPhoneNumber: takenPhone}); !errors.Is(err, ErrPhoneNumberTaken) {
+		t.Errorf("Expected ErrPhoneNumberTaken, got %v", err)
+	}
+	if _, err := authService.RequestPhoneChange(ctx, "missing", models.PhoneChangeRequest{NewPhoneNumber: newPhone}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	if _, err := authService.RequestPhoneChange(ctx, user.ID, models.PhoneChangeRequest{NewPhoneNumber: newPhone}); err != nil {
+		t.Fatalf("Expected no error requesting change, got %v", err)
+	}
+
+	_, err := authService.ConfirmPhoneChange(ctx, user.ID, models.PhoneChangeConfirmation{NewPhoneNumber: newPhone, Code: "000000"})
+	if !errors.Is(err, ErrOTPWrongCode) {
+		t.Errorf("Expected ErrOTPWrongCode, got %v", err)
+	}
+	if user.PhoneNumber != oldPhone {
+		t.Errorf("Expected phone number to stay %s after a wrong code, got %s", oldPhone, user.PhoneNumber)
+	}
+
+	response, err := authService.ConfirmPhoneChange(ctx, user.ID, models.PhoneChangeConfirmation{NewPhoneNumber: newPhone, Code: "424242"})
+	if err != nil {
+		t.Fatalf("Expected no error confirming change, got %v", err)
+	}
+	if user.PhoneNumber != newPhone {
+		t.Errorf("Expected phone number %s, got %s", newPhone, user.PhoneNumber)
+	}
+
+	claims, err := authService.ValidateToken(response.Token)
+	if err != nil {
+		t.Fatalf("Expected new token to validate, got %v", err)
+	}
+	if claims.PhoneNumber != newPhone {
+		t.Errorf("Expected token phone number %s, got %s", newPhone, claims.PhoneNumber)
+	}
+}
+
+func TestAuthService_VerifyOTP_ReplayDetection(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+		OTP: config.OTPConfig{
+			ReplayWindowMinutes: 60,
+		},
+	}
+
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+
+	userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	otpRepo.otps[phoneNumber] = models.NewOTP(phoneNumber, "123456", 2)
+	counter := metrics.NewCounter("otp_replay_detected_total", "")
+	authService := NewAuthService(userRepo, otpRepo, cfg, WithReplayCounter(counter))
+
+	if _, err := authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: phoneNumber, Code: "123456"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// A wrong code against the used OTP is not a replay
+	_, err := authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: phoneNumber, Code: "654321"})
+	if !errors.Is(err, ErrOTPAlreadyUsed) {
+		t.Errorf("Expected ErrOTPAlreadyUsed, got %v", err)
+	}
+	if counter.Value() != 0 {
+		t.Errorf("Expected no replay for a wrong code, got %d", counter.Value())
+	}
+
+	_, err = authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: phoneNumber, Code: "123456"})
+	if !errors.Is(err, ErrOTPAlreadyUsed) {
+		t.Errorf("Expected ErrOTPAlreadyUsed, got %v", err)
+	}
+	if counter.Value() != 1 {
+		t.Errorf("Expected 1 replay, got %d", counter.Value())
+	}
+
+	// Codes issued before the window are not reported
+	otpRepo.otps[phoneNumber].CreatedAt = time.Now().Add(-2 * time.Hour)
+	authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: phoneNumber, Code: "123456"})
+	if counter.Value() != 1 {
+		t.Errorf("Expected replay outside the window to be ignored, got %d", counter.Value())
+	}
+}
+
+func TestAuthService_RequestIDCorrelation(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   3,
+			WindowMinutes: 10,
+		},
+	}
+
+	ctx := ContextWithClientIP(context.Background(), "203.0.113.7")
+	phoneNumber := "+1234567890"
+
+	userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(userRepo, otpRepo, cfg, WithCodeGenerator(fixedCodeGenerator{code: "123456"}))
+
+	generated, err := authService.GenerateOTP(ctx, phoneNumber)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if generated.RequestID == "" {
+		t.Fatal("Expected generate response to carry a request ID")
+	}
+	if ip := otpRepo.otps[phoneNumber].IP; ip != "203.0.113.7" {
+		t.Errorf("Expected the OTP to record the client IP, got %q", ip)
+	}
+
+	verified, err := authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: phoneNumber, Code: "123456"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if verified.RequestID != generated.RequestID {
+		t.Errorf("Expected verify request ID %s, got %s", generated.RequestID, verified.RequestID)
+	}
+}
+
+func TestAuthService_GenerateOTP_RateLimitWarning(t *testing.T) {
+	cfg := &config.Config{
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:      3,
+			WindowMinutes:    10,
+			WarningThreshold: 1,
+		},
+	}
+
+	userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(userRepo, otpRepo, cfg)
+
+	ctx := context.Background()
+
+	phoneNumber := "+1234567890"
+	response, err := authService.GenerateOTP(ctx, phoneNumber)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.Warning != "" {
+		t.Errorf("Expected no warning with 2 requests remaining, got %q", response.Warning)
+	}
+
+	// The mock keeps one OTP per key, so seed the earlier request separately
+	cfg.RateLimit.MaxRequests = 2
+	otpRepo.otps = make(map[string]*models.OTP)
+	otpRepo.otps["earlier"] = &models.OTP{PhoneNumber: phoneNumber, CreatedAt: time.Now()}
+	response, err = authService.GenerateOTP(ctx, phoneNumber)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.Warning == "" {
+		t.Error("Expected a warning with no requests remaining")
+	}
+}
+
+func TestAuthService_VerifyOTP_AcceptRecentCount(t *testing.T) {
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+
+	tests := []struct {
+		name          string
+		acceptRecent  int
+		submittedCode string
+		wantErr       bool
+	}{
+		{"latest code accepted by default", 0, "333333", false},
+		{"earlier code rejected by default", 0, "222222", true},
+		{"second most recent accepted", 2, "222222", false},
+		{"third most recent rejected", 2, "111111", true},
+		{"all three accepted", 3, "111111", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				JWT: config.JWTConfig{
+					Secret:      "test-secret",
+					ExpiryHours: 24,
+				},
+				OTP: config.OTPConfig{
+					AcceptRecentCount: tt.acceptRecent,
+				},
+			}
+
+			userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+			otpRepo := &mockOTPRepository{
+				otps: make(map[string]*models.OTP),
+				recent: map[string][]*models.OTP{phoneNumber: {
+					models.NewOTP(phoneNumber, "333333", 2),
+					models.NewOTP(phoneNumber, "222222", 2),
+					models.NewOTP(phoneNumber, "111111", 2),
+				}},
+			}
+			authService := NewAuthService(userRepo, otpRepo, cfg)
+
+			_, err := authService.VerifyOTP(ctx, models.OTPVerification{
+				PhoneNumber: phoneNumber,
+				Code:        tt.submittedCode,
+			})
+			if tt.wantErr && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthService_GenerateOTP_RateLimitExemptions(t *testing.T) {
+	cfg := &config.Config{
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   1,
+			WindowMinutes: 10,
+		},
+	}
+
+	exemptions, err := ratelimit.NewExemptions([]string{"+15550000001"}, []string{"203.0.113.0/24"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		phoneNumber string
+		clientIP    string
+		wantErr     bool
+	}{
+		{"exempt phone", "+15550000001", "198.51.100.1", false},
+		{"exempt IP", "+15550000002", "203.0.113.9", false},
+		{"not exempt", "+15550000003", "198.51.100.1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+			otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+			otpRepo.otps["earlier"] = &models.OTP{PhoneNumber: tt.phoneNumber, CreatedAt: time.Now()}
+			authService := NewAuthService(userRepo, otpRepo, cfg, WithRateLimitExemptions(exemptions))
+
+			ctx := ContextWithClientIP(context.Background(), tt.clientIP)
+			_, err := authService.GenerateOTP(ctx, tt.phoneNumber)
+			if tt.wantErr && !errors.Is(err, ErrRateLimitExceeded) {
+				t.Errorf("Expected ErrRateLimitExceeded, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthService_GenerateOTP_ExemptionLoggedOnlyWhenDebugging(t *testing.T) {
+	exemptions, err := ratelimit.NewExemptions([]string{"+15550000001"}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	for _, debug := range []bool{false, true} {
+		logs.Reset()
+		cfg := &config.Config{
+			OTP:       config.OTPConfig{ExpiryMinutes: 2, Length: 6},
+			RateLimit: config.RateLimitConfig{MaxRequests: 1, WindowMinutes: 10},
+			DebugLog:  config.DebugLogConfig{Enabled: debug},
+		}
+		authService := NewAuthService(&mockUserRepository{users: make(map[string]*models.User)},
+			&mockOTPRepository{otps: make(map[string]*models.OTP)}, cfg, WithRateLimitExemptions(exemptions))
+
+		if _, err := authService.GenerateOTP(context.Background(), "+15550000001"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if logged := strings.Contains(logs.String(), "rate limit exemption applied"); logged != debug {
+			t.Errorf("With DEBUG_LOG_ENABLED=%v, expected the exemption logged to be %v, got %v", debug, debug, logged)
+		}
+	}
+}
+
+func TestAuthService_ResendCooldown(t *testing.T) {
+	cfg := &config.Config{
+		OTP: config.OTPConfig{
+			ExpiryMinutes:         2,
+			Length:                6,
+			ResendCooldownSeconds: 60,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   5,
+			WindowMinutes: 10,
+		},
+	}
+
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(&mockUserRepository{users: make(map[string]*models.User)}, otpRepo, cfg)
+
+	if cooldown, err := authService.ResendCooldown(ctx, phoneNumber); err != nil || cooldown != 0 {
+		t.Fatalf("Expected no cooldown before any OTP, got %v, %v", cooldown, err)
+	}
+
+	// The cooldown runs from when the latest OTP was created
+	otpRepo.otps[phoneNumber] = &models.OTP{PhoneNumber: phoneNumber, CreatedAt: time.Now().Add(-20 * time.Second)}
+	cooldown, err := authService.ResendCooldown(ctx, "+1 234 567 890")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cooldown <= 39*time.Second || cooldown > 40*time.Second {
+		t.Errorf("Expected about 40s of cooldown left, got %v", cooldown)
+	}
+	if _, err := authService.GenerateOTP(ctx, phoneNumber); !errors.Is(err, ErrResendCooldown) {
+		t.Errorf("Expected ErrResendCooldown during the cooldown, got %v", err)
+	}
+
+	otpRepo.otps[phoneNumber].CreatedAt = time.Now().Add(-time.Minute)
+	if cooldown, err := authService.ResendCooldown(ctx, phoneNumber); err != nil || cooldown != 0 {
+		t.Errorf("Expected the cooldown to be over, got %v, %v", cooldown, err)
+	}
+	if _, err := authService.GenerateOTP(ctx, phoneNumber); err != nil {
+		t.Errorf("Expected a new OTP after the cooldown, got %v", err)
+	}
+
+	if _, err := authService.ResendCooldown(ctx, "not a number"); !errors.Is(err, ErrInvalidPhoneNumber) {
+		t.Errorf("Expected ErrInvalidPhoneNumber, got %v", err)
+	}
+}
+
+func TestAuthService_GenerateOTP_SlidingWindow(t *testing.T) {
+	cfg := &config.Config{
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   3,
+			WindowMinutes: 10,
+		},
+	}
+
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+
+	tests := []struct {
+		name       string
+		burstAge   time.Duration
+		wantLimits bool
+	}{
+		// With a fixed 10 minute window, a burst just before a boundary
+		// wouldn't count against requests just after it
+		{"burst across a fixed window boundary", 2 * time.Minute, true},
+		{"burst older than the window", 11 * time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+			otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+			for i := 0; i < cfg.RateLimit.MaxRequests; i++ {
+				otpRepo.otps[fmt.Sprintf("burst-%d", i)] = &models.OTP{
+					PhoneNumber: phoneNumber,
+					CreatedAt:   time.Now().Add(-tt.burstAge),
+				}
+			}
+			authService := NewAuthService(userRepo, otpRepo, cfg)
+
+			_, err := authService.GenerateOTP(ctx, phoneNumber)
+			if tt.wantLimits && !errors.Is(err, ErrRateLimitExceeded) {
+				t.Errorf("Expected ErrRateLimitExceeded, got %v", err)
+			}
+			if !tt.wantLimits && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthService_VerifyOTP_GroupedInput(t *testing.T) {
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+
+	tests := []struct {
+		name          string
+		generator     CodeGenerator
+		strip         bool
+		submittedCode string
+		wantErr       bool
+	}{
+		{"raw code", nil, false, "012345", false},
+		{"surrounding whitespace", nil, false, " 012345 ", false},
+		{"trailing newline", nil, false, "012345\n", false},
+		{"spaced numeric code", nil, false, "012 345", false},
+		{"dashed numeric code", nil, false, "012-345", false},
+		{"wrong digits still rejected", nil, false, "012-346", true},
+		{"extra digit not absorbed", nil, false, "012-3456", true},
+		{"custom code keeps separators by default", fixedCodeGenerator{code: "012345"}, false, "012-345", true},
+		{"custom code trimmed by default", fixedCodeGenerator{code: "012345"}, false, " 012345 ", false},
+		{"custom code stripped when enabled", fixedCodeGenerator{code: "012345"}, true, "012-345", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				JWT: config.JWTConfig{
+					Secret:      "test-secret",
+					ExpiryHours: 24,
+				},
+				OTP: config.OTPConfig{
+					StripCodeSeparators: tt.strip,
+				},
+			}
+
+			userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+			otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+			otpRepo.otps[phoneNumber] = models.NewOTP(phoneNumber, "012345", 2)
+			var options []AuthServiceOption
+			if tt.generator != nil {
+				options = append(options, WithCodeGenerator(tt.generator))
+			}
+			authService := NewAuthService(userRepo, otpRepo, cfg, options...)
+
+			_, err := authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: phoneNumber, Code: tt.submittedCode})
+			if tt.wantErr && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthService_AccountRecovery(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   10,
+			WindowMinutes: 10,
+		},
+	}
+
+	ctx := context.Background()
+	primaryPhone := "+1234567890"
+	recoveryPhone := "+1987654321"
+	newPhone := "+1555000111"
+
+	user := models.NewUser(primaryPhone)
+	userRepo := &mockUserRepository{users: map[string]*models.User{user.ID: user}}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(userRepo, otpRepo, cfg, WithCodeGenerator(fixedCodeGenerator{code: "424242"}))
+
+	if _, err := authService.RequestRecoveryPhone(ctx, user.ID, models.RecoveryPhoneRequest{RecoveryPhone: primaryPhone}); !errors.Is(err, ErrRecoveryPhoneIsPrimary) {
+		t.Errorf("Expected ErrRecoveryPhoneIsPrimary, got %v", err)
+	}
+
+	if _, err := authService.RequestRecoveryPhone(ctx, user.ID, models.RecoveryPhoneRequest{RecoveryPhone: recoveryPhone}); err != nil {
+		t.Fatalf("Expected no error requesting recovery phone, got %v", err)
+	}
+	if _, err := authService.ConfirmRecoveryPhone(ctx, user.ID, models.RecoveryPhoneConfirmation{RecoveryPhone: recoveryPhone, Code: "000000"}); !errors.Is(err, ErrOTPWrongCode) {
+		t.Errorf("Expected ErrOTPWrongCode, got %v", err)
+	}
+	response, err := authService.ConfirmRecoveryPhone(ctx, user.ID, models.RecoveryPhoneConfirmation{RecoveryPhone: recoveryPhone, Code: "424242"})
+	if err != nil {
+		t.Fatalf("Expected no error confirming recovery phone, got %v", err)
+	}
+	if response.RecoveryPhone == nil || *response.RecoveryPhone != recoveryPhone {
+		t.Fatalf("Expected recovery phone %s, got %v", recoveryPhone, response.RecoveryPhone)
+	}
+
+	// Another account cannot claim the same recovery phone
+	other := models.NewUser("+1444000222")
+	userRepo.users[other.ID] = other
+	if _, err := authService.RequestRecoveryPhone(ctx, other.ID, models.RecoveryPhoneRequest{RecoveryPhone: recoveryPhone}); !errors.Is(err, ErrPhoneNumberTaken) {
+		t.Errorf("Expected ErrPhoneNumberTaken, got %v", err)
+	}
+
+	// Recovery onto a number owned by another account is refused, but only
+	// once the recovery code has been verified
+	if _, err := authService.RecoverAccount(ctx, models.AccountRecoveryConfirmation{RecoveryPhone: recoveryPhone, NewPhoneNumber: other.PhoneNumber, Code: "424242"}); errors.Is(err, ErrPhoneNumberTaken) {
+		t.Errorf("Expected the code to be checked before the new number, got %v", err)
+	}
+	if _, err := authService.RequestAccountRecovery(ctx, models.RecoveryPhoneRequest{RecoveryPhone: recoveryPhone}); err != nil {
+		t.Fatalf("Expected no error requesting recovery, got %v", err)
+	}
+	if _, err := authService.RecoverAccount(ctx, models.AccountRecoveryConfirmation{RecoveryPhone: recoveryPhone, NewPhoneNumber: other.PhoneNumber, Code: "424242"}); !errors.Is(err, ErrPhoneNumberTaken) {
+		t.Errorf("Expected ErrPhoneNumberTaken, got %v", err)
+	}
+
+	// A new number must be proven with a code of its own before the move
+	if _, err := authService.RequestAccountRecovery(ctx, models.RecoveryPhoneRequest{RecoveryPhone: recoveryPhone}); err != nil {
+		t.Fatalf("Expected no error requesting recovery, got %v", err)
+	}
+	recovered, err := authService.RecoverAccount(ctx, models.AccountRecoveryConfirmation{RecoveryPhone: recoveryPhone, NewPhoneNumber: newPhone, Code: "424242"})
+	if err != nil {
+		t.Fatalf("Expected no error recovering account, got %v", err)
+	}
+	if recovered.PhoneChange == nil {
+		t.Fatal("Expected a code to be sent to the new phone number")
+	}
+	if user.PhoneNumber != primaryPhone {
+		t.Errorf("Expected phone number to stay %s until the new one is confirmed, got %s", primaryPhone, user.PhoneNumber)
+	}
+	claims, err := authService.ValidateToken(recovered.Token)
+	if err != nil {
+		t.Fatalf("Expected recovery token to validate, got %v", err)
+	}
+	if claims.UserID != user.ID || claims.Iat == 0 {
+		t.Errorf("Expected a fresh token for %s, got %+v", user.ID, claims)
+	}
+	if _, err := authService.ConfirmPhoneChange(ctx, claims.UserID, models.PhoneChangeConfirmation{NewPhoneNumber: newPhone, Code: "424242"}); err != nil {
+		t.Fatalf("Expected no error confirming the new phone number, got %v", err)
+	}
+	if user.PhoneNumber != newPhone {
+		t.Errorf("Expected phone number %s, got %s", newPhone, user.PhoneNumber)
+	}
+
+	// Recovering onto the recovery phone itself promotes it at once
+	if _, err := authService.RequestAccountRecovery(ctx, models.RecoveryPhoneRequest{RecoveryPhone: recoveryPhone}); err != nil {
+		t.Fatalf("Expected no error requesting recovery, got %v", err)
+	}
+	promoted, err := authService.RecoverAccount(ctx, models.AccountRecoveryConfirmation{RecoveryPhone: recoveryPhone, NewPhoneNumber: recoveryPhone, Code: "424242"})
+	if err != nil {
+		t.Fatalf("Expected no error recovering onto the recovery phone, got %v", err)
+	}
+	if promoted.PhoneChange != nil || user.PhoneNumber != recoveryPhone || user.RecoveryPhone != nil {
+		t.Errorf("Expected the recovery phone to become primary, got %+v", user)
+	}
+
+	// A code sent to a number that is nobody's recovery phone finds no account
+	unknownPhone := "+1333000444"
+	if _, err := authService.RequestAccountRecovery(ctx, models.RecoveryPhoneRequest{RecoveryPhone: unknownPhone}); err != nil {
+		t.Fatalf("Expected no error requesting recovery, got %v", err)
+	}
+	if _, err := authService.RecoverAccount(ctx, models.AccountRecoveryConfirmation{RecoveryPhone: unknownPhone, NewPhoneNumber: "+1333000555", Code: "424242"}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	if response, err := authService.RemoveRecoveryPhone(ctx, user.ID); err != nil || response.RecoveryPhone != nil {
+		t.Errorf("Expected recovery phone to be removed, got %v, %v", response, err)
+	}
+}
+
+func TestAuthService_RefreshClaims(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+	}
+
+	ctx := context.Background()
+	user := models.NewUser("+1234567890")
+	userRepo := &mockUserRepository{users: map[string]*models.User{user.ID: user}}
+	authService := NewAuthService(userRepo, &mockOTPRepository{otps: make(map[string]*models.OTP)}, cfg)
+
+	authTime := time.Now().Add(-time.Hour).Unix()
+	stale := &models.Claims{UserID: user.ID, PhoneNumber: "+1000000000", Iat: authTime, AuthTime: authTime}
+
+	response, err := authService.RefreshClaims(ctx, stale)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	claims, err := authService.ValidateToken(response.Token)
+	if err != nil {
+		t.Fatalf("Expected refreshed token to validate, got %v", err)
+	}
+	if claims.PhoneNumber != user.PhoneNumber {
+		t.Errorf("Expected phone number %s, got %s", user.PhoneNumber, claims.PhoneNumber)
+	}
+	if claims.AuthTime != authTime {
+		t.Errorf("Expected auth time %d to be kept, got %d", authTime, claims.AuthTime)
+	}
+	if claims.Iat <= authTime {
+		t.Errorf("Expected a new issue time, got %d", claims.Iat)
+	}
+
+	delete(userRepo.users, user.ID)
+	if _, err := authService.RefreshClaims(ctx, stale); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for a deleted user, got %v", err)
+	}
+}
+
+func TestAuthService_AccountStatus(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+	}
+
+	ctx := context.Background()
+	user := models.NewUser("+1234567890")
+	user.SetStatus(models.UserStatusSuspended)
+	userRepo := &mockUserRepository{users: map[string]*models.User{user.ID: user}}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	otpRepo.otps[user.PhoneNumber] = models.NewOTP(user.PhoneNumber, "123456", 2)
+	authService := NewAuthService(userRepo, otpRepo, cfg)
+
+	// A suspended user cannot sign in, even with a correct code
+	_, err := authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: user.PhoneNumber, Code: "123456"})
+	if !errors.Is(err, ErrAccountSuspended) {
+		t.Errorf("Expected ErrAccountSuspended, got %v", err)
+	}
+	if err := authService.CheckAccountStatus(ctx, user.ID); !errors.Is(err, ErrAccountSuspended) {
+		t.Errorf("Expected ErrAccountSuspended from status check, got %v", err)
+	}
+
+	user.SetStatus(models.UserStatusActive)
+	if err := authService.CheckAccountStatus(ctx, user.ID); err != nil {
+		t.Errorf("Expected active user to pass status check, got %v", err)
+	}
+	if err := authService.CheckAccountStatus(ctx, "missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for unknown user, got %v", err)
+	}
+}
+
+func TestAuthService_GenerateOTP_DebugPrint(t *testing.T) {
+	tests := []struct {
+		name        string
+		debugPrint  bool
+		environment string
+		wantPrinted bool
+	}{
+		{"disabled", false, "development", false},
+		{"enabled", true, "development", true},
+		{"enabled in production", true, "production", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Server: config.ServerConfig{Environment: tt.environment},
+				OTP: config.OTPConfig{
+					ExpiryMinutes: 2,
+					Length:        6,
+					DebugPrint:    tt.debugPrint,
+				},
+				RateLimit: config.RateLimitConfig{
+					MaxRequests:   3,
+					WindowMinutes: 10,
+				},
+			}
+			otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+			authService := NewAuthService(&mockUserRepository{users: make(map[string]*models.User)}, otpRepo, cfg,
+				WithCodeGenerator(fixedCodeGenerator{code: "424242"}))
+
+			output := captureStdout(t, func() {
+				if _, err := authService.GenerateOTP(context.Background(), "+1234567890"); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			})
+
+			if printed := strings.Contains(output, "424242"); printed != tt.wantPrinted {
+				t.Errorf("Expected code printed=%v, got output %q", tt.wantPrinted, output)
+			}
+			if strings.Contains(output, "+1234567890") {
+				t.Errorf("Expected phone number to be masked, got %q", output)
+			}
+		})
+	}
+}
+
+// captureStdout returns what fn writes to os.Stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	original := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = original }()
+
+	fn()
+	writer.Close()
+
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to read captured output: %v", err)
+	}
+	return string(output)
+}
+
+func TestAuthService_NationalFormatPhoneNumber(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+			DefaultRegion: "GB",
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   3,
+			WindowMinutes: 10,
+		},
+	}
+
+	ctx := context.Background()
+	userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(userRepo, otpRepo, cfg, WithCodeGenerator(fixedCodeGenerator{code: "123456"}))
+
+	if _, err := authService.GenerateOTP(ctx, "+442071234567"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The national form of the same number must find the OTP stored under E.164
+	response, err := authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: "020 7123 4567", Code: "123456"})
+	if err != nil {
+		t.Fatalf("Expected national-format verify to succeed, got %v", err)
+	}
+	if response.User.PhoneNumber != "+442071234567" {
+		t.Errorf("Expected user stored under E.164 number, got %q", response.User.PhoneNumber)
+	}
+
+	if _, err := authService.GenerateOTP(ctx, "not-a-number"); !errors.Is(err, ErrInvalidPhoneNumber) {
+		t.Errorf("Expected ErrInvalidPhoneNumber, got %v", err)
+	}
+
+	// Phone changes and recovery phones read numbers the same way
+	userID := response.User.ID
+	if _, err := authService.RequestPhoneChange(ctx, userID, models.PhoneChangeRequest{NewPhoneNumber: "020 7946 0000"}); err != nil {
+		t.Fatalf("Expected national-format phone change request to succeed, got %v", err)
+	}
+	changed, err := authService.ConfirmPhoneChange(ctx, userID, models.PhoneChangeConfirmation{NewPhoneNumber: "+44 20 7946 0000", Code: "123456"})
+	if err != nil {
+		t.Fatalf("Expected phone change confirmation to succeed, got %v", err)
+	}
+	if changed.User.PhoneNumber != "+442079460000" {
+		t.Errorf("Expected the new number stored in E.164, got %q", changed.User.PhoneNumber)
+	}
+	if _, err := authService.RequestPhoneChange(ctx, userID, models.PhoneChangeRequest{NewPhoneNumber: "not-a-number"}); !errors.Is(err, ErrInvalidNewPhoneNumber) {
+		t.Errorf("Expected ErrInvalidNewPhoneNumber, got %v", err)
+	}
+
+	if _, err := authService.RequestRecoveryPhone(ctx, userID, models.RecoveryPhoneRequest{RecoveryPhone: "020 7123 4567"}); err != nil {
+		t.Fatalf("Expected national-format recovery phone request to succeed, got %v", err)
+	}
+	recovery, err := authService.ConfirmRecoveryPhone(ctx, userID, models.RecoveryPhoneConfirmation{RecoveryPhone: "0044 20 7123 4567", Code: "123456"})
+	if err != nil {
+		t.Fatalf("Expected recovery phone confirmation to succeed, got %v", err)
+	}
+	if recovery.RecoveryPhone == nil || *recovery.RecoveryPhone != "+442071234567" {
+		t.Errorf("Expected the recovery phone stored in E.164, got %v", recovery.RecoveryPhone)
+	}
+}
+
+func TestAuthService_TokenSubject(t *testing.T) {
+	tests := []struct {
+		subjectClaim string
+		want         func(user *models.User) string
+	}{
+		{"", func(user *models.User) string { return user.ID }},
+		{config.JWTSubjectUserID, func(user *models.User) string { return user.ID }},
+		{config.JWTSubjectPhoneNumber, func(user *models.User) string { return user.PhoneNumber }},
+	}
+
+	for _, tt := range tests {
+		cfg := &config.Config{
+			JWT: config.JWTConfig{
+				Secret:       "test-secret",
+				ExpiryHours:  24,
+				SubjectClaim: tt.subjectClaim,
+			},
+		}
+		authService := NewAuthService(&mockUserRepository{users: make(map[string]*models.User)}, &mockOTPRepository{otps: make(map[string]*models.OTP)}, cfg).(*authService)
+
+		user := models.NewUser("+1234567890")
+		token, _, err := authService.generateJWT(user)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		claims, err := authService.ValidateToken(token)
+		if err != nil {
+			t.Fatalf("Expected valid token, got %v", err)
+		}
+
+		subject, _ := claims.GetSubject()
+		if subject != tt.want(user) {
+			t.Errorf("SubjectClaim %q: expected sub %q, got %q", tt.subjectClaim, tt.want(user), subject)
+		}
+		if claims.UserID != user.ID {
+			t.Errorf("SubjectClaim %q: expected user_id claim %q, got %q", tt.subjectClaim, user.ID, claims.UserID)
+		}
+	}
+}
+
+func TestAuthService_VerifyOTP_VerifyOnly(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+		Auth: config.AuthConfig{
+			Mode:                   config.AuthModeVerifyOnly,
+			VerifyOnlyTokenMinutes: 5,
+		},
+	}
+
+	userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(userRepo, otpRepo, cfg)
+
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+	otpRepo.otps[phoneNumber] = models.NewOTP(phoneNumber, "123456", 2)
+
+	response, err := authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: phoneNumber, Code: "123456"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.User != nil {
+		t.Errorf("Expected no user in the response, got %+v", response.User)
+	}
+	if len(userRepo.users) != 0 {
+		t.Errorf("Expected no user to be created, got %d", len(userRepo.users))
+	}
+	if time.Until(response.ExpiresAt) > 5*time.Minute {
+		t.Errorf("Expected a token valid for at most 5 minutes, expires at %v", response.ExpiresAt)
+	}
+
+	claims, err := authService.ValidateToken(response.Token)
+	if err != nil {
+		t.Fatalf("Expected valid token, got %v", err)
+	}
+	if subject, _ := claims.GetSubject(); subject != phoneNumber {
+		t.Errorf("Expected sub %q, got %q", phoneNumber, subject)
+	}
+	if claims.PhoneNumber != phoneNumber || claims.UserID != "" {
+		t.Errorf("Expected only the phone number claim, got phone %q user %q", claims.PhoneNumber, claims.UserID)
+	}
+	if err := authService.CheckAccountStatus(ctx, claims.UserID); err != nil {
+		t.Errorf("Expected verify-only tokens to pass the account check, got %v", err)
+	}
+	if claims.Audience != models.VerifyOnlyAudience {
+		t.Errorf("Expected aud %q, got %q", models.VerifyOnlyAudience, claims.Audience)
+	}
+}
+
+func TestAuthService_ValidateToken_RejectsOtherAuthMode(t *testing.T) {
+	fullCfg := &config.Config{JWT: config.JWTConfig{Secret: "test-secret", ExpiryHours: 24}}
+	verifyOnlyCfg := &config.Config{
+		JWT:  fullCfg.JWT,
+		Auth: config.AuthConfig{Mode: config.AuthModeVerifyOnly, VerifyOnlyTokenMinutes: 5},
+	}
+	full := NewAuthService(&mockUserRepository{users: make(map[string]*models.User)}, &mockOTPRepository{}, fullCfg).(*authService)
+	verifyOnly := NewAuthService(&mockUserRepository{users: make(map[string]*models.User)}, &mockOTPRepository{}, verifyOnlyCfg).(*authService)
+
+	userToken, _, err := full.generateJWT(models.NewUser("+1234567890"))
+	if err != nil {
+		t.Fatalf("generateJWT returned error: %v", err)
+	}
+	phoneToken, _, err := verifyOnly.signPhoneJWT("+1234567890")
+	if err != nil {
+		t.Fatalf("signPhoneJWT returned error: %v", err)
+	}
+
+	// Both share a secret, as they do across a change of AUTH_MODE
+	if _, err := full.ValidateToken(userToken); err != nil {
+		t.Errorf("Expected the user token to validate in full mode, got %v", err)
+	}
+	if _, err := verifyOnly.ValidateToken(phoneToken); err != nil {
+		t.Errorf("Expected the phone token to validate in verify-only mode, got %v", err)
+	}
+	if _, err := verifyOnly.ValidateToken(userToken); err == nil {
+		t.Error("Expected a user token left from full mode to be rejected in verify-only mode")
+	}
+	if _, err := full.ValidateToken(phoneToken); err == nil {
+		t.Error("Expected a verify-only token to be rejected in full mode")
+	}
+}
+
+func TestAuthService_GenerateOTP_RequireExistingUser(t *testing.T) {
+	ctx := context.Background()
+	known := models.NewUser("+12025550100")
+	unknown := "+12025550101"
+
+	for _, hide := range []bool{false, true} {
+		cfg := &config.Config{
+			JWT: config.JWTConfig{Secret: "test-secret", ExpiryHours: 24},
+			OTP: config.OTPConfig{
+				ExpiryMinutes:       2,
+				Length:              6,
+				RequireExistingUser: true,
+				HideUnknownUsers:    hide,
+			},
+			RateLimit: config.RateLimitConfig{MaxRequests: 3, WindowMinutes: 10},
+		}
+		userRepo := &mockUserRepository{users: map[string]*models.User{known.ID: known}}
+		otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+		authService := NewAuthService(userRepo, otpRepo, cfg, WithCodeGenerator(fixedCodeGenerator{code: "123456"}))
+
+		if _, err := authService.GenerateOTP(ctx, known.PhoneNumber); err != nil {
+			t.Fatalf("hide=%v: expected a code for an existing user, got %v", hide, err)
+		}
+
+		response, err := authService.GenerateOTP(ctx, unknown)
+		if !hide {
+			if !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("Expected ErrUserNotFound for an unknown number, got %v", err)
+			}
+			if otpRepo.otps[unknown] != nil {
+				t.Error("Expected no OTP to be saved for an unknown number")
+			}
+			continue
+		}
+
+		// Hidden: the response looks like a sent code and the number is
+		// rate limited like any other, but the code can't sign anyone in
+		if err != nil || response.RequestID == "" {
+			t.Fatalf("Expected a success response for an unknown number, got %+v, %v", response, err)
+		}
+		if otpRepo.otps[unknown] == nil {
+			t.Error("Expected the unknown number's OTP to be saved for rate limiting")
+		}
+		if _, err := authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: unknown, Code: "123456"}); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("Expected ErrUserNotFound verifying an unknown number, got %v", err)
+		}
+		if len(userRepo.users) != 1 {
+			t.Errorf("Expected no user to be created, got %d users", len(userRepo.users))
+		}
+	}
+}
+
+func TestAuthService_RequireExistingUser_AccountFlows(t *testing.T) {
+	ctx := context.Background()
+
+	for _, hide := range []bool{false, true} {
+		cfg := &config.Config{
+			JWT: config.JWTConfig{Secret: "test-secret", ExpiryHours: 24},
+			OTP: config.OTPConfig{
+				ExpiryMinutes:       2,
+				Length:              6,
+				DebugPrint:          true,
+				RequireExistingUser: true,
+				HideUnknownUsers:    hide,
+			},
+			RateLimit: config.RateLimitConfig{MaxRequests: 10, WindowMinutes: 10},
+		}
+		user := models.NewUser("+12025550100")
+		user.SetRecoveryPhone("+12025550102")
+		userRepo := &mockUserRepository{users: map[string]*models.User{user.ID: user}}
+		otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+		var console bytes.Buffer
+		authService := NewAuthService(userRepo, otpRepo, cfg, WithCodeGenerator(fixedCodeGenerator{code: "123456"}), WithConsole(&console))
+
+		// None of these numbers is a user's primary phone, yet each is sent
+		// a code
+		flows := []struct {
+			name string
+			send func() error
+		}{
+			{"phone change", func() error {
+				_, err := authService.RequestPhoneChange(ctx, user.ID, models.PhoneChangeRequest{NewPhoneNumber: "+12025550101"})
+				return err
+			}},
+			{"recovery phone", func() error {
+				_, err := authService.RequestRecoveryPhone(ctx, user.ID, models.RecoveryPhoneRequest{RecoveryPhone: "+12025550103"})
+				return err
+			}},
+			{"account recovery", func() error {
+				_, err := authService.RequestAccountRecovery(ctx, models.RecoveryPhoneRequest{RecoveryPhone: "+12025550102"})
+				return err
+			}},
+		}
+		for _, flow := range flows {
+			console.Reset()
+			if err := flow.send(); err != nil {
+				t.Errorf("hide=%v, %s: expected no error, got %v", hide, flow.name, err)
+			}
+			if !strings.Contains(console.String(), "123456") {
+				t.Errorf("hide=%v, %s: expected the code to be delivered, got %q", hide, flow.name, console.String())
+			}
+		}
+	}
+}
+
+func TestAuthService_ResetRateLimits(t *testing.T) {
+	cfg := &config.Config{
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   3,
+			WindowMinutes: 10,
+			MaxPerDay:     1,
+		},
+	}
+
+	ctx := context.Background()
+	user := models.NewUser("+1234567890")
+	recoveryPhone := "+1987654321"
+	user.RecoveryPhone = &recoveryPhone
+	userRepo := &mockUserRepository{users: map[string]*models.User{user.ID: user}}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	backoff := NewVerifyBackoff(time.Second, time.Second, time.Minute)
+	authService := NewAuthService(userRepo, otpRepo, cfg, WithVerifyBackoff(backoff))
+
+	for _, phoneNumber := range []string{user.PhoneNumber, recoveryPhone} {
+		if _, err := authService.GenerateOTP(ctx, phoneNumber); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := authService.GenerateOTP(ctx, phoneNumber); !errors.Is(err, ErrDailyLimitExceeded) {
+			t.Fatalf("Expected ErrDailyLimitExceeded before the reset, got %v", err)
+		}
+		backoff.Failure(phoneNumber)
+		backoff.Failure(phoneNumber)
+	}
+
+	reset, err := authService.ResetRateLimits(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if reset.OTPRequestsCleared != 2 || !reset.VerifyBackoffCleared {
+		t.Errorf("Expected 2 OTP requests and the backoff cleared, got %+v", reset)
+	}
+	if reset.PhoneNumber != models.MaskPhone(user.PhoneNumber) || reset.RecoveryPhone != models.MaskPhone(recoveryPhone) {
+		t.Errorf("Expected both numbers masked, got %q and %q", reset.PhoneNumber, reset.RecoveryPhone)
+	}
+
+	// The user can request a code again on either number, and a wrong code
+	// starts the backoff over
+	for _, phoneNumber := range []string{user.PhoneNumber, recoveryPhone} {
+		if _, err := authService.GenerateOTP(ctx, phoneNumber); err != nil {
+			t.Errorf("Expected a new OTP for %s after the reset, got %v", phoneNumber, err)
+		}
+		if delay := backoff.Failure(phoneNumber); delay != 0 {
+			t.Errorf("Expected no delay for %s after the reset, got %v", phoneNumber, delay)
+		}
+	}
+
+	if _, err := authService.ResetRateLimits(ctx, "missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for unknown user, got %v", err)
+	}
+}
+
+func TestAuthService_VerifyOTP_MultiUse(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+			MaxUses:       2,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   3,
+			WindowMinutes: 10,
+		},
+	}
+
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+	userRepo := &mockUserRepository{users: make(map[string]*models.User)}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(userRepo, otpRepo, cfg, WithCodeGenerator(fixedCodeGenerator{code: "123456"}))
+
+	if _, err := authService.GenerateOTP(ctx, phoneNumber); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	verification := models.OTPVerification{PhoneNumber: phoneNumber, Code: "123456"}
+
+	// The first use leaves the code pending with one use left
+	if _, err := authService.VerifyOTP(ctx, verification); err != nil {
+		t.Fatalf("Expected first use to succeed, got %v", err)
+	}
+	if otp := otpRepo.otps[phoneNumber]; otp.Used || otp.UsesRemaining != 1 {
+		t.Errorf("Expected 1 use remaining, got used=%v remaining=%d", otp.Used, otp.UsesRemaining)
+	}
+
+	// The second use exhausts it
+	if _, err := authService.VerifyOTP(ctx, verification); err != nil {
+		t.Fatalf("Expected second use to succeed, got %v", err)
+	}
+	if otp := otpRepo.otps[phoneNumber]; !otp.Used || otp.UsesRemaining != 0 {
+		t.Errorf("Expected the code to be used up, got used=%v remaining=%d", otp.Used, otp.UsesRemaining)
+	}
+
+	if _, err := authService.VerifyOTP(ctx, verification); !errors.Is(err, ErrOTPAlreadyUsed) {
+		t.Errorf("Expected ErrOTPAlreadyUsed after the last use, got %v", err)
+	}
+}
+
+func TestAuthService_MultiUseCodesOnlyVerifySignIn(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+			MaxUses:       2,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   10,
+			WindowMinutes: 10,
+		},
+	}
+
+	ctx := context.Background()
+	recoveryPhone := "+1987654321"
+	user := models.NewUser("+1234567890")
+	user.RecoveryPhone = &recoveryPhone
+	userRepo := &mockUserRepository{users: map[string]*models.User{user.ID: user}}
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(userRepo, otpRepo, cfg, WithCodeGenerator(fixedCodeGenerator{code: "424242"}))
+
+	// Codes sent for a phone change or recovery allow a single use
+	if _, err := authService.RequestPhoneChange(ctx, user.ID, models.PhoneChangeRequest{NewPhoneNumber: "+1555000111"}); err != nil {
+		t.Fatalf("Expected no error requesting phone change, got %v", err)
+	}
+	if otp := otpRepo.otps["+1555000111"]; otp.UsesRemaining != 1 {
+		t.Errorf("Expected a single-use phone change code, got %d uses", otp.UsesRemaining)
+	}
+
+	// A multi-use sign-in code sent to the recovery phone is used up by
+	// recovering the account with it
+	if _, err := authService.GenerateOTP(ctx, recoveryPhone); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	confirmation := models.AccountRecoveryConfirmation{RecoveryPhone: recoveryPhone, NewPhoneNumber: recoveryPhone, Code: "424242"}
+	if _, err := authService.RecoverAccount(ctx, confirmation); err != nil {
+		t.Fatalf("Expected no error recovering account, got %v", err)
+	}
+	if otp := otpRepo.otps[recoveryPhone]; !otp.Used {
+		t.Errorf("Expected recovery to use up the code, got %d uses remaining", otp.UsesRemaining)
+	}
+	if _, err := authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: recoveryPhone, Code: "424242"}); !errors.Is(err, ErrOTPAlreadyUsed) {
+		t.Errorf("Expected ErrOTPAlreadyUsed after recovery, got %v", err)
+	}
+}
+
+func TestAuthService_DeleteExpiredOTPs(t *testing.T) {
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{WindowMinutes: 10},
+	}
+
+	now := time.Now()
+	otpRepo := &mockOTPRepository{otps: map[string]*models.OTP{
+		// Expired long enough ago that it no longer counts toward any limit
+		"+1111111111": {PhoneNumber: "+1111111111", CreatedAt: now.Add(-48 * time.Hour), ExpiresAt: now.Add(-47 * time.Hour)},
+		// Expired, but still counts toward the daily limit
+		"+2222222222": {PhoneNumber: "+2222222222", CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-55 * time.Minute)},
+		"+3333333333": {PhoneNumber: "+3333333333", CreatedAt: now, ExpiresAt: now.Add(5 * time.Minute)},
+	}}
+	authService := NewAuthService(&mockUserRepository{users: make(map[string]*models.User)}, otpRepo, cfg)
+
+	cleanup, err := authService.DeleteExpiredOTPs(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cleanup.Deleted != 1 {
+		t.Errorf("Expected 1 OTP deleted, got %d", cleanup.Deleted)
+	}
+	if _, ok := otpRepo.otps["+1111111111"]; ok {
+		t.Error("Expected the old expired OTP to be deleted")
+	}
+	if len(otpRepo.otps) != 2 {
+		t.Errorf("Expected the recent OTPs to be kept, got %d left", len(otpRepo.otps))
+	}
+
+	cleanup, err = authService.DeleteExpiredOTPs(context.Background())
+	if err != nil || cleanup.Deleted != 0 {
+		t.Errorf("Expected a repeated cleanup to delete nothing, got %+v, %v", cleanup, err)
+	}
+}
+
+func TestAuthService_GenerateOTP_Console(t *testing.T) {
+	cfg := &config.Config{
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+			DebugPrint:    true,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   3,
+			WindowMinutes: 10,
+		},
+	}
+
+	var console bytes.Buffer
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(&mockUserRepository{users: make(map[string]*models.User)}, otpRepo, cfg,
+		WithCodeGenerator(fixedCodeGenerator{code: "424242"}), WithConsole(&console))
+
+	var response *models.OTPResponse
+	stdout := captureStdout(t, func() {
+		var err error
+		if response, err = authService.GenerateOTP(context.Background(), "+1234567890"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+
+	output := console.String()
+	if !strings.Contains(output, "424242") || !strings.Contains(output, response.RequestID) {
+		t.Errorf("Expected the code and request ID on the console, got %q", output)
+	}
+	if strings.Contains(output, "+1234567890") {
+		t.Errorf("Expected phone number to be masked, got %q", output)
+	}
+	if stdout != "" {
+		t.Errorf("Expected nothing on stdout, got %q", stdout)
+	}
+}
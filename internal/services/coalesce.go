@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"otp/internal/models"
+)
+
+// generateCall is an OTP generation in flight that others can wait on
+type generateCall struct {
+	done     chan struct{}
+	response *models.OTPResponse
+	err      error
+}
+
+// generateGroup lets concurrent generations for the same phone number share
+// one result, in the manner of golang.org/x/sync/singleflight
+type generateGroup struct {
+	mu    sync.Mutex
+	calls map[string]*generateCall
+}
+
+func newGenerateGroup() *generateGroup {
+	return &generateGroup{calls: make(map[string]*generateCall)}
+}
+
+// do runs fn unless a call for key is already in flight, in which case it
+// waits for that call and returns its result. fn runs apart from every
+// caller, the first included, so a caller whose ctx ends stops waiting with
+// ErrRequestCancelled without cancelling the call for the others. Each
+// caller gets its own copy of the response.
+func (g *generateGroup) do(ctx context.Context, key string, fn func() (*models.OTPResponse, error)) (*models.OTPResponse, error) {
+	g.mu.Lock()
+	call, ok := g.calls[key]
+	if !ok {
+		call = &generateCall{done: make(chan struct{})}
+		g.calls[key] = call
+		go func() {
+			defer close(call.done)
+			call.response, call.err = fn()
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return copyOTPResponse(call.response), call.err
+	case <-ctx.Done():
+		return nil, checkContext(ctx)
+	}
+}
+
+func copyOTPResponse(response *models.OTPResponse) *models.OTPResponse {
+	if response == nil {
+		return nil
+	}
+	copied := *response
+	return &copied
+}
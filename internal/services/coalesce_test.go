@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"otp/internal/config"
+	"otp/internal/models"
+	"otp/internal/ratelimit"
+)
+
+// waitingContext sends on waiting the first time a caller waits on it
+type waitingContext struct {
+	context.Context
+	once    sync.Once
+	waiting chan<- struct{}
+}
+
+func (c *waitingContext) Done() <-chan struct{} {
+	c.once.Do(func() { c.waiting <- struct{}{} })
+	return c.Context.Done()
+}
+
+// awaitWaiting waits until n callers are waiting on a generation
+func awaitWaiting(t *testing.T, waiting <-chan struct{}, n int) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < n; i++ {
+		select {
+		case <-waiting:
+		case <-timeout:
+			t.Fatalf("Expected %d callers waiting on the generation, got %d", n, i)
+		}
+	}
+}
+
+func newCoalescingTestService(opts ...AuthServiceOption) (*authService, *blockingOTPRepository) {
+	cfg := &config.Config{
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   3,
+			WindowMinutes: 10,
+		},
+	}
+	otpRepo := &blockingOTPRepository{
+		mockOTPRepository: &mockOTPRepository{otps: make(map[string]*models.OTP)},
+		started:           make(chan struct{}, 10),
+		release:           make(chan struct{}),
+	}
+	opts = append(opts, WithGenerateCoalescing())
+	return NewAuthService(&mockUserRepository{users: make(map[string]*models.User)}, otpRepo, cfg, opts...).(*authService), otpRepo
+}
+
+func TestAuthService_GenerateOTP_Coalescing(t *testing.T) {
+	const callers = 10
+	phoneNumber := "+12025550100"
+	authService, otpRepo := newCoalescingTestService()
+
+	type result struct {
+		response *models.OTPResponse
+		err      error
+	}
+	results := make(chan result, callers)
+	waiting := make(chan struct{}, callers)
+	generate := func() {
+		response, err := authService.GenerateOTP(&waitingContext{Context: context.Background(), waiting: waiting}, phoneNumber)
+		results <- result{response, err}
+	}
+
+	// The first generation blocks in Create; every other one joins it
+	go generate()
+	<-otpRepo.started
+	for i := 1; i < callers; i++ {
+		go generate()
+	}
+	awaitWaiting(t, waiting, callers)
+
+	close(otpRepo.release)
+	var requestID string
+	for i := 0; i < callers; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("Expected no error, got %v", r.err)
+		}
+		if requestID == "" {
+			requestID = r.response.RequestID
+		}
+		if r.response.RequestID != requestID {
+			t.Errorf("Expected every caller to share request %s, got %s", requestID, r.response.RequestID)
+		}
+	}
+
+	if created := len(otpRepo.started); created != 0 {
+		t.Errorf("Expected one OTP to be created, got %d", created+1)
+	}
+
+	// Generations after the burst are not coalesced
+	go generate()
+	<-otpRepo.started
+	if r := <-results; r.err != nil || r.response.RequestID == requestID {
+		t.Errorf("Expected a new OTP after the burst, got %+v, %v", r.response, r.err)
+	}
+}
+
+func TestAuthService_GenerateOTP_CoalescingKeepsExemptCallersApart(t *testing.T) {
+	exemptions, err := ratelimit.NewExemptions(nil, []string{"203.0.113.7"})
+	if err != nil {
+		t.Fatalf("NewExemptions returned error: %v", err)
+	}
+	authService, otpRepo := newCoalescingTestService(WithRateLimitExemptions(exemptions))
+	phoneNumber := "+12025550100"
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := authService.GenerateOTP(ContextWithClientIP(context.Background(), "198.51.100.1"), phoneNumber)
+		errs <- err
+	}()
+	<-otpRepo.started
+
+	// An exempt caller gets a generation of its own rather than the
+	// rate limited one in flight
+	go func() {
+		_, err := authService.GenerateOTP(ContextWithClientIP(context.Background(), "203.0.113.7"), phoneNumber)
+		errs <- err
+	}()
+	select {
+	case <-otpRepo.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the exempt caller to start its own generation")
+	}
+
+	close(otpRepo.release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	}
+}
+
+func TestAuthService_GenerateOTP_CoalescingSurvivesFirstCallerCancelling(t *testing.T) {
+	authService, otpRepo := newCoalescingTestService()
+	phoneNumber := "+12025550100"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := authService.GenerateOTP(ctx, phoneNumber)
+		first <- err
+	}()
+	<-otpRepo.started
+
+	waiting := make(chan struct{}, 1)
+	joined := make(chan error, 1)
+	go func() {
+		response, err := authService.GenerateOTP(&waitingContext{Context: context.Background(), waiting: waiting}, phoneNumber)
+		if err == nil && response.RequestID == "" {
+			err = errors.New("no request ID")
+		}
+		joined <- err
+	}()
+	awaitWaiting(t, waiting, 1)
+
+	// The first caller gives up without failing the one that joined it
+	cancel()
+	if err := <-first; !errors.Is(err, ErrRequestCancelled) {
+		t.Errorf("Expected ErrRequestCancelled for the first caller, got %v", err)
+	}
+	close(otpRepo.release)
+	if err := <-joined; err != nil {
+		t.Errorf("Expected the joined caller to get the OTP, got %v", err)
+	}
+	if created := len(otpRepo.started); created != 0 {
+		t.Errorf("Expected one OTP to be created, got %d", created+1)
+	}
+}
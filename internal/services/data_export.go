@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"otp/internal/models"
+	"otp/internal/repository"
+)
+
+// maxExportAuditEvents bounds the audit events gathered for each side
+// (actor and target) of an export
+const maxExportAuditEvents = 1000
+
+// DataExporter assembles everything stored about a user for data-subject
+// access requests
+type DataExporter interface {
+	ExportUser(ctx context.Context, id string) (*models.UserDataExport, error)
+}
+
+type dataExporter struct {
+	userRepo    repository.UserRepository
+	otpRepo     repository.OTPRepository
+	auditLogger AuditLogger
+}
+
+func NewDataExporter(userRepo repository.UserRepository, otpRepo repository.OTPRepository, auditLogger AuditLogger) DataExporter {
+	return &dataExporter{
+		userRepo:    userRepo,
+		otpRepo:     otpRepo,
+		auditLogger: auditLogger,
+	}
+}
+
+func (e *dataExporter) ExportUser(ctx context.Context, id string) (*models.UserDataExport, error) {
+	user, err := e.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	export := &models.UserDataExport{
+		ExportedAt:  time.Now(),
+		User:        *user,
+		OTPs:        []models.OTPRecord{},
+		AuditEvents: []models.AuditEvent{},
+	}
+
+	phoneNumbers := []string{user.PhoneNumber}
+	if user.RecoveryPhone != nil {
+		phoneNumbers = append(phoneNumbers, *user.RecoveryPhone)
+	}
+	for _, phoneNumber := range phoneNumbers {
+		otps, err := e.otpRepo.ListByPhoneNumber(ctx, phoneNumber)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get OTPs: %w", err)
+		}
+		for _, otp := range otps {
+			export.OTPs = append(export.OTPs, otp.ToRecord())
+		}
+	}
+	sort.SliceStable(export.OTPs, func(i, j int) bool {
+		return export.OTPs[i].CreatedAt.After(export.OTPs[j].CreatedAt)
+	})
+
+	// An event can name the user as both actor and target; list it once
+	seen := make(map[int64]bool)
+	for _, query := range []models.AuditEventQuery{
+		{ActorID: user.ID, Limit: maxExportAuditEvents},
+		{Target: user.ID, Limit: maxExportAuditEvents},
+	} {
+		events, err := e.auditLogger.List(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get audit events: %w", err)
+		}
+		for _, event := range events {
+			if !seen[event.ID] {
+				seen[event.ID] = true
+				export.AuditEvents = append(export.AuditEvents, event)
+			}
+		}
+	}
+	sort.SliceStable(export.AuditEvents, func(i, j int) bool {
+		return export.AuditEvents[i].ID > export.AuditEvents[j].ID
+	})
+
+	return export, nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"otp/internal/models"
+)
+
+type stubAuditLogger struct {
+	events []models.AuditEvent
+}
+
+func (l *stubAuditLogger) Record(ctx context.Context, actor, action, target string, metadata map[string]interface{}) error {
+	return nil
+}
+
+func (l *stubAuditLogger) List(ctx context.Context, query models.AuditEventQuery) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	for _, event := range l.events {
+		if (query.ActorID == "" || event.ActorID == query.ActorID) && (query.Target == "" || event.Target == query.Target) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (l *stubAuditLogger) ListPage(ctx context.Context, query models.AuditEventQuery) (*models.AuditEventListResponse, error) {
+	events, _ := l.List(ctx, query)
+	return &models.AuditEventListResponse{Events: events, Total: len(events), Page: query.Page, PageSize: query.PageSize, TotalPages: query.TotalPages(len(events))}, nil
+}
+
+func (l *stubAuditLogger) Verify(ctx context.Context) (*models.AuditChainVerification, error) {
+	return &models.AuditChainVerification{Intact: true}, nil
+}
+
+func TestDataExporter_ExportUser(t *testing.T) {
+	ctx := context.Background()
+	user := models.NewUser("+1234567890")
+	recoveryPhone := "+1987654321"
+	user.SetRecoveryPhone(recoveryPhone)
+
+	older := models.NewOTP(user.PhoneNumber, "111111", 2)
+	older.CreatedAt = time.Now().Add(-time.Hour)
+	newer := models.NewOTP(recoveryPhone, "222222", 2)
+
+	userRepo := &mockUserRepository{users: map[string]*models.User{user.ID: user}}
+	otpRepo := &mockOTPRepository{otps: map[string]*models.OTP{user.PhoneNumber: older, recoveryPhone: newer}}
+	auditLogger := &stubAuditLogger{events: []models.AuditEvent{
+		{ID: 1, ActorID: "admin", Action: AuditActionUserStatusUpdate, Target: user.ID},
+		{ID: 2, ActorID: user.ID, Action: AuditActionUserLookup, Target: user.ID},
+		{ID: 3, ActorID: "admin", Action: AuditActionUserDelete, Target: "someone-else"},
+	}}
+	exporter := NewDataExporter(userRepo, otpRepo, auditLogger)
+
+	export, err := exporter.ExportUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if export.User.ID != user.ID {
+		t.Errorf("Expected user %s, got %s", user.ID, export.User.ID)
+	}
+	if len(export.OTPs) != 2 || export.OTPs[0].PhoneNumber != recoveryPhone || export.OTPs[1].PhoneNumber != user.PhoneNumber {
+		t.Errorf("Expected OTPs for both numbers, newest first, got %+v", export.OTPs)
+	}
+	if len(export.AuditEvents) != 2 || export.AuditEvents[0].ID != 2 || export.AuditEvents[1].ID != 1 {
+		t.Errorf("Expected the user's two audit events once each, newest first, got %+v", export.AuditEvents)
+	}
+
+	encoded, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("Failed to encode export: %v", err)
+	}
+	for _, code := range []string{"111111", "222222"} {
+		if strings.Contains(string(encoded), code) {
+			t.Errorf("Expected OTP code %s to be left out of the export", code)
+		}
+	}
+
+	if _, err := exporter.ExportUser(ctx, "missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
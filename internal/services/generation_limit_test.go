@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"otp/internal/config"
+	"otp/internal/models"
+)
+
+// blockingOTPRepository holds every Create until release is closed, so
+// generations stay in flight for as long as a test needs
+type blockingOTPRepository struct {
+	*mockOTPRepository
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingOTPRepository) Create(ctx context.Context, otp *models.OTP) error {
+	r.started <- struct{}{}
+	<-r.release
+	return nil
+}
+
+func TestAuthService_GenerateOTP_MaxConcurrentGenerations(t *testing.T) {
+	cfg := &config.Config{
+		OTP: config.OTPConfig{
+			ExpiryMinutes: 2,
+			Length:        6,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   3,
+			WindowMinutes: 10,
+		},
+	}
+
+	const limit, callers = 3, 8
+	otpRepo := &blockingOTPRepository{
+		mockOTPRepository: &mockOTPRepository{otps: make(map[string]*models.OTP)},
+		started:           make(chan struct{}, callers),
+		release:           make(chan struct{}),
+	}
+	authService := NewAuthService(&mockUserRepository{users: make(map[string]*models.User)}, otpRepo, cfg, WithMaxConcurrentGenerations(limit))
+
+	results := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		go func(i int) {
+			_, err := authService.GenerateOTP(context.Background(), fmt.Sprintf("+120255501%02d", i))
+			results <- err
+		}(i)
+	}
+
+	// The generations that got a slot block in Create, so every result
+	// before the release comes from a rejected one
+	for i := 0; i < callers-limit; i++ {
+		if err := <-results; !errors.Is(err, ErrServerBusy) {
+			t.Errorf("Expected ErrServerBusy for a generation over the limit, got %v", err)
+		}
+	}
+	for i := 0; i < limit; i++ {
+		<-otpRepo.started
+	}
+
+	close(otpRepo.release)
+	for i := 0; i < limit; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("Expected generations within the limit to succeed, got %v", err)
+		}
+	}
+
+	// Slots are returned once generations finish
+	if _, err := authService.GenerateOTP(context.Background(), "+12025550199"); err != nil {
+		t.Errorf("Expected a generation after the others finished to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// User ID formats accepted by NewIDGenerator
+const (
+	IDFormatUUIDv4 = "uuidv4"
+	IDFormatUUIDv7 = "uuidv7"
+)
+
+// IDGenerator produces the IDs of new users. The users.id column is a UUID,
+// so generators must return UUIDs.
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+// NewIDGenerator returns the generator for format: "uuidv4" (random, the
+// default) or "uuidv7" (time-ordered)
+func NewIDGenerator(format string) (IDGenerator, error) {
+	switch format {
+	case "", IDFormatUUIDv4:
+		return uuidV4Generator{}, nil
+	case IDFormatUUIDv7:
+		return NewUUIDv7Generator(), nil
+	default:
+		return nil, fmt.Errorf("unknown user ID format %q", format)
+	}
+}
+
+type uuidV4Generator struct{}
+
+func (uuidV4Generator) NewID() (string, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+type uuidV7Generator struct {
+	mu     sync.Mutex
+	lastMS int64
+	seq    uint16
+	now    func() time.Time
+}
+
+// NewUUIDv7Generator returns a generator of time-ordered UUIDv7s. New rows
+// land at the end of the primary key index instead of at random pages, and
+// IDs sort by creation time. IDs from one generator are strictly
+// increasing: within a millisecond the 12-bit rand_a field holds a counter.
+func NewUUIDv7Generator() IDGenerator {
+	return &uuidV7Generator{now: time.Now}
+}
+
+func (g *uuidV7Generator) NewID() (string, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+
+	g.mu.Lock()
+	ms := g.now().UnixMilli()
+	if ms > g.lastMS {
+		g.lastMS, g.seq = ms, 0
+	} else {
+		// Same millisecond, or the clock moved back: keep counting from the
+		// last ID, borrowing the next millisecond if the counter runs out
+		g.seq++
+		if g.seq > 0x0FFF {
+			g.lastMS, g.seq = g.lastMS+1, 0
+		}
+		ms = g.lastMS
+	}
+	seq := g.seq
+	g.mu.Unlock()
+
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+	id[6] = 0x70 | byte(seq>>8)
+	id[7] = byte(seq)
+	return id.String(), nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestUUIDv7Generator(t *testing.T) {
+	generator := NewUUIDv7Generator()
+
+	seen := make(map[string]bool)
+	previous := ""
+	for i := 0; i < 10000; i++ {
+		id, err := generator.NewID()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		parsed, err := uuid.Parse(id)
+		if err != nil || parsed.Version() != 7 {
+			t.Fatalf("Expected a UUIDv7, got %q (%v)", id, err)
+		}
+		if seen[id] {
+			t.Fatalf("Duplicate ID %s", id)
+		}
+		seen[id] = true
+		if id <= previous {
+			t.Fatalf("Expected IDs to increase, got %s after %s", id, previous)
+		}
+		previous = id
+	}
+}
+
+func TestUUIDv7Generator_ClockMovesBack(t *testing.T) {
+	now := time.Now()
+	generator := NewUUIDv7Generator().(*uuidV7Generator)
+	generator.now = func() time.Time { return now }
+
+	first, _ := generator.NewID()
+	now = now.Add(-time.Second)
+	second, _ := generator.NewID()
+	if second <= first {
+		t.Errorf("Expected IDs to keep increasing when the clock moves back, got %s after %s", second, first)
+	}
+}
+
+func TestNewIDGenerator(t *testing.T) {
+	for format, version := range map[string]uuid.Version{"": 4, IDFormatUUIDv4: 4, IDFormatUUIDv7: 7} {
+		generator, err := NewIDGenerator(format)
+		if err != nil {
+			t.Fatalf("Expected format %q to be accepted, got %v", format, err)
+		}
+		id, _ := generator.NewID()
+		if parsed, err := uuid.Parse(id); err != nil || parsed.Version() != version {
+			t.Errorf("Format %q: expected a version %d UUID, got %q", format, version, id)
+		}
+	}
+
+	if _, err := NewIDGenerator("ulid"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"otp/internal/models"
+)
+
+var (
+	ErrPhoneNumberTaken = errors.New("phone number is already registered to another account")
+	ErrSamePhoneNumber  = errors.New("new phone number must differ from the current one")
+	// ErrInvalidNewPhoneNumber is ErrInvalidPhoneNumber for the number a
+	// user is moving to, so it can be told apart from the recovery phone
+	ErrInvalidNewPhoneNumber = fmt.Errorf("new %w", ErrInvalidPhoneNumber)
+)
+
+// RequestPhoneChange sends an OTP to the new phone number so the user can
+// prove they control it before it replaces their current one.
+func (s *authService) RequestPhoneChange(ctx context.Context, userID string, request models.PhoneChangeRequest) (*models.OTPResponse, error) {
+	newPhoneNumber, err := s.canonicalNewPhoneNumber(request.NewPhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.checkPhoneChange(ctx, userID, newPhoneNumber); err != nil {
+		return nil, err
+	}
+
+	return s.sendOTP(ctx, newPhoneNumber, false)
+}
+
+// ConfirmPhoneChange verifies the OTP sent to the new phone number and moves
+// the user to it, returning a fresh token carrying the new number.
+func (s *authService) ConfirmPhoneChange(ctx context.Context, userID string, confirmation models.PhoneChangeConfirmation) (*models.AuthResponse, error) {
+	newPhoneNumber, err := s.canonicalNewPhoneNumber(confirmation.NewPhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.checkPhoneChange(ctx, userID, newPhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	otp, err := s.consumeOTP(ctx, newPhoneNumber, confirmation.Code, false)
+	if err != nil {
+		s.recordVerifyFailure(err)
+		return nil, err
+	}
+
+	user.ChangePhoneNumber(newPhoneNumber)
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	token, expiresAt, err := s.generateJWT(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	userResponse := user.ToResponse()
+	return &models.AuthResponse{
+		Token:     token,
+		User:      &userResponse,
+		ExpiresAt: expiresAt,
+		RequestID: otp.RequestID,
+	}, nil
+}
+
+// canonicalNewPhoneNumber is canonicalPhoneNumber for the number a user is
+// moving to
+func (s *authService) canonicalNewPhoneNumber(phoneNumber string) (string, error) {
+	canonical, err := s.canonicalPhoneNumber(phoneNumber)
+	if err != nil {
+		return "", ErrInvalidNewPhoneNumber
+	}
+	return canonical, nil
+}
+
+// checkPhoneChange returns the user if they may move to newPhoneNumber.
+func (s *authService) checkPhoneChange(ctx context.Context, userID, newPhoneNumber string) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if user.PhoneNumber == newPhoneNumber {
+		return nil, ErrSamePhoneNumber
+	}
+
+	existing, err := s.userRepo.GetByPhoneNumber(ctx, newPhoneNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up phone number: %w", err)
+	}
+	if existing != nil {
+		return nil, ErrPhoneNumberTaken
+	}
+
+	return user, nil
+}
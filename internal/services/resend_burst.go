@@ -0,0 +1,85 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// ResendBurst counts the OTPs a phone number has requested in quick
+// succession, so a few resends can skip the resend cooldown when the first
+// SMS is slow to arrive.
+type ResendBurst interface {
+	// Sent records an OTP sent to the phone number
+	Sent(phoneNumber string)
+	// Count returns how many OTPs the phone number has been sent in its
+	// current burst
+	Count(phoneNumber string) int
+	// Reset ends the phone number's burst after a successful verify
+	Reset(phoneNumber string)
+}
+
+type burstEntry struct {
+	sent     int
+	lastSeen time.Time
+}
+
+type memoryResendBurst struct {
+	mu        sync.Mutex
+	quiet     time.Duration
+	entries   map[string]*burstEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewResendBurst returns an in-process ResendBurst. A phone number's burst
+// ends once it has requested no OTP for quiet.
+func NewResendBurst(quiet time.Duration) ResendBurst {
+	return &memoryResendBurst{
+		quiet:     quiet,
+		entries:   make(map[string]*burstEntry),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (b *memoryResendBurst) Sent(phoneNumber string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	// Periodically drop numbers that have gone quiet so the map doesn't grow forever
+	if now.Sub(b.lastSweep) >= b.quiet {
+		for key, entry := range b.entries {
+			if now.Sub(entry.lastSeen) >= b.quiet {
+				delete(b.entries, key)
+			}
+		}
+		b.lastSweep = now
+	}
+
+	entry, exists := b.entries[phoneNumber]
+	if !exists || now.Sub(entry.lastSeen) >= b.quiet {
+		entry = &burstEntry{}
+		b.entries[phoneNumber] = entry
+	}
+	entry.sent++
+	entry.lastSeen = now
+}
+
+func (b *memoryResendBurst) Count(phoneNumber string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, exists := b.entries[phoneNumber]
+	if !exists || b.now().Sub(entry.lastSeen) >= b.quiet {
+		return 0
+	}
+	return entry.sent
+}
+
+func (b *memoryResendBurst) Reset(phoneNumber string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, phoneNumber)
+}
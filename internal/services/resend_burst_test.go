@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"otp/internal/config"
+	"otp/internal/models"
+)
+
+func TestResendBurst(t *testing.T) {
+	now := time.Now()
+	burst := NewResendBurst(10 * time.Minute).(*memoryResendBurst)
+	burst.now = func() time.Time { return now }
+
+	for i := 1; i <= 3; i++ {
+		burst.Sent("+1234567890")
+		if got := burst.Count("+1234567890"); got != i {
+			t.Errorf("After %d sends, expected a count of %d, got %d", i, i, got)
+		}
+	}
+
+	// Other numbers are tracked separately
+	if got := burst.Count("+1987654321"); got != 0 {
+		t.Errorf("Expected no sends for a different number, got %d", got)
+	}
+
+	// A successful verify ends the burst
+	burst.Reset("+1234567890")
+	if got := burst.Count("+1234567890"); got != 0 {
+		t.Errorf("Expected the count to start over after a reset, got %d", got)
+	}
+
+	// So does a quiet period
+	burst.Sent("+1234567890")
+	now = now.Add(10 * time.Minute)
+	if got := burst.Count("+1234567890"); got != 0 {
+		t.Errorf("Expected the count to start over after the quiet period, got %d", got)
+	}
+	burst.Sent("+1234567890")
+	if got := burst.Count("+1234567890"); got != 1 {
+		t.Errorf("Expected a new burst of 1, got %d", got)
+	}
+}
+
+func TestAuthService_FreeResends(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+		OTP: config.OTPConfig{
+			ExpiryMinutes:         2,
+			Length:                6,
+			ResendCooldownSeconds: 60,
+			FreeResends:           2,
+		},
+		RateLimit: config.RateLimitConfig{
+			MaxRequests:   10,
+			WindowMinutes: 10,
+		},
+	}
+
+	ctx := context.Background()
+	phoneNumber := "+1234567890"
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	authService := NewAuthService(&mockUserRepository{users: make(map[string]*models.User)}, otpRepo, cfg,
+		WithCodeGenerator(fixedCodeGenerator{code: "123456"}), WithResendBurst(NewResendBurst(10*time.Minute)))
+
+	// The first request and two resends go out right away
+	for i := 0; i <= cfg.OTP.FreeResends; i++ {
+		if _, err := authService.GenerateOTP(ctx, phoneNumber); err != nil {
+			t.Fatalf("Request %d: expected no error, got %v", i+1, err)
+		}
+	}
+
+	// After that the cooldown applies
+	if cooldown, err := authService.ResendCooldown(ctx, phoneNumber); err != nil || cooldown <= 0 {
+		t.Errorf("Expected a cooldown once the free resends are used up, got %v, %v", cooldown, err)
+	}
+	if _, err := authService.GenerateOTP(ctx, phoneNumber); !errors.Is(err, ErrResendCooldown) {
+		t.Fatalf("Expected ErrResendCooldown after the free resends, got %v", err)
+	}
+
+	// A successful verify starts a new burst
+	if _, err := authService.VerifyOTP(ctx, models.OTPVerification{PhoneNumber: phoneNumber, Code: "123456"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cooldown, err := authService.ResendCooldown(ctx, phoneNumber); err != nil || cooldown != 0 {
+		t.Errorf("Expected no cooldown after a verify, got %v, %v", cooldown, err)
+	}
+	if _, err := authService.GenerateOTP(ctx, phoneNumber); err != nil {
+		t.Errorf("Expected a new OTP after a verify, got %v", err)
+	}
+}
@@ -2,15 +2,35 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 
 	"otp/internal/models"
 	"otp/internal/repository"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrMetadataTooLarge is returned when an update would grow a user's metadata
+// beyond models.MaxMetadataBytes.
+var ErrMetadataTooLarge = fmt.Errorf("metadata must not exceed %d bytes", models.MaxMetadataBytes)
+
+// ErrMetadataConflict is returned when a user's metadata kept changing
+// while an update was being applied.
+var ErrMetadataConflict = errors.New("metadata was changed concurrently")
+
+// maxMetadataUpdateAttempts bounds how often UpdateMetadata re-reads the
+// metadata after losing a race with another update
+const maxMetadataUpdateAttempts = 5
+
 type UserService interface {
 	GetByID(ctx context.Context, id string) (*models.UserResponse, error)
+	GetByPhoneNumber(ctx context.Context, phoneNumber string) (*models.UserResponse, error)
 	List(ctx context.Context, query models.PaginationQuery) (*models.UserListResponse, error)
+	Count(ctx context.Context, filter models.UserFilter) (int, error)
+	UpdateMetadata(ctx context.Context, id string, patch models.Metadata) (*models.UserResponse, error)
+	SetStatus(ctx context.Context, id string, status models.UserStatus) (*models.UserResponse, error)
 	Delete(ctx context.Context, id string) error
 }
 
@@ -31,23 +51,102 @@ func (s *userService) GetByID(ctx context.Context, id string) (*models.UserRespo
 	}
 
 	if user == nil {
-		return nil, errors.New("user not found")
+		return nil, ErrUserNotFound
+	}
+
+	response := user.ToResponseContext(ctx)
+	return &response, nil
+}
+
+func (s *userService) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*models.UserResponse, error) {
+	user, err := s.userRepo.GetByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
 	}
 
-	response := user.ToResponse()
+	response := user.ToResponseContext(ctx)
 	return &response, nil
 }
 
 func (s *userService) List(ctx context.Context, query models.PaginationQuery) (*models.UserListResponse, error) {
-	// Set default values if not provided
-	if query.Page == 0 {
-		query.Page = 1
+	query.Normalize()
+	// A substring search would let callers who only see masked numbers
+	// recover them one digit at a time
+	if models.MaskPhonesFromContext(ctx) {
+		query.ExactSearch = true
+	}
+
+	users, err := s.userRepo.List(ctx, query)
+	if err != nil {
+		return nil, err
 	}
-	if query.PageSize == 0 {
-		query.PageSize = 10
+
+	if models.MaskPhonesFromContext(ctx) {
+		for i := range users.Users {
+			users.Users[i].PhoneNumber = models.MaskPhone(users.Users[i].PhoneNumber)
+		}
+	}
+
+	return users, nil
+}
+
+func (s *userService) Count(ctx context.Context, filter models.UserFilter) (int, error) {
+	return s.userRepo.Count(ctx, filter)
+}
+
+// UpdateMetadata merges patch into the user's metadata, removing keys whose
+// value is null. The merge is written only if the metadata is unchanged
+// since it was read, and is retried on the latest metadata otherwise, so
+// concurrent updates of different keys all apply.
+func (s *userService) UpdateMetadata(ctx context.Context, id string, patch models.Metadata) (*models.UserResponse, error) {
+	for attempt := 0; attempt < maxMetadataUpdateAttempts; attempt++ {
+		user, err := s.userRepo.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if user == nil {
+			return nil, ErrUserNotFound
+		}
+
+		previous := user.Metadata
+		user.UpdateMetadata(patch)
+		encoded, err := json.Marshal(user.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode metadata: %w", err)
+		}
+		if len(encoded) > models.MaxMetadataBytes {
+			return nil, ErrMetadataTooLarge
+		}
+
+		updated, err := s.userRepo.UpdateMetadata(ctx, id, previous, user.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+		if updated {
+			response := user.ToResponseContext(ctx)
+			return &response, nil
+		}
+	}
+	return nil, ErrMetadataConflict
+}
+
+func (s *userService) SetStatus(ctx context.Context, id string, status models.UserStatus) (*models.UserResponse, error) {
+	user, err := s.userRepo.SetStatus(ctx, id, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
 	}
 
-	return s.userRepo.List(ctx, query)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	response := user.ToResponseContext(ctx)
+	return &response, nil
 }
 
 func (s *userService) Delete(ctx context.Context, id string) error {
@@ -58,7 +157,7 @@ func (s *userService) Delete(ctx context.Context, id string) error {
 	}
 
 	if user == nil {
-		return errors.New("user not found")
+		return ErrUserNotFound
 	}
 
 	return s.userRepo.Delete(ctx, id)
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"otp/internal/models"
+)
+
+// racingUserRepository applies a concurrent metadata change right before
+// the first races updates, and only writes metadata that is unchanged since
+// it was read, as the database does
+type racingUserRepository struct {
+	mockUserRepository
+	races   []models.Metadata
+	updates int
+}
+
+func (r *racingUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	user, err := r.mockUserRepository.GetByID(ctx, id)
+	if user == nil || err != nil {
+		return user, err
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *racingUserRepository) UpdateMetadata(ctx context.Context, id string, previous, metadata models.Metadata) (bool, error) {
+	r.updates++
+	user, exists := r.users[id]
+	if !exists {
+		return false, nil
+	}
+	if len(r.races) > 0 {
+		user.Metadata = user.Metadata.Merge(r.races[0])
+		r.races = r.races[1:]
+	}
+	if !reflect.DeepEqual(user.Metadata, previous) {
+		return false, nil
+	}
+	user.Metadata = metadata
+	return true, nil
+}
+
+func newMetadataTestService(metadata models.Metadata, races ...models.Metadata) (UserService, *racingUserRepository) {
+	user := models.NewUserWithID("user-1", "+1234567890")
+	user.Metadata = metadata
+	repo := &racingUserRepository{mockUserRepository: mockUserRepository{users: map[string]*models.User{user.ID: user}}, races: races}
+	return NewUserService(repo), repo
+}
+
+func TestUserService_UpdateMetadata_Merge(t *testing.T) {
+	service, repo := newMetadataTestService(models.Metadata{"app_version": "1.2.0", "referral_source": "ads"})
+
+	response, err := service.UpdateMetadata(context.Background(), "user-1", models.Metadata{"app_version": "1.3.0", "referral_source": nil, "plan": "pro"})
+	if err != nil {
+		t.Fatalf("UpdateMetadata returned error: %v", err)
+	}
+
+	want := models.Metadata{"app_version": "1.3.0", "plan": "pro"}
+	if !reflect.DeepEqual(response.Metadata, want) {
+		t.Errorf("Expected response metadata %v, got %v", want, response.Metadata)
+	}
+	if !reflect.DeepEqual(repo.users["user-1"].Metadata, want) {
+		t.Errorf("Expected stored metadata %v, got %v", want, repo.users["user-1"].Metadata)
+	}
+
+	if _, err := service.UpdateMetadata(context.Background(), "missing", models.Metadata{"plan": "pro"}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestUserService_UpdateMetadata_KeepsConcurrentChanges(t *testing.T) {
+	service, repo := newMetadataTestService(models.Metadata{"plan": "free"}, models.Metadata{"locale": "fr"})
+
+	if _, err := service.UpdateMetadata(context.Background(), "user-1", models.Metadata{"plan": "pro"}); err != nil {
+		t.Fatalf("UpdateMetadata returned error: %v", err)
+	}
+
+	want := models.Metadata{"plan": "pro", "locale": "fr"}
+	if !reflect.DeepEqual(repo.users["user-1"].Metadata, want) {
+		t.Errorf("Expected both changes to be kept, got %v", repo.users["user-1"].Metadata)
+	}
+	if repo.updates != 2 {
+		t.Errorf("Expected the update to be retried once, got %d attempts", repo.updates)
+	}
+}
+
+func TestUserService_UpdateMetadata_GivesUpOnConstantChanges(t *testing.T) {
+	races := make([]models.Metadata, maxMetadataUpdateAttempts)
+	for i := range races {
+		races[i] = models.Metadata{"counter": float64(i)}
+	}
+	service, repo := newMetadataTestService(nil, races...)
+
+	if _, err := service.UpdateMetadata(context.Background(), "user-1", models.Metadata{"plan": "pro"}); !errors.Is(err, ErrMetadataConflict) {
+		t.Fatalf("Expected ErrMetadataConflict, got %v", err)
+	}
+	if repo.updates != maxMetadataUpdateAttempts {
+		t.Errorf("Expected %d attempts, got %d", maxMetadataUpdateAttempts, repo.updates)
+	}
+}
+
+func TestUserService_UpdateMetadata_SizeLimit(t *testing.T) {
+	existing := models.Metadata{"notes": strings.Repeat("a", models.MaxMetadataBytes-100)}
+	service, repo := newMetadataTestService(existing)
+
+	// The limit applies to the merged metadata, not just the patch
+	if _, err := service.UpdateMetadata(context.Background(), "user-1", models.Metadata{"bio": strings.Repeat("b", 200)}); !errors.Is(err, ErrMetadataTooLarge) {
+		t.Fatalf("Expected ErrMetadataTooLarge, got %v", err)
+	}
+	if repo.updates != 0 || !reflect.DeepEqual(repo.users["user-1"].Metadata, existing) {
+		t.Errorf("Expected the metadata to be left alone, got %d updates", repo.updates)
+	}
+
+	// Removing keys brings it back under the limit
+	if _, err := service.UpdateMetadata(context.Background(), "user-1", models.Metadata{"notes": nil, "bio": strings.Repeat("b", 200)}); err != nil {
+		t.Errorf("Expected an update that shrinks the metadata to succeed, got %v", err)
+	}
+}
+
+// listingUserRepository records the last list query
+type listingUserRepository struct {
+	mockUserRepository
+	query models.PaginationQuery
+}
+
+func (r *listingUserRepository) List(ctx context.Context, query models.PaginationQuery) (*models.UserListResponse, error) {
+	r.query = query
+	return &models.UserListResponse{}, nil
+}
+
+func TestUserService_List_MaskedCallersSearchWholeNumbers(t *testing.T) {
+	repo := &listingUserRepository{}
+	service := NewUserService(repo)
+	query := models.PaginationQuery{Search: "+1415"}
+
+	if _, err := service.List(context.Background(), query); err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if repo.query.ExactSearch {
+		t.Error("Expected a substring search for callers who see full numbers")
+	}
+
+	if _, err := service.List(models.ContextWithMaskedPhones(context.Background()), query); err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if !repo.query.ExactSearch {
+		t.Error("Expected only whole-number matches for callers who see masked numbers")
+	}
+}
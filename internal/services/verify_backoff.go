@@ -0,0 +1,90 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// VerifyBackoff slows down repeated wrong codes for a phone number. Each
+// consecutive wrong code waits longer before its response is sent, which
+// makes guessing slow without locking out the real user.
+type VerifyBackoff interface {
+	// Failure records a wrong code for the phone number and returns how long
+	// to wait before responding
+	Failure(phoneNumber string) time.Duration
+	// Reset forgets the phone number's failures after a successful verify
+	Reset(phoneNumber string)
+}
+
+type backoffEntry struct {
+	failures int
+	lastSeen time.Time
+}
+
+type memoryVerifyBackoff struct {
+	mu        sync.Mutex
+	base      time.Duration
+	max       time.Duration
+	window    time.Duration
+	entries   map[string]*backoffEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewVerifyBackoff returns an in-process VerifyBackoff. The first wrong code
+// is answered immediately, the second after base, and each one after that
+// waits twice as long as the last, up to max. A phone number's count starts
+// over once it has had no wrong codes for window.
+func NewVerifyBackoff(base, max, window time.Duration) VerifyBackoff {
+	return &memoryVerifyBackoff{
+		base:      base,
+		max:       max,
+		window:    window,
+		entries:   make(map[string]*backoffEntry),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (b *memoryVerifyBackoff) Failure(phoneNumber string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	// Periodically drop numbers that have gone quiet so the map doesn't grow forever
+	if now.Sub(b.lastSweep) >= b.window {
+		for key, entry := range b.entries {
+			if now.Sub(entry.lastSeen) >= b.window {
+				delete(b.entries, key)
+			}
+		}
+		b.lastSweep = now
+	}
+
+	entry, exists := b.entries[phoneNumber]
+	if !exists || now.Sub(entry.lastSeen) >= b.window {
+		entry = &backoffEntry{}
+		b.entries[phoneNumber] = entry
+	}
+	entry.failures++
+	entry.lastSeen = now
+
+	if entry.failures < 2 {
+		return 0
+	}
+	delay := b.base
+	for i := 2; i < entry.failures && delay < b.max; i++ {
+		delay *= 2
+	}
+	if delay > b.max {
+		delay = b.max
+	}
+	return delay
+}
+
+func (b *memoryVerifyBackoff) Reset(phoneNumber string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, phoneNumber)
+}
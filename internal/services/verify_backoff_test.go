@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"otp/internal/config"
+	"otp/internal/models"
+)
+
+func TestVerifyBackoff(t *testing.T) {
+	now := time.Now()
+	backoff := NewVerifyBackoff(500*time.Millisecond, 2*time.Second, 10*time.Minute).(*memoryVerifyBackoff)
+	backoff.now = func() time.Time { return now }
+
+	want := []time.Duration{0, 500 * time.Millisecond, time.Second, 2 * time.Second, 2 * time.Second}
+	for i, delay := range want {
+		if got := backoff.Failure("+1234567890"); got != delay {
+			t.Errorf("Failure %d: expected delay %v, got %v", i+1, delay, got)
+		}
+	}
+
+	// Other numbers are tracked separately
+	if got := backoff.Failure("+1987654321"); got != 0 {
+		t.Errorf("Expected no delay for a different number, got %v", got)
+	}
+
+	// A success starts the count over
+	backoff.Reset("+1234567890")
+	if got := backoff.Failure("+1234567890"); got != 0 {
+		t.Errorf("Expected no delay after a reset, got %v", got)
+	}
+
+	// So does a quiet window
+	backoff.Failure("+1234567890")
+	now = now.Add(10 * time.Minute)
+	if got := backoff.Failure("+1234567890"); got != 0 {
+		t.Errorf("Expected no delay after the window, got %v", got)
+	}
+}
+
+func TestAuthService_VerifyOTP_Backoff(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:      "test-secret",
+			ExpiryHours: 24,
+		},
+	}
+
+	phoneNumber := "+1234567890"
+	otpRepo := &mockOTPRepository{otps: make(map[string]*models.OTP)}
+	otpRepo.otps[phoneNumber] = models.NewOTP(phoneNumber, "123456", 2)
+	backoff := NewVerifyBackoff(time.Hour, time.Hour, time.Hour)
+	authService := NewAuthService(&mockUserRepository{users: make(map[string]*models.User)}, otpRepo, cfg, WithVerifyBackoff(backoff))
+
+	// The first wrong code is answered immediately
+	wrong := models.OTPVerification{PhoneNumber: phoneNumber, Code: "000000"}
+	if _, err := authService.VerifyOTP(context.Background(), wrong); !errors.Is(err, ErrOTPWrongCode) {
+		t.Fatalf("Expected ErrOTPWrongCode, got %v", err)
+	}
+
+	// The second would wait an hour, but stops when the client goes away
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := authService.VerifyOTP(ctx, wrong); !errors.Is(err, ErrOTPWrongCode) {
+		t.Errorf("Expected ErrOTPWrongCode, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the delay to end with the context, took %v", elapsed)
+	}
+
+	// The correct code is never delayed
+	start = time.Now()
+	if _, err := authService.VerifyOTP(context.Background(), models.OTPVerification{PhoneNumber: phoneNumber, Code: "123456"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the correct code to verify immediately, took %v", elapsed)
+	}
+}
@@ -0,0 +1,139 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var e164Pattern = regexp.MustCompile(`^\+[1-9]\d{1,14}$`)
+
+// phonePattern matches numbers in E.164, international (00-prefixed) or
+// national format once separators are removed
+var phonePattern = regexp.MustCompile(`^\+?\d{4,17}$`)
+
+// ErrNotE164 is returned for a phone number that cannot be turned into E.164
+var ErrNotE164 = errors.New("phone number must be in E.164 format, or in national format for the default region")
+
+// region holds what is needed to turn a national number into E.164
+type region struct {
+	callingCode string
+	// trunkPrefix is dialled before national numbers and dropped in E.164
+	trunkPrefix string
+}
+
+// regions lists the supported default regions by ISO 3166-1 alpha-2 code
+var regions = map[string]region{
+	"AT": {"43", "0"},
+	"AU": {"61", "0"},
+	"AZ": {"994", "0"},
+	"BE": {"32", "0"},
+	"BR": {"55", "0"},
+	"CA": {"1", "1"},
+	"CH": {"41", "0"},
+	"DE": {"49", "0"},
+	"DK": {"45", ""},
+	"ES": {"34", ""},
+	"FR": {"33", "0"},
+	"GB": {"44", "0"},
+	"IE": {"353", "0"},
+	"IN": {"91", "0"},
+	"IT": {"39", ""},
+	"JP": {"81", "0"},
+	"MX": {"52", ""},
+	"NL": {"31", "0"},
+	"NO": {"47", ""},
+	"NZ": {"64", "0"},
+	"PL": {"48", ""},
+	"PT": {"351", ""},
+	"SE": {"46", "0"},
+	"TR": {"90", "0"},
+	"US": {"1", "1"},
+	"ZA": {"27", "0"},
+}
+
+// IsE164 reports whether value is a phone number in E.164 format
+func IsE164(value string) bool {
+	return e164Pattern.MatchString(value)
+}
+
+// phoneSeparators are the formatting characters people commonly type or paste
+// into phone numbers
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+
+// NormalizePhoneNumber strips surrounding whitespace and formatting
+// characters, so "+1 (415) 555-2671" becomes "+14155552671". The result still
+// needs checking with IsE164.
+func NormalizePhoneNumber(value string) string {
+	return phoneSeparators.Replace(strings.TrimSpace(value))
+}
+
+// IsKnownRegion reports whether code is a supported default region
+func IsKnownRegion(code string) bool {
+	_, ok := regions[code]
+	return ok
+}
+
+// CanonicalPhoneNumber returns value in E.164 format. Besides E.164 it
+// accepts the international 00 prefix, and national numbers such as
+// "020 7123 4567" when defaultRegion names the country they belong to (here
+// "GB", giving "+442071234567"). Generate and verify both use it so a code
+// can be verified with any equivalent spelling of the number.
+func CanonicalPhoneNumber(value, defaultRegion string) (string, error) {
+	number := NormalizePhoneNumber(value)
+	switch {
+	case strings.HasPrefix(number, "+"):
+	case strings.HasPrefix(number, "00"):
+		number = "+" + number[2:]
+	default:
+		r, ok := regions[defaultRegion]
+		if !ok || !phonePattern.MatchString(number) {
+			return "", ErrNotE164
+		}
+		number = "+" + r.callingCode + strings.TrimPrefix(number, r.trunkPrefix)
+	}
+
+	if !IsE164(number) {
+		return "", ErrNotE164
+	}
+	return number, nil
+}
+
+// RegisterValidators registers the custom binding tags used by the request
+// models with gin's validator. It must be called once at startup.
+func RegisterValidators() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("unexpected binding validator engine")
+	}
+
+	// Report field errors using the JSON/form names clients actually send
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "form"} {
+			name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+			if name != "" && name != "-" {
+				return name
+			}
+		}
+		return field.Name
+	})
+
+	// strict_e164 only accepts E.164 as stored, without separators; the
+	// validator's own e164 tag is left as it is
+	if err := v.RegisterValidation("strict_e164", func(fl validator.FieldLevel) bool {
+		return IsE164(fl.Field().String())
+	}); err != nil {
+		return err
+	}
+
+	// phone accepts any format CanonicalPhoneNumber might understand;
+	// whether a national number is usable depends on the default region,
+	// which is checked when it is canonicalized
+	return v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+		return phonePattern.MatchString(NormalizePhoneNumber(fl.Field().String()))
+	})
+}
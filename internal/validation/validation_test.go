@@ -0,0 +1,77 @@
+package validation
+
+import "testing"
+
+func TestNormalizePhoneNumber(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"+14155552671", "+14155552671"},
+		{"  +1 (415) 555-2671 ", "+14155552671"},
+		{"+44.20.7123.4567", "+442071234567"},
+		{"4155552671", "4155552671"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizePhoneNumber(tt.value); got != tt.want {
+			t.Errorf("NormalizePhoneNumber(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsE164(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"+1234567890", true},
+		{"+442071234567", true},
+		{"+123456789012345", true},
+		{"hello", false},
+		{"", false},
+		{"1234567890", false},
+		{"+0123456789", false},
+		{"+1", false},
+		{"+1234567890123456", false},
+		{"+1 234 567 890", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsE164(tt.value); got != tt.want {
+			t.Errorf("IsE164(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalPhoneNumber(t *testing.T) {
+	tests := []struct {
+		value         string
+		defaultRegion string
+		want          string
+		wantErr       bool
+	}{
+		{"+442071234567", "", "+442071234567", false},
+		{"+44 20 7123 4567", "US", "+442071234567", false},
+		{"02071234567", "GB", "+442071234567", false},
+		{"0044 20 7123 4567", "GB", "+442071234567", false},
+		{"(415) 555-2671", "US", "+14155552671", false},
+		{"1 415 555 2671", "US", "+14155552671", false},
+		{"02071234567", "", "", true},
+		{"02071234567", "ZZ", "", true},
+		{"+0123456789", "GB", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := CanonicalPhoneNumber(tt.value, tt.defaultRegion)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("CanonicalPhoneNumber(%q, %q) = %q, want error", tt.value, tt.defaultRegion, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("CanonicalPhoneNumber(%q, %q) = %q, %v, want %q", tt.value, tt.defaultRegion, got, err, tt.want)
+		}
+	}
+}